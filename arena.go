@@ -0,0 +1,45 @@
+package main
+
+// StringArena holds the bytes of strings and blobs decoded by
+// DecodeInArena in one contiguous buffer, so a message with thousands of
+// small strings costs a single allocation instead of one per string while
+// the result still never aliases the input. The zero value is ready to use.
+// A StringArena must not be used by more than one goroutine at a time.
+type StringArena struct {
+	buf []byte
+}
+
+// Reset recycles the arena's buffer for the next DecodeInArena. Strings and
+// blobs decoded into it earlier must no longer be used, since their bytes
+// will be overwritten.
+func (a *StringArena) Reset() {
+	a.buf = a.buf[:0]
+}
+
+// reserve makes room for n more bytes without moving the bytes already in
+// the arena. If the buffer is too small it is replaced, leaving strings
+// already handed out in the old one.
+func (a *StringArena) reserve(n int) {
+	if cap(a.buf)-len(a.buf) < n {
+		a.buf = make([]byte, 0, max(n, 2*cap(a.buf)))
+	}
+}
+
+// alloc copies b into the arena and returns the copy, capped so appending
+// to it cannot overwrite its neighbors.
+func (a *StringArena) alloc(b []byte) []byte {
+	start := len(a.buf)
+	a.buf = append(a.buf, b...)
+	return a.buf[start:len(a.buf):len(a.buf)]
+}
+
+// DecodeInArena is like DecodeSafe but copies every string and blob into
+// arena rather than allocating each separately. The result stays valid
+// until arena is Reset. Since strings and blobs never take more room than
+// the message itself, each call grows the arena at most once.
+func DecodeInArena(data []byte, arena *StringArena) (DataInput, error) {
+	arena.reserve(len(data))
+	cfg := DefaultConfig
+	cfg.arena = arena
+	return DecodeWithConfig(data, cfg)
+}
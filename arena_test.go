@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestDecodeInArena checks arena results never alias the input and that
+// Reset recycles the buffer without another allocation for it.
+func TestDecodeInArena(t *testing.T) {
+	in := DataInput{"hello", []byte{1, 2, 3}, DataInput{"nested", ""}, map[string]interface{}{"key": "value"}}
+	data := roundTrip(t, in)
+
+	var arena StringArena
+	got, err := DecodeInArena(data, &arena)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := headerLen; i < len(data); i++ {
+		data[i] = 'z'
+	}
+	if !got.Equal(in) {
+		t.Errorf("result changed with the input: got %v, want %v", got, in)
+	}
+
+	// Appending to a blob must not overwrite the next string in the arena.
+	b := got[1].([]byte)
+	_ = append(b, 'x', 'x', 'x', 'x', 'x', 'x', 'x')
+	if got[2].(DataInput)[0] != "nested" {
+		t.Errorf("appending to a blob overwrote its neighbor: %q", got[2].(DataInput)[0])
+	}
+
+	data = roundTrip(t, in)
+	buf := &arena.buf[:1][0]
+	arena.Reset()
+	if _, err := DecodeInArena(data, &arena); err != nil {
+		t.Fatal(err)
+	}
+	if &arena.buf[:1][0] != buf {
+		t.Error("Reset arena was not reused")
+	}
+}
+
+// TestArenaRegrow decodes into an arena too small for the second message
+// without a Reset, so reserve replaces its buffer, and checks strings from
+// the first decode survive.
+func TestArenaRegrow(t *testing.T) {
+	first := DataInput{"first", "strings"}
+	second := make(DataInput, 100)
+	for i := range second {
+		second[i] = fmt.Sprintf("string %d", i)
+	}
+
+	var arena StringArena
+	got1, err := DecodeInArena(roundTrip(t, first), &arena)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := cap(arena.buf)
+	got2, err := DecodeInArena(roundTrip(t, second), &arena)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(arena.buf) == before {
+		t.Fatal("arena did not grow; the test needs a larger second message")
+	}
+	if !got1.Equal(first) || !got2.Equal(second) {
+		t.Errorf("after regrowing: got %v and %v", got1, got2)
+	}
+
+	// Filling the new buffer leaves the old strings alone too.
+	arena.alloc(make([]byte, cap(arena.buf)-len(arena.buf)))
+	if !got1.Equal(first) {
+		t.Errorf("first result changed: %v", got1)
+	}
+}
+
+func BenchmarkDecodeInArena(b *testing.B) {
+	in := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range in {
+		in[i] = fmt.Sprintf("s%d", i)
+	}
+	data, err := encode(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("DecodeSafe", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeSafe(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("DecodeInArena", func(b *testing.B) {
+		b.ReportAllocs()
+		var arena StringArena
+		for i := 0; i < b.N; i++ {
+			arena.Reset()
+			if _, err := DecodeInArena(data, &arena); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// benchPayload is a representative input and the options to encode it with.
+type benchPayload struct {
+	name string
+	data DataInput
+	cfg  Config
+}
+
+// benchPayloads returns the inputs BenchmarkEncode and BenchmarkDecode run
+// over. The varint payloads stress the varint path with many small
+// integers, StringArrayFast is LargeStringArray in the string array form,
+// and OptimizedInt64s writes small int64 values as varints.
+func benchPayloads() []benchPayload {
+	scalars := DataInput{"id", int32(42), int64(-7), 3.14, true, nil, uint8(9), []byte{1, 2, 3}}
+
+	strs := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range strs {
+		strs[i] = fmt.Sprintf("value-%d", i%50)
+	}
+
+	nested := DataInput{"leaf", int32(1)}
+	for i := 0; i < DefaultConfig.MaxDepth-1; i++ {
+		nested = DataInput{nested, int32(i)}
+	}
+
+	r := rand.New(rand.NewSource(56))
+	mixed := make(DataInput, 200)
+	for i := range mixed {
+		mixed[i] = randomValue(r, 3)
+	}
+
+	ints := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range ints {
+		ints[i] = int32(i % 100)
+	}
+
+	int64s := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range int64s {
+		int64s[i] = int64(i%100 - 50)
+	}
+
+	return []benchPayload{
+		{"SmallScalars", scalars, Config{}},
+		{"LargeStringArray", strs, Config{}},
+		{"StringArrayFast", strs, Config{StringArrays: true}},
+		{"DeeplyNested", nested, Config{}},
+		{"Mixed", mixed, Config{}},
+		{"SmallInts", ints, Config{}},
+		{"VarintSmallInts", ints, Config{VarintInts: true}},
+		{"SmallInt64s", int64s, Config{}},
+		{"OptimizedInt64s", int64s, Config{OptimizeIntegers: true}},
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, p := range benchPayloads() {
+		b.Run(p.name, func(b *testing.B) {
+			data, err := EncodeWithConfig(p.data, p.cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := EncodeWithConfig(p.data, p.cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, p := range benchPayloads() {
+		b.Run(p.name, func(b *testing.B) {
+			data, err := EncodeWithConfig(p.data, p.cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := decode(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// largePayload returns a message of about 2 MB, big enough that growing
+// the output by append reallocates many times.
+func largePayload() DataInput {
+	d := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range d {
+		d[i] = DataInput{fmt.Sprintf("%02000d", i), int64(i)}
+	}
+	return d
+}
+
+// BenchmarkEncodeWithHint compares growing the output from empty with
+// allocating it once from an EncodedSize hint.
+func BenchmarkEncodeWithHint(b *testing.B) {
+	d := largePayload()
+	size, err := EncodedSize(d)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("NoHint", func(b *testing.B) {
+		b.SetBytes(int64(size))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeTo(nil, d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Hint", func(b *testing.B) {
+		b.SetBytes(int64(size))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeWithHint(d, size); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Sign bytes of an encoded *big.Int.
+const (
+	bigIntPositive byte = 0 // Zero or positive
+	bigIntNegative byte = 1
+)
+
+// appendBigInt writes v as 'Z', a sign byte, and its magnitude as a varint
+// length and big-endian bytes without leading zeros, so every value has
+// exactly one encoding and zero has an empty magnitude.
+func appendBigInt(buf []byte, v *big.Int, cfg *Config) ([]byte, error) {
+	n, err := bigIntLen(v, cfg)
+	if err != nil {
+		return nil, err
+	}
+	sign := bigIntPositive
+	if v.Sign() < 0 {
+		sign = bigIntNegative
+	}
+	buf = append(buf, byte(TypeBigInt), sign)
+	buf = appendVarint(buf, uint64(n))
+	start := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	v.FillBytes(buf[start:])
+	return buf, nil
+}
+
+// bigIntLen returns the magnitude length of v in bytes, checking it against
+// cfg.MaxBigIntLen.
+func bigIntLen(v *big.Int, cfg *Config) (int, error) {
+	if v == nil {
+		return 0, fmt.Errorf("%w: nil *big.Int", ErrUnsupportedType)
+	}
+	n := (v.BitLen() + 7) / 8
+	if n > cfg.MaxBigIntLen {
+		return 0, limitError(ErrBigIntTooLong, cfg.MaxBigIntLen, uint64(n))
+	}
+	return n, nil
+}
+
+// readBigInt reads the sign and magnitude of a big integer whose identifier
+// has already been consumed. The magnitude is a view into data. Encodings
+// other than the one appendBigInt writes are rejected with ErrInvalidBigInt.
+func readBigInt(data []byte, pos *int, cfg *Config) (bool, []byte, error) {
+	if err := need(data, *pos, 1, "big.Int"); err != nil {
+		return false, nil, err
+	}
+	sign := data[*pos]
+	if sign != bigIntPositive && sign != bigIntNegative {
+		return false, nil, fmt.Errorf("%w: sign %d", ErrInvalidBigInt, sign)
+	}
+	*pos++
+
+	n, err := readLength(data, pos, cfg.MaxBigIntLen, ErrBigIntTooLong, "big.Int")
+	if err != nil {
+		return false, nil, err
+	}
+
+	mag := data[*pos : *pos+n]
+	if n > 0 && mag[0] == 0 {
+		return false, nil, fmt.Errorf("%w: leading zero", ErrInvalidBigInt)
+	}
+	if n == 0 && sign == bigIntNegative {
+		return false, nil, fmt.Errorf("%w: negative zero", ErrInvalidBigInt)
+	}
+	*pos += n
+	return sign == bigIntNegative, mag, nil
+}
+
+// decodeBigInt decodes a big integer whose identifier has already been
+// consumed.
+func decodeBigInt(data []byte, pos *int, cfg *Config) (*big.Int, error) {
+	neg, mag, err := readBigInt(data, pos, cfg)
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).SetBytes(mag)
+	if neg {
+		v.Neg(v)
+	}
+	return v, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestBigIntRoundTrip(t *testing.T) {
+	large, _ := new(big.Int).SetString("123456789012345678901234567890123456789", 10)
+	tests := []struct {
+		v       *big.Int
+		payload []byte // Sign, length and magnitude
+	}{
+		{big.NewInt(0), []byte{bigIntPositive, 0}},
+		{big.NewInt(1), []byte{bigIntPositive, 1, 1}},
+		{big.NewInt(-256), []byte{bigIntNegative, 2, 1, 0}},
+		{large, nil},
+		{new(big.Int).Neg(large), nil},
+		{new(big.Int).Lsh(big.NewInt(1), 64), append([]byte{bigIntPositive, 9, 1}, make([]byte, 8)...)},
+	}
+	for _, tt := range tests {
+		data, err := encode(DataInput{tt.v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.payload != nil && !bytes.Equal(data[headerLen+3:], tt.payload) {
+			t.Errorf("%v payload %x, want %x", tt.v, data[headerLen+3:], tt.payload)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.v, err)
+		}
+		if g, ok := got[0].(*big.Int); !ok || g.Cmp(tt.v) != 0 {
+			t.Errorf("got %v, want %v", got[0], tt.v)
+		}
+	}
+}
+
+func TestBigIntLimit(t *testing.T) {
+	v := new(big.Int).Lsh(big.NewInt(1), uint(8*DefaultConfig.MaxBigIntLen)) // One byte too long
+	if _, err := encode(DataInput{v}); !errors.Is(err, ErrBigIntTooLong) {
+		t.Errorf("encode: got %v, want ErrBigIntTooLong", err)
+	}
+	cfg := Config{MaxBigIntLen: DefaultConfig.MaxBigIntLen + 1}
+	data, err := EncodeWithConfig(DataInput{v}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decode(data); !errors.Is(err, ErrBigIntTooLong) {
+		t.Errorf("decode: got %v, want ErrBigIntTooLong", err)
+	}
+	if got, err := DecodeWithConfig(data, cfg); err != nil || got[0].(*big.Int).Cmp(v) != 0 {
+		t.Errorf("decode with the raised limit: %v, %v", got, err)
+	}
+	if _, err := encode(DataInput{(*big.Int)(nil)}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("nil *big.Int: got %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestBigIntNonCanonical(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    error
+	}{
+		{"leading zero", []byte{bigIntPositive, 2, 0, 1}, ErrInvalidBigInt},
+		{"negative zero", []byte{bigIntNegative, 0}, ErrInvalidBigInt},
+		{"bad sign", []byte{2, 1, 1}, ErrInvalidBigInt},
+		{"truncated", []byte{bigIntPositive, 2, 1}, ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		data := message(append([]byte{byte(TypeArray), 1, byte(TypeBigInt)}, tt.payload...)...)
+		if _, err := decode(data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultBufferSize is the initial capacity of pooled encode buffers until
+// SetBufferPoolSize changes it.
+const defaultBufferSize = 1024
+
+// bufferSize holds the value set by SetBufferPoolSize, or zero for the
+// default.
+var bufferSize atomic.Int64
+
+// bufPools[c] holds scratch encode buffers with capacity in
+// [size<<c, size<<(c+1)), where size is the current initial capacity.
+// Buffers that outgrow the last class are left to the garbage collector,
+// so one huge message does not pin its buffer for good.
+var bufPools [12]sync.Pool
+
+// SetBufferPoolSize sets the initial capacity of the scratch buffers that
+// encode and the other one-shot encode functions draw from their pool,
+// 1024 bytes by default; n <= 0 restores the default. Buffers are pooled by
+// power-of-two size class above it, so small and large messages each get
+// a buffer close to their size. It is safe to call at any time; buffers
+// pooled earlier are reused only while they still fit their class.
+func SetBufferPoolSize(n int) {
+	bufferSize.Store(int64(max(n, 0)))
+}
+
+// poolBufferSize returns the current initial buffer capacity.
+func poolBufferSize() int {
+	if n := bufferSize.Load(); n > 0 {
+		return int(n)
+	}
+	return defaultBufferSize
+}
+
+// getBuffer returns an empty pooled buffer with capacity for at least hint
+// bytes, or for the initial capacity if that is larger. Return it with
+// putBuffer.
+func getBuffer(hint int) *[]byte {
+	size := poolBufferSize()
+	c := 0
+	if hint > size {
+		c = bits.Len(uint((hint - 1) / size)) // Smallest class whose buffers all fit hint
+	}
+	if c < len(bufPools) {
+		// A buffer pooled before SetBufferPoolSize changed the size may sit
+		// in a class it no longer belongs to; drop it if it is too small.
+		if bp, ok := bufPools[c].Get().(*[]byte); ok && cap(*bp) >= max(hint, size) {
+			return bp
+		}
+	}
+	buf := make([]byte, 0, max(hint, size<<min(c, len(bufPools)-1)))
+	return &buf
+}
+
+// sizeHint estimates the encoded size of data from its top level alone, so
+// encode can pick a buffer size class without a full EncodedSize pass:
+// strings and blobs count their length, nested arrays and maps a few bytes
+// per element, and other values a fixed width.
+func sizeHint(data DataInput) int {
+	n := headerLen + 1 + varintLen(uint64(len(data)))
+	for _, v := range data {
+		switch v := v.(type) {
+		case string:
+			n += 2 + len(v)
+		case []byte:
+			n += 2 + len(v)
+		case DataInput:
+			n += 2 + 8*len(v)
+		case map[string]interface{}:
+			n += 2 + 16*len(v)
+		default:
+			n += 9
+		}
+	}
+	return n
+}
+
+// putBuffer returns bp to the pool of its size class. Buffers smaller than
+// the initial capacity or beyond the largest class are dropped.
+func putBuffer(bp *[]byte) {
+	size := poolBufferSize()
+	if cap(*bp) < size {
+		return
+	}
+	c := bits.Len(uint(cap(*bp)/size)) - 1
+	if c >= len(bufPools) {
+		return
+	}
+	*bp = (*bp)[:0]
+	bufPools[c].Put(bp)
+}
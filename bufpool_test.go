@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGetBuffer(t *testing.T) {
+	for _, size := range []int{0, 1, 64, 4096} {
+		SetBufferPoolSize(size)
+		want := size
+		if size == 0 {
+			want = defaultBufferSize
+		}
+		if got := poolBufferSize(); got != want {
+			t.Errorf("SetBufferPoolSize(%d): size %d, want %d", size, got, want)
+		}
+		for _, hint := range []int{0, 1, want - 1, want, want + 1, 3 * want, want << 11, want<<12 + 1, 1 << 22} {
+			bp := getBuffer(hint)
+			if len(*bp) != 0 || cap(*bp) < hint {
+				t.Errorf("size %d, hint %d: got len %d cap %d", want, hint, len(*bp), cap(*bp))
+			}
+			*bp = append(*bp, "dirty"...)
+			putBuffer(bp)
+		}
+	}
+	SetBufferPoolSize(0)
+
+	// Every size class hands back buffers that fit the hint, whatever was
+	// put into the pools before.
+	for c := 0; c < len(bufPools)+1; c++ {
+		bp := getBuffer(defaultBufferSize << c)
+		*bp = append(*bp, make([]byte, cap(*bp))...)
+		putBuffer(bp)
+	}
+	for c := 0; c < len(bufPools)+1; c++ {
+		hint := defaultBufferSize<<c + 1
+		if bp := getBuffer(hint); len(*bp) != 0 || cap(*bp) < hint {
+			t.Errorf("hint %d: got len %d cap %d", hint, len(*bp), cap(*bp))
+		}
+	}
+}
+
+// TestBufferPoolSizeEncodes checks the pool size never changes what encode
+// writes, for messages smaller and larger than the buffers.
+func TestBufferPoolSizeEncodes(t *testing.T) {
+	defer SetBufferPoolSize(0)
+	inputs := []DataInput{
+		{},
+		{"small", int32(1)},
+		{strings.Repeat("x", 5000), DataInput{[]byte(strings.Repeat("y", 70000))}},
+	}
+	var want [][]byte
+	for _, in := range inputs {
+		data, err := encode(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, data)
+	}
+	for _, size := range []int{1, 16, 1 << 16, 0} {
+		SetBufferPoolSize(size)
+		for round := 0; round < 3; round++ { // Later rounds reuse pooled buffers
+			for i, in := range inputs {
+				data, err := encode(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, want[i]) {
+					t.Errorf("size %d: input %d encoded differently", size, i)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkBufferPool encodes small and large messages with several initial
+// buffer sizes, to show the size classes spare large messages from growing
+// a small buffer.
+func BenchmarkBufferPool(b *testing.B) {
+	defer SetBufferPoolSize(0)
+	messages := []struct {
+		name string
+		data DataInput
+	}{
+		{"Small", DataInput{"id", int32(42)}},
+		{"Large", DataInput{strings.Repeat("x", 1<<16), make([]byte, 1<<15)}},
+	}
+	for _, m := range messages {
+		for _, size := range []int{64, defaultBufferSize, 1 << 16} {
+			b.Run(fmt.Sprintf("%s/size=%d", m.name, size), func(b *testing.B) {
+				SetBufferPoolSize(size)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := encode(m.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Builder assembles a DataInput through typed methods, so every element
+// has exactly the Go type its method names and no untyped constant slips
+// in with a type the caller did not intend. Methods return the Builder for
+// chaining:
+//
+//	data, err := NewBuilder().
+//		AddString("id").AddInt32(123).
+//		BeginArray().AddFloat64(3.14).AddBool(true).EndArray().
+//		Build()
+//
+// Misuse, such as EndArray without a matching BeginArray, is reported by
+// Build with ErrUnbalancedArray. The zero value is not usable; call NewBuilder.
+type Builder struct {
+	stack []DataInput // The top-level array, then each array still open
+	err   error
+}
+
+// NewBuilder returns a Builder for an empty top-level array.
+func NewBuilder() *Builder {
+	return &Builder{stack: []DataInput{{}}}
+}
+
+// add appends v to the innermost open array.
+func (b *Builder) add(v interface{}) *Builder {
+	top := &b.stack[len(b.stack)-1]
+	*top = append(*top, v)
+	return b
+}
+
+// The Add methods append one element of the named type to the innermost
+// open array.
+
+func (b *Builder) AddString(s string) *Builder   { return b.add(s) }
+func (b *Builder) AddBlob(p []byte) *Builder     { return b.add(p) }
+func (b *Builder) AddBool(v bool) *Builder       { return b.add(v) }
+func (b *Builder) AddInt8(v int8) *Builder       { return b.add(v) }
+func (b *Builder) AddInt16(v int16) *Builder     { return b.add(v) }
+func (b *Builder) AddInt32(v int32) *Builder     { return b.add(v) }
+func (b *Builder) AddInt64(v int64) *Builder     { return b.add(v) }
+func (b *Builder) AddUint8(v uint8) *Builder     { return b.add(v) }
+func (b *Builder) AddUint16(v uint16) *Builder   { return b.add(v) }
+func (b *Builder) AddUint32(v uint32) *Builder   { return b.add(v) }
+func (b *Builder) AddUint64(v uint64) *Builder   { return b.add(v) }
+func (b *Builder) AddFloat32(v float32) *Builder { return b.add(v) }
+func (b *Builder) AddFloat64(v float64) *Builder { return b.add(v) }
+func (b *Builder) AddTime(t time.Time) *Builder  { return b.add(t) }
+func (b *Builder) AddNull() *Builder             { return b.add(nil) }
+
+// BeginArray opens a nested array; elements added until the matching
+// EndArray go into it.
+func (b *Builder) BeginArray() *Builder {
+	b.stack = append(b.stack, DataInput{})
+	return b
+}
+
+// EndArray closes the innermost array opened by BeginArray and adds it to
+// the array enclosing it.
+func (b *Builder) EndArray() *Builder {
+	if len(b.stack) == 1 {
+		if b.err == nil {
+			b.err = fmt.Errorf("Builder: %w: EndArray without BeginArray", ErrUnbalancedArray)
+		}
+		return b
+	}
+	done := b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	return b.add(done)
+}
+
+// Build returns the assembled DataInput. It fails with ErrUnbalancedArray
+// if an array is still open or EndArray was called too often. The result is checked only for
+// structure; limits are enforced when it is encoded. Adding to the Builder
+// afterwards may modify the result.
+func (b *Builder) Build() (DataInput, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.stack) > 1 {
+		return nil, fmt.Errorf("Builder: %w: %d BeginArray without EndArray", ErrUnbalancedArray, len(b.stack)-1)
+	}
+	return b.stack[0], nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuilderMatchesLiteral builds nested messages with every Add method and
+// checks they equal, and encode exactly like, the DataInput literal written
+// by hand.
+func TestBuilderMatchesLiteral(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	tests := []struct {
+		name  string
+		build *Builder
+		want  DataInput
+	}{
+		{"empty", NewBuilder(), DataInput{}},
+		{"every type",
+			NewBuilder().
+				AddString("s").AddBlob([]byte{1, 2}).AddBool(true).
+				AddInt8(-8).AddInt16(-16).AddInt32(-32).AddInt64(-64).
+				AddUint8(8).AddUint16(16).AddUint32(32).AddUint64(64).
+				AddFloat32(0.5).AddFloat64(2.5).AddTime(at).AddNull(),
+			DataInput{"s", []byte{1, 2}, true,
+				int8(-8), int16(-16), int32(-32), int64(-64),
+				uint8(8), uint16(16), uint32(32), uint64(64),
+				float32(0.5), 2.5, at, nil}},
+		{"nested",
+			NewBuilder().
+				AddString("id").AddInt32(123).
+				BeginArray().AddFloat64(3.14).AddBool(true).EndArray().
+				BeginArray().
+				BeginArray().AddString("deep").BeginArray().EndArray().EndArray().
+				AddUint8(1).
+				EndArray().
+				AddNull(),
+			DataInput{"id", int32(123), DataInput{3.14, true}, DataInput{DataInput{"deep", DataInput{}}, uint8(1)}, nil}},
+		{"only arrays",
+			NewBuilder().BeginArray().EndArray().BeginArray().BeginArray().EndArray().EndArray(),
+			DataInput{DataInput{}, DataInput{DataInput{}}}},
+	}
+	for _, tt := range tests {
+		got, err := tt.build.Build()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got == nil || !got.Equal(tt.want) {
+			t.Errorf("%s: built %#v, want %#v", tt.name, got, tt.want)
+		}
+		data, err := encode(got)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want, err := encode(tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: encoded %x, want %x", tt.name, data, want)
+		}
+		if decoded, err := decode(data); err != nil || !decoded.Equal(tt.want) {
+			t.Errorf("%s: decoded %v, %v", tt.name, decoded, err)
+		}
+	}
+}
+
+// TestBuilderTypes checks an untyped constant takes the type of the method
+// it is passed to rather than int.
+func TestBuilderTypes(t *testing.T) {
+	got, err := NewBuilder().AddInt32(123).AddUint16(123).AddFloat32(123).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got[0].(int32); !ok {
+		t.Errorf("AddInt32 added %T", got[0])
+	}
+	if _, ok := got[1].(uint16); !ok {
+		t.Errorf("AddUint16 added %T", got[1])
+	}
+	if _, ok := got[2].(float32); !ok {
+		t.Errorf("AddFloat32 added %T", got[2])
+	}
+}
+
+func TestBuilderUnbalanced(t *testing.T) {
+	tests := []struct {
+		name  string
+		build *Builder
+		want  string // In the error message
+	}{
+		{"EndArray first", NewBuilder().EndArray(), "EndArray without BeginArray"},
+		{"EndArray after a balanced pair", NewBuilder().BeginArray().EndArray().EndArray(), "EndArray without BeginArray"},
+		{"EndArray too often, then balanced", NewBuilder().AddInt32(1).EndArray().BeginArray().EndArray(), "EndArray without BeginArray"},
+		{"one array open", NewBuilder().BeginArray().AddString("x"), "1 BeginArray without EndArray"},
+		{"two arrays open", NewBuilder().BeginArray().BeginArray().EndArray().BeginArray(), "2 BeginArray without EndArray"},
+	}
+	for _, tt := range tests {
+		got, err := tt.build.Build()
+		if !errors.Is(err, ErrUnbalancedArray) {
+			t.Errorf("%s: got %v, %v; want ErrUnbalancedArray", tt.name, got, err)
+			continue
+		}
+		if got != nil {
+			t.Errorf("%s: built %v alongside the error", tt.name, got)
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q does not mention %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Closing the open arrays makes the Builder usable again.
+	b := NewBuilder().BeginArray().AddBool(false)
+	if _, err := b.Build(); !errors.Is(err, ErrUnbalancedArray) {
+		t.Fatalf("open array: got %v, want ErrUnbalancedArray", err)
+	}
+	if got, err := b.EndArray().Build(); err != nil || !got.Equal(DataInput{DataInput{false}}) {
+		t.Errorf("after EndArray: got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+// Bit patterns CanonicalEncode writes for every NaN: the quiet NaNs returned
+// by math.NaN and float32(math.NaN()).
+const (
+	canonicalNaN32 uint32 = 0x7fc00000
+	canonicalNaN64 uint64 = 0x7ff8000000000001
+)
+
+// CanonicalEncode encodes data so that equal inputs always produce
+// byte-identical output, for use as cache keys or content addresses.
+// Unlike encode it ignores the format options in DefaultConfig: output is
+// always the plain Version format, big-endian, with fixed-width int32 and
+// no checksum. Every NaN is written with one bit pattern, while -0.0 and
+// 0.0 stay distinct. Times are stored as instants, so the same instant in
+// different locations encodes identically, and map entries are written in
+// key order.
+//
+// The guarantee covers built-in types only; values handled by RegisterType
+// or RegisterIdentifier are as deterministic as their marshaling code.
+func CanonicalEncode(data DataInput) ([]byte, error) {
+	return EncodeWithConfig(data, Config{
+		MaxArrayLen:  DefaultConfig.MaxArrayLen,
+		MaxStringLen: DefaultConfig.MaxStringLen,
+		MaxBlobLen:   DefaultConfig.MaxBlobLen,
+		MaxMapLen:    DefaultConfig.MaxMapLen,
+		MaxDepth:     DefaultConfig.MaxDepth,
+		MaxBigIntLen: DefaultConfig.MaxBigIntLen,
+		canonical:    true,
+	})
+}
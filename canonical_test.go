@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// canonicalInput covers every built-in type, with maps, float edge cases and
+// a time outside UTC.
+func canonicalInput() DataInput {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	return DataInput{
+		"hello", []byte{0, 1, 2}, nil, true, false,
+		int8(-8), int16(-16), int32(-32), int64(-64), 64,
+		uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64),
+		float32(math.NaN()), math.Copysign(0, -1), math.Inf(1), math.Float64frombits(0x7ff0000000000002),
+		complex(1, -1), Enum8(3), Enum16(-300),
+		new(big.Int).Lsh(big.NewInt(-1), 70), net.ParseIP("2001:db8::1"), net.IPv4(10, 0, 0, 1).To4(),
+		NewDecimal(-12345, 2), time.Date(2024, 2, 29, 9, 30, 0, 5, tokyo),
+		map[string]interface{}{
+			"z": int32(1), "a": DataInput{"x", "y"}, "": nil,
+			"m": map[string]interface{}{"b": 2.5, "a": float32(-0.5)},
+		},
+		DataInput{DataInput{}, map[string]interface{}{}},
+	}
+}
+
+// TestCanonicalGolden pins the exact bytes CanonicalEncode writes for
+// canonicalInput. Run with -update after an intended format change.
+func TestCanonicalGolden(t *testing.T) {
+	got, err := CanonicalEncode(canonicalInput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join("testdata", "canonical.golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(got)+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := hex.DecodeString(strings.TrimSpace(string(golden)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("CanonicalEncode changed:\n got %x\nwant %x", got, want)
+	}
+}
+
+// TestCanonicalStable checks that inputs differing only in ways the
+// guarantee ignores, such as map insertion order, NaN payload and time
+// location, encode identically, and that repeated runs agree.
+func TestCanonicalStable(t *testing.T) {
+	want, err := CanonicalEncode(canonicalInput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		got, err := CanonicalEncode(canonicalInput())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("run %d differs:\n got %x\nwant %x", i, got, want)
+		}
+	}
+
+	at := time.Date(2024, 2, 29, 0, 30, 0, 5, time.UTC)
+	same := []struct {
+		name string
+		a, b DataInput
+	}{
+		{"time location", DataInput{at}, DataInput{at.In(time.FixedZone("X", -3600))}},
+		{"float64 NaN", DataInput{math.NaN()}, DataInput{math.Float64frombits(0xfff0000000000001)}},
+		{"float32 NaN", DataInput{float32(math.NaN())}, DataInput{math.Float32frombits(0xff800001)}},
+	}
+	for i := 0; i < 20; i++ {
+		a, b := make(map[string]interface{}), make(map[string]interface{})
+		for k := 0; k < 50; k++ {
+			a[fmt.Sprint(k)] = int32(k)
+			b[fmt.Sprint(49-k)] = int32(49 - k)
+		}
+		same = append(same, struct {
+			name string
+			a, b DataInput
+		}{"map order", DataInput{a}, DataInput{b}})
+	}
+	for _, tt := range same {
+		a, err := CanonicalEncode(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := CanonicalEncode(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: %x != %x", tt.name, a, b)
+		}
+	}
+
+	zero, _ := CanonicalEncode(DataInput{0.0})
+	negZero, _ := CanonicalEncode(DataInput{math.Copysign(0, -1)})
+	if bytes.Equal(zero, negZero) {
+		t.Error("0.0 and -0.0 encode identically")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const cliUsage = `usage: clickhouse [JSON]          encode a JSON array, from stdin if omitted
+       clickhouse -decode HEX       decode a hex message
+
+Values use the JSON form of DataInput.MarshalJSON, so tagged objects such as
+{"int8": -5} and {"map": {...}} select types JSON lacks.
+`
+
+// main is a roundtrip tool for debugging messages by hand. Given a JSON
+// array it prints the encoded message as hex and the message decoded
+// again; given -decode and a hex message it prints what it decodes to.
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main with its environment as arguments, returning the exit code:
+// 0 on success, 1 if the input cannot be encoded or decoded, and 2 for
+// bad usage.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("clickhouse", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, cliUsage) }
+	hexMsg := fs.String("decode", "", "decode the hex message `HEX`")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+
+	var err error
+	switch {
+	case *hexMsg != "" && fs.NArg() == 0:
+		err = cliDecode(*hexMsg, stdout)
+	case *hexMsg == "" && fs.NArg() <= 1:
+		input := fs.Arg(0)
+		if fs.NArg() == 0 {
+			var b []byte
+			if b, err = io.ReadAll(stdin); err != nil {
+				break
+			}
+			input = string(b)
+		}
+		err = cliEncode(input, stdout)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// cliEncode encodes the JSON array in input and prints the message as hex
+// and the value it decodes back to.
+func cliEncode(input string, w io.Writer) error {
+	var data DataInput
+	if err := data.UnmarshalJSON([]byte(input)); err != nil {
+		return fmt.Errorf("parsing JSON: %w", err)
+	}
+	h, err := EncodeToHex(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "hex (%d bytes): %s\n", len(h)/2, h)
+	return cliDecode(h, w)
+}
+
+// cliDecode decodes the hex message h and prints the result.
+func cliDecode(h string, w io.Writer) error {
+	data, err := DecodeFromHex(strings.TrimSpace(h))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "decoded:", data)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string // Expected stdout, exactly
+		stderr string // Substring expected in stderr
+	}{
+		{
+			name:   "encode argument",
+			args:   []string{`["hello", 42, {"int8": -5}]`},
+			stdout: "hex (21 bytes): 43484449014103530568656c6c6f490000002a63fb\ndecoded: [\"hello\", i32(42), i8(-5)]\n",
+		},
+		{
+			name:   "encode stdin",
+			stdin:  "[true, null]\n",
+			stdout: "hex (10 bytes): 4348444901410242014e\ndecoded: [true, nil]\n",
+		},
+		{
+			name:   "decode",
+			args:   []string{"-decode", "434844490141024e4e"},
+			stdout: "decoded: [nil, nil]\n",
+		},
+		{
+			name:   "decode with surrounding space",
+			args:   []string{"-decode", " 434844490141024e4e\n"},
+			stdout: "decoded: [nil, nil]\n",
+		},
+		{name: "bad hex", args: []string{"-decode", "zz"}, code: 1, stderr: "error:"},
+		{name: "truncated message", args: []string{"-decode", "4348444901410253"}, code: 1, stderr: "error:"},
+		{name: "bad JSON", args: []string{"[1,"}, code: 1, stderr: "parsing JSON"},
+		{name: "JSON not an array", stdin: `{"a": 1}`, code: 1, stderr: "parsing JSON"},
+		{name: "too many arguments", args: []string{"[]", "[]"}, code: 2, stderr: "usage:"},
+		{name: "decode and argument", args: []string{"-decode", "00", "[]"}, code: 2, stderr: "usage:"},
+		{name: "unknown flag", args: []string{"-x"}, code: 2, stderr: "usage:"},
+		{name: "help", args: []string{"-h"}, code: 0, stderr: "usage:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d; stderr: %s", code, tt.code, stderr.String())
+			}
+			if tt.code == 0 && stdout.String() != tt.stdout {
+				t.Errorf("stdout:\n%s\nwant:\n%s", stdout.String(), tt.stdout)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr %q does not contain %q", stderr.String(), tt.stderr)
+			}
+			if tt.code != 0 && tt.stderr != "usage:" && stdout.Len() > 0 {
+				t.Errorf("failed run wrote to stdout: %q", stdout.String())
+			}
+		})
+	}
+}
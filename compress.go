@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression is the codec applied by EncodeCompressedWith. Its value
+// is the flag byte that prefixes the output.
+type Compression byte
+
+// Compression codecs. LZ4 and Snappy bodies are a varint of the
+// decompressed length followed by one block in that format.
+const (
+	CompressNone   Compression = 0 // Body is an uncompressed message
+	CompressGzip   Compression = 1 // Body is a gzip stream
+	CompressLZ4    Compression = 2 // Body is an LZ4 block
+	CompressSnappy Compression = 3 // Body is a Snappy block
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressNone:
+		return "none"
+	case CompressGzip:
+		return "gzip"
+	case CompressLZ4:
+		return "lz4"
+	case CompressSnappy:
+		return "snappy"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+// EncodeCompressed encodes data and gzips the result when that makes it
+// smaller. It is EncodeCompressedWith(data, CompressGzip).
+func EncodeCompressed(data DataInput) ([]byte, error) {
+	return EncodeCompressedWith(data, CompressGzip)
+}
+
+// EncodeCompressedWith encodes data and compresses the result with codec
+// when that makes it smaller. A leading flag byte records which codec was
+// applied, so DecodeCompressed needs no codec argument. LZ4 and Snappy are
+// much faster than gzip for a smaller saving. A message that gzips to less
+// than 1/256 of its size is written with LZ4 instead, since
+// DecodeCompressed rejects such gzip bodies as decompression bombs.
+func EncodeCompressedWith(data DataInput, codec Compression) ([]byte, error) {
+	encoded, err := encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte{byte(codec)}
+	switch codec {
+	case CompressNone:
+		return append(out, encoded...), nil
+	case CompressGzip:
+		zbuf := bytes.NewBuffer(out)
+		zw := gzip.NewWriter(zbuf)
+		if _, err := zw.Write(encoded); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		out = zbuf.Bytes()
+		if len(encoded) > maxCompressionRatio*(len(out)-1) { // DecodeCompressed would take it for a bomb
+			out = appendLZ4([]byte{byte(CompressLZ4)}, encoded)
+		}
+	case CompressLZ4:
+		out = appendLZ4(out, encoded)
+	case CompressSnappy:
+		out = appendSnappy(out, encoded)
+	default:
+		return nil, fmt.Errorf("unknown compression codec: %d", byte(codec))
+	}
+
+	if len(out) < 1+len(encoded) {
+		return out, nil
+	}
+	return append([]byte{byte(CompressNone)}, encoded...), nil // Compression did not help
+}
+
+// DecodeCompressed decodes the output of EncodeCompressed or
+// EncodeCompressedWith, decompressing the body with the codec named by its
+// flag byte. A body that would expand to more than 256 times its size, as
+// only a corrupt or malicious one can, fails with ErrCorruptCompressed
+// before that much memory is allocated.
+func DecodeCompressed(received []byte) (DataInput, error) {
+	if len(received) == 0 {
+		return nil, ErrEmptyInput
+	}
+
+	body := received[1:]
+	var err error
+	switch Compression(received[0]) {
+	case CompressNone:
+	case CompressGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		limit := int64(maxCompressionRatio) * int64(len(body))
+		if body, err = io.ReadAll(io.LimitReader(zr, limit+1)); err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > limit {
+			return nil, fmt.Errorf("%w: gzip body expands past %d bytes", ErrCorruptCompressed, limit)
+		}
+	case CompressLZ4:
+		body, err = readLZ4(body)
+	case CompressSnappy:
+		body, err = readSnappy(body)
+	default:
+		return nil, fmt.Errorf("unknown compression flag: %d", received[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(body)
+}
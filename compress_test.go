@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestCompressedRoundTrip checks compressible and incompressible messages
+// round-trip, that only the former are compressed, and that tiny messages
+// grow by no more than the flag byte.
+func TestCompressedRoundTrip(t *testing.T) {
+	noise := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(noise)
+	var repetitive DataInput
+	for i := 0; i < 500; i++ {
+		repetitive = append(repetitive, "the same string, over and over again")
+	}
+
+	tests := []struct {
+		name string
+		data DataInput
+		flag Compression
+	}{
+		{"compressible", repetitive, CompressGzip},
+		{"incompressible", DataInput{noise}, CompressNone},
+		{"tiny", DataInput{int8(1)}, CompressNone},
+		{"empty", DataInput{}, CompressNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := EncodeCompressed(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if Compression(out[0]) != tt.flag {
+				t.Errorf("flag byte is %v, want %v", Compression(out[0]), tt.flag)
+			}
+			encoded, err := encode(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out) > 1+len(encoded) {
+				t.Errorf("output is %d bytes, more than the %d-byte message plus its flag", len(out), len(encoded))
+			}
+			got, err := DecodeCompressed(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.data) {
+				t.Errorf("got %v, want %v", got, tt.data)
+			}
+		})
+	}
+}
+
+// TestEncodeCompressedWithCodecs round-trips a compressible and an
+// incompressible message through every codec and checks the flag byte
+// names the codec only when it was applied.
+func TestEncodeCompressedWithCodecs(t *testing.T) {
+	noise := make([]byte, 4096)
+	rand.New(rand.NewSource(95)).Read(noise)
+	var repetitive DataInput
+	for i := 0; i < 200; i++ {
+		repetitive = append(repetitive, "the same string, over and over again", int32(i%3))
+	}
+
+	for _, codec := range []Compression{CompressNone, CompressGzip, CompressLZ4, CompressSnappy} {
+		for _, tt := range []struct {
+			name string
+			data DataInput
+			flag Compression
+		}{
+			{"compressible", repetitive, codec},
+			{"incompressible", DataInput{noise}, CompressNone},
+		} {
+			t.Run(codec.String()+"/"+tt.name, func(t *testing.T) {
+				out, err := EncodeCompressedWith(tt.data, codec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if Compression(out[0]) != tt.flag {
+					t.Errorf("flag byte is %v, want %v", Compression(out[0]), tt.flag)
+				}
+				got, err := DecodeCompressed(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.Equal(tt.data) {
+					t.Errorf("got %v, want %v", got, tt.data)
+				}
+			})
+		}
+	}
+
+	if _, err := EncodeCompressedWith(DataInput{}, Compression(9)); err == nil {
+		t.Error("EncodeCompressedWith accepted an unknown codec")
+	}
+	if _, err := DecodeCompressed([]byte{9, 0}); err == nil {
+		t.Error("DecodeCompressed accepted an unknown codec")
+	}
+}
+
+// TestDecodeCompressedGzipBomb feeds a small gzip body that expands to
+// 64 MiB and checks it is rejected without decompressing all of it.
+func TestDecodeCompressedGzipBomb(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(CompressGzip))
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zeros := make([]byte, 1<<20)
+	for i := 0; i < 64; i++ {
+		zw.Write(zeros)
+	}
+	zw.Close()
+	if buf.Len() > 1<<17 {
+		t.Fatalf("bomb is %d bytes, expected it to compress far better", buf.Len())
+	}
+
+	if _, err := DecodeCompressed(buf.Bytes()); !errors.Is(err, ErrCorruptCompressed) {
+		t.Fatalf("got %v, want ErrCorruptCompressed", err)
+	}
+}
+
+// TestEncodeCompressedBeyondRatio checks a message that gzips better than
+// DecodeCompressed accepts is still decodable, by falling back to LZ4.
+func TestEncodeCompressedBeyondRatio(t *testing.T) {
+	data := DataInput{strings.Repeat("a", 900000), strings.Repeat("b", 900000)}
+	out, err := EncodeCompressed(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Compression(out[0]) != CompressLZ4 {
+		t.Errorf("flag byte is %v, want %v", Compression(out[0]), CompressLZ4)
+	}
+	got, err := DecodeCompressed(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(data) {
+		t.Error("round-trip changed the data")
+	}
+}
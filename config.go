@@ -0,0 +1,119 @@
+package main
+
+// Config controls the limits and behavior of encoding and decoding.
+// Zero-valued limits fall back to the corresponding DefaultConfig value.
+type Config struct {
+	MaxArrayLen  int // Maximum number of elements in a single array
+	MaxStringLen int // Maximum length of a single string in bytes
+	MaxBlobLen   int // Maximum length of a single []byte blob
+	MaxMapLen    int // Maximum number of entries in a single map
+	MaxDepth     int // Maximum array and map nesting depth
+	MaxBigIntLen int // Maximum magnitude of a *big.Int in bytes
+	// MaxTotalBytes caps the approximate memory a decoded message may
+	// retain: 16 bytes per element plus string and blob contents. Zero
+	// means no limit.
+	MaxTotalBytes int
+	// MaxElements caps the number of array elements and map entries in a
+	// decoded message, counted across every nesting level, bounding the
+	// number of small allocations as MaxTotalBytes bounds their size.
+	// Zero means no limit.
+	MaxElements int
+	CopyStrings bool // Decode strings and blobs as copies instead of views into the input
+	VarintInts  bool // Encode int32 as a zigzag varint ('i') instead of 4 fixed bytes ('I')
+	Checksum    bool // Append a CRC32-C to each encoded message (format VersionChecksum)
+	// OptimizeIntegers writes each int64 (and int) as a zigzag varint ('l')
+	// when that is shorter than 8 fixed bytes, so small values cost one or
+	// two bytes. They decode as int64 either way.
+	OptimizeIntegers bool
+	// DictStrings stores repeated strings once in a dictionary ahead of the
+	// top-level array and refers to them by index, like ClickHouse's
+	// LowCardinality. Decoding handles dictionaries whatever this is set to.
+	DictStrings bool
+	// DeltaInts writes arrays holding only int32 as zigzag varint
+	// differences between neighbors, shrinking sorted IDs and timestamps.
+	DeltaInts bool
+	// RunLength writes arrays of scalars as (run length, value) pairs when
+	// that is smaller, so long runs of one value cost a few bytes. It
+	// combines with DictStrings.
+	RunLength bool
+	// StringArrays writes arrays holding only strings without a type
+	// identifier per element, saving a byte per string and the type
+	// switch when decoding. Strings in the DictStrings dictionary keep
+	// their array in the plain form.
+	StringArrays bool
+	// Endianness is the byte order of fixed-width integers, floats and
+	// times. It is not recorded in the message, so the decoder must be
+	// given the same setting as the encoder.
+	Endianness Endianness
+	// AllowTrailingData lets decoding ignore bytes after the top-level
+	// array, for buffers where more data follows a message. By default
+	// they are rejected with ErrTrailingData, since they usually mean a
+	// framing bug.
+	AllowTrailingData bool
+	// EnumNames is the name table of a ClickHouse Enum8 or Enum16 type,
+	// mapping each name to its value; values must be distinct. EnumValue
+	// and EnumName look names up in it, and RowBinary Enum columns use it
+	// to accept and return names.
+	EnumNames map[string]int16
+	// StrictFixedStrings makes RowBinary FixedString(N) columns reject
+	// values shorter than N bytes with ErrFixedStringTooShort instead of
+	// padding them with NUL bytes, for columns where padding would hide a
+	// truncated value.
+	StrictFixedStrings bool
+	// StrictFloats makes encoding reject NaN and infinite float32, float64
+	// and complex128 values with ErrNonFiniteFloat, for consumers such as
+	// JSON exports that cannot represent them. Decoding is unaffected.
+	StrictFloats bool
+	// ValidateUTF8 makes encoding and decoding reject strings, including
+	// map keys, that are not valid UTF-8 with ErrInvalidUTF8. Blobs are
+	// never checked. It is off by default since it reads every string byte.
+	ValidateUTF8 bool
+	// NormalizeInts makes decoding return every signed and unsigned
+	// integer, whatever its encoded width, as an int64, for generic code
+	// that would otherwise switch over each width. A uint64 above
+	// math.MaxInt64 fails with ErrIntOutOfRange. Enums, and the slices
+	// returned by DecodeTypedArray, keep their types.
+	NormalizeInts bool
+
+	canonical bool              // Write every NaN with the same bit pattern (CanonicalEncode)
+	dictIndex map[string]uint64 // Dictionary of the message being encoded
+	dict      []string          // Dictionary of the message being decoded
+	dictLen   int               // len(dict), also set when validating without collecting
+	reuse     DataInput         // Result of an earlier decode whose arrays may be reused (DecodeReuse)
+	arena     *StringArena      // Destination of decoded string and blob bytes (DecodeInArena)
+	flat      *[][]byte         // Destination of string and blob payloads met by skipHelper (DecodeFlatStrings)
+}
+
+// DefaultConfig is used by encode, decode and the streaming types unless a
+// Config is supplied explicitly.
+var DefaultConfig = Config{
+	MaxArrayLen:  1000,
+	MaxStringLen: 1000000,
+	MaxBlobLen:   1000000,
+	MaxMapLen:    1000,
+	MaxDepth:     64,
+	MaxBigIntLen: 1024,
+}
+
+// withDefaults returns cfg with unset limits filled in from DefaultConfig.
+func (cfg Config) withDefaults() *Config {
+	if cfg.MaxArrayLen <= 0 {
+		cfg.MaxArrayLen = DefaultConfig.MaxArrayLen
+	}
+	if cfg.MaxStringLen <= 0 {
+		cfg.MaxStringLen = DefaultConfig.MaxStringLen
+	}
+	if cfg.MaxBlobLen <= 0 {
+		cfg.MaxBlobLen = DefaultConfig.MaxBlobLen
+	}
+	if cfg.MaxMapLen <= 0 {
+		cfg.MaxMapLen = DefaultConfig.MaxMapLen
+	}
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = DefaultConfig.MaxDepth
+	}
+	if cfg.MaxBigIntLen <= 0 {
+		cfg.MaxBigIntLen = DefaultConfig.MaxBigIntLen
+	}
+	return &cfg
+}
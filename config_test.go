@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestConfigLimits checks that raising MaxArrayLen and MaxStringLen above
+// the defaults admits larger values on both sides, and that lowering them
+// rejects values the defaults accept.
+func TestConfigLimits(t *testing.T) {
+	longArray := make(DataInput, DefaultConfig.MaxArrayLen+1)
+	for i := range longArray {
+		longArray[i] = int32(i)
+	}
+	longString := DataInput{strings.Repeat("x", DefaultConfig.MaxStringLen+1)}
+
+	tests := []struct {
+		name string
+		in   DataInput
+		cfg  Config
+		want error // From whichever config rejects in
+	}{
+		{"array above default", longArray, Config{MaxArrayLen: len(longArray)}, ErrArrayTooLong},
+		{"string above default", longString, Config{MaxStringLen: len(longString[0].(string))}, ErrStringTooLong},
+		{"array below default", DataInput{int32(1), int32(2), int32(3)}, Config{MaxArrayLen: 2}, ErrArrayTooLong},
+		{"string below default", DataInput{"abc"}, Config{MaxStringLen: 2}, ErrStringTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, defaultErr := encode(tt.in)
+			data, cfgErr := EncodeWithConfig(tt.in, tt.cfg)
+			if (defaultErr == nil) == (cfgErr == nil) {
+				t.Fatalf("default config: %v, custom config: %v; want exactly one to fail", defaultErr, cfgErr)
+			}
+
+			if cfgErr == nil {
+				// Raised limit: the default rejects the input on both sides.
+				if !errors.Is(defaultErr, tt.want) {
+					t.Errorf("encode with the default: got %v, want %v", defaultErr, tt.want)
+				}
+				got, err := DecodeWithConfig(data, tt.cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.Equal(tt.in) {
+					t.Error("decoded value differs from the input")
+				}
+				if _, err := decode(data); !errors.Is(err, tt.want) {
+					t.Errorf("decode with the default: got %v, want %v", err, tt.want)
+				}
+				return
+			}
+
+			// Lowered limit: the custom config rejects the input on both sides.
+			if !errors.Is(cfgErr, tt.want) {
+				t.Errorf("encode with the lowered limit: got %v, want %v", cfgErr, tt.want)
+			}
+			data = roundTrip(t, tt.in)
+			if _, err := DecodeWithConfig(data, tt.cfg); !errors.Is(err, tt.want) {
+				t.Errorf("decode with the lowered limit: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// decodeAll decodes data through an Iterator, returning the first error.
+func decodeAll(data []byte, cfg Config) error {
+	it, err := NewIteratorWithConfig(data, cfg)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := it.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// TestMaxTotalBytes decodes many medium strings, each far under
+// MaxStringLen, that together exceed MaxTotalBytes, both in one decode and
+// through an Iterator, which must not reset the budget per element.
+func TestMaxTotalBytes(t *testing.T) {
+	nested := make(DataInput, 100)
+	flat := make(DataInput, 100)
+	for i := range nested {
+		flat[i] = strings.Repeat("x", 1000)
+		nested[i] = DataInput{flat[i]}
+	}
+	stringArray, err := EncodeWithConfig(flat, Config{StringArrays: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []struct {
+		name string
+		data []byte
+		need int // 1000 bytes per string plus 16 per element
+	}{
+		{"nested", roundTrip(t, nested), 100*1000 + 200*elementSize},
+		{"string array", stringArray, 100*1000 + 100*elementSize},
+	} {
+		for _, tt := range []struct {
+			limit int
+			want  error
+		}{
+			{msg.need, nil},
+			{msg.need - 1, ErrMemoryLimitExceeded},
+			{10000, ErrMemoryLimitExceeded},
+		} {
+			cfg := Config{MaxTotalBytes: tt.limit}
+			if _, err := DecodeWithConfig(msg.data, cfg); !errors.Is(err, tt.want) {
+				t.Errorf("%s: decode with limit %d: got %v, want %v", msg.name, tt.limit, err, tt.want)
+			}
+			if err := decodeAll(msg.data, cfg); !errors.Is(err, tt.want) {
+				t.Errorf("%s: Iterator with limit %d: got %v, want %v", msg.name, tt.limit, err, tt.want)
+			}
+		}
+	}
+}
+
+// TestMaxElements decodes a wide structure of small arrays whose element
+// count across all levels exceeds MaxElements, though no single array
+// comes near MaxArrayLen, in one decode and through an Iterator.
+func TestMaxElements(t *testing.T) {
+	wide := make(DataInput, 50)
+	for i := range wide {
+		wide[i] = DataInput{"a", "b", map[string]interface{}{"k": DataInput{nil}}}
+	}
+	data := roundTrip(t, wide)
+	// 50 top-level elements, each with 3 elements, a map entry and 1 more.
+	const total = 50 * (1 + 3 + 1 + 1)
+
+	var open bytes.Buffer
+	e := NewEncoder(&open)
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range wide {
+		if err := e.WriteElement(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []struct {
+		name string
+		data []byte
+	}{{"counted", data}, {"open", open.Bytes()}} {
+		for _, tt := range []struct {
+			limit int
+			want  error
+		}{
+			{total, nil},
+			{total - 1, ErrTooManyElements},
+			{100, ErrTooManyElements},
+		} {
+			cfg := Config{MaxElements: tt.limit}
+			if _, err := DecodeWithConfig(msg.data, cfg); !errors.Is(err, tt.want) {
+				t.Errorf("%s: decode with limit %d: got %v, want %v", msg.name, tt.limit, err, tt.want)
+			}
+			if err := decodeAll(msg.data, cfg); !errors.Is(err, tt.want) {
+				t.Errorf("%s: Iterator with limit %d: got %v, want %v", msg.name, tt.limit, err, tt.want)
+			}
+		}
+	}
+
+	_, err := DecodeWithConfig(data, Config{MaxElements: 100})
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != 100 {
+		t.Errorf("got %v, want a LimitError with Limit 100", err)
+	}
+}
+
+func TestStrictFloats(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	strict := Config{StrictFloats: true}
+	rejected := []DataInput{
+		{nan},
+		{inf},
+		{-inf},
+		{float32(nan)},
+		{float32(-inf)},
+		{complex(nan, 0)},
+		{complex(0, inf)},
+		{"ok", DataInput{1.5, DataInput{nan}}},
+		{map[string]interface{}{"k": inf}},
+	}
+	for _, in := range rejected {
+		if _, err := EncodeWithConfig(in, strict); !errors.Is(err, ErrNonFiniteFloat) {
+			t.Errorf("strict %v: got %v, want ErrNonFiniteFloat", in, err)
+		}
+		if _, err := NewEncoderWithConfig(io.Discard, strict).EncodeBytes(in); !errors.Is(err, ErrNonFiniteFloat) {
+			t.Errorf("strict Encoder %v: got %v, want ErrNonFiniteFloat", in, err)
+		}
+		// The default is permissive.
+		data, err := encode(in)
+		if err != nil {
+			t.Errorf("default %v: %v", in, err)
+			continue
+		}
+		// Decoding is unaffected by the option.
+		if _, err := DecodeWithConfig(data, strict); err != nil {
+			t.Errorf("strict decode of %v: %v", in, err)
+		}
+	}
+
+	finite := DataInput{0.0, math.MaxFloat64, -math.SmallestNonzeroFloat64, float32(-1), complex(1, -1)}
+	if _, err := EncodeWithConfig(finite, strict); err != nil {
+		t.Errorf("strict finite values: %v", err)
+	}
+}
+
+func TestValidateUTF8(t *testing.T) {
+	const bad = "ok\xff" // 0xff never appears in UTF-8
+	validating := Config{ValidateUTF8: true}
+	tests := []struct {
+		name string
+		in   DataInput
+		cfg  Config // Encoding options, to reach each string form
+	}{
+		{"string", DataInput{bad}, Config{}},
+		{"nested string", DataInput{int32(1), DataInput{"fine", bad}}, Config{}},
+		{"map key", DataInput{map[string]interface{}{bad: int32(1)}}, Config{}},
+		{"map value", DataInput{map[string]interface{}{"k": bad}}, Config{}},
+		{"string array", DataInput{"a", bad, "c"}, Config{StringArrays: true}},
+		{"dictionary", DataInput{bad, bad}, Config{DictStrings: true}},
+		{"truncated sequence", DataInput{"\xe2\x82"}, Config{}},
+		{"surrogate", DataInput{"\xed\xa0\x80"}, Config{}},
+	}
+	for _, tt := range tests {
+		enc := tt.cfg
+		enc.ValidateUTF8 = true
+		if _, err := EncodeWithConfig(tt.in, enc); !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("%s: encode got %v, want ErrInvalidUTF8", tt.name, err)
+		}
+
+		data, err := EncodeWithConfig(tt.in, tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, err := DecodeWithConfig(data, tt.cfg); err != nil {
+			t.Errorf("%s: decode without validation: %v", tt.name, err)
+		}
+		if _, err := DecodeWithConfig(data, validating); !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("%s: decode got %v, want ErrInvalidUTF8", tt.name, err)
+		}
+		if _, err := NewDecoderWithConfig(bytes.NewReader(data), validating).Decode(); !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("%s: Decoder got %v, want ErrInvalidUTF8", tt.name, err)
+		}
+	}
+
+	// Valid text, including multi-byte runes, and blobs of any bytes pass.
+	good := DataInput{"", "héllo", "日本語", "🙂", []byte(bad), map[string]interface{}{"ключ": "значение"}}
+	data, err := EncodeWithConfig(good, validating)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecodeWithConfig(data, validating); err != nil || !got.Equal(good) {
+		t.Errorf("valid UTF-8: got %v, %v", got, err)
+	}
+}
+
+func TestNormalizeInts(t *testing.T) {
+	normalize := Config{NormalizeInts: true}
+	tests := []struct {
+		name string
+		in   DataInput
+		want DataInput
+		cfg  Config // Encoding options, to reach each integer form
+	}{
+		{"every width",
+			DataInput{int8(-8), int16(-16), int32(-32), int64(-64), uint8(8), uint16(16), uint32(32), uint64(64)},
+			DataInput{int64(-8), int64(-16), int64(-32), int64(-64), int64(8), int64(16), int64(32), int64(64)},
+			Config{}},
+		{"limits",
+			DataInput{int8(math.MinInt8), uint32(math.MaxUint32), uint64(math.MaxInt64), int64(math.MinInt64)},
+			DataInput{int64(math.MinInt8), int64(math.MaxUint32), int64(math.MaxInt64), int64(math.MinInt64)},
+			Config{}},
+		{"nested and in maps",
+			DataInput{"s", DataInput{uint16(1), DataInput{int8(2)}}, map[string]interface{}{"k": uint32(3)}, 1.5},
+			DataInput{"s", DataInput{int64(1), DataInput{int64(2)}}, map[string]interface{}{"k": int64(3)}, 1.5},
+			Config{}},
+		{"varint",
+			DataInput{int32(-300), int64(1 << 40)},
+			DataInput{int64(-300), int64(1 << 40)},
+			Config{VarintInts: true}},
+		{"delta array",
+			DataInput{DataInput{int32(10), int32(11), int32(9)}},
+			DataInput{DataInput{int64(10), int64(11), int64(9)}},
+			Config{DeltaInts: true}},
+		{"run array",
+			DataInput{DataInput{uint8(1), uint8(1), uint8(1), int16(2)}},
+			DataInput{DataInput{int64(1), int64(1), int64(1), int64(2)}},
+			Config{RunLength: true}},
+		{"enums keep their types",
+			DataInput{Enum8(1), Enum16(-2)},
+			DataInput{Enum8(1), Enum16(-2)},
+			Config{}},
+	}
+	for _, tt := range tests {
+		data, err := EncodeWithConfig(tt.in, tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		// Off by default: every width comes back as written.
+		if got, err := decode(data); err != nil {
+			t.Errorf("%s: default decode: %v", tt.name, err)
+		} else if !got.Equal(tt.in) {
+			t.Errorf("%s: default decode got %#v, want %#v", tt.name, got, tt.in)
+		}
+
+		got, err := DecodeWithConfig(data, normalize)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: got %#v, %v; want %#v", tt.name, got, err, tt.want)
+		}
+		got, err = NewDecoderWithConfig(bytes.NewReader(data), normalize).Decode()
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: Decoder got %#v, %v; want %#v", tt.name, got, err, tt.want)
+		}
+	}
+
+	// The iterator normalizes elements, delta-encoded ones included.
+	for _, cfg := range []Config{{}, {DeltaInts: true}} {
+		data, err := EncodeWithConfig(DataInput{int32(5), int32(-5)}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it, err := NewIteratorWithConfig(data, normalize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []int64{5, -5} {
+			if v, err := it.Next(); err != nil || v != want {
+				t.Errorf("iterator with %+v: got %#v, %v; want int64 %d", cfg, v, err, want)
+			}
+		}
+	}
+
+	data, err := encode(DataInput{uint64(math.MaxInt64) + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeWithConfig(data, normalize); !errors.Is(err, ErrIntOutOfRange) {
+		t.Errorf("uint64 above MaxInt64: got %v, want ErrIntOutOfRange", err)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Equal reports whether d and other hold the same elements with the same Go
+// types, recursing into nested arrays and maps. Floats are compared bit-for-bit, so a
+// NaN equals a NaN with the same bit pattern while 0.0 and -0.0 differ.
+// Times are compared as instants, matching what survives a round-trip.
+func (d DataInput) Equal(other DataInput) bool {
+	if len(d) != len(other) {
+		return false
+	}
+	for i := range d {
+		if !equalValue(d[i], other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValue compares two elements of a DataInput.
+func equalValue(a, b interface{}) bool {
+	switch a := a.(type) {
+	case DataInput:
+		b, ok := b.(DataInput)
+		return ok && a.Equal(b)
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := b[k]
+			if !ok || !equalValue(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []byte:
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	case float32:
+		b, ok := b.(float32)
+		return ok && math.Float32bits(a) == math.Float32bits(b)
+	case float64:
+		b, ok := b.(float64)
+		return ok && math.Float64bits(a) == math.Float64bits(b)
+	case complex128:
+		b, ok := b.(complex128)
+		return ok && math.Float64bits(real(a)) == math.Float64bits(real(b)) &&
+			math.Float64bits(imag(a)) == math.Float64bits(imag(b))
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	case *big.Int:
+		b, ok := b.(*big.Int)
+		return ok && (a == b || a != nil && b != nil && a.Cmp(b) == 0)
+	case net.IP:
+		b, ok := b.(net.IP)
+		return ok && a.Equal(b)
+	case Decimal:
+		b, ok := b.(Decimal)
+		return ok && a.Equal(b)
+	default:
+		return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.DeepEqual(a, b)
+	}
+}
+
+// DeepCopy returns a copy of d that shares no memory with it: nested arrays
+// and maps are cloned recursively and string and []byte contents are copied into
+// fresh allocations. Scalars are copied by value.
+func (d DataInput) DeepCopy() DataInput {
+	if d == nil {
+		return nil
+	}
+	out := make(DataInput, len(d))
+	for i, v := range d {
+		out[i] = copyValue(v)
+	}
+	return out
+}
+
+// Clone returns a deep copy of d without going through the wire format, so
+// it also works for values encode would reject, such as over-limit arrays.
+// It is the same as DeepCopy: nested arrays and maps are cloned and string
+// and []byte contents copied, while scalars are copied by value. Values of
+// registered custom types are copied as they are, so any pointers inside
+// them are shared. For a shallow copy that shares nested arrays, use
+// append(DataInput(nil), d...).
+func (d DataInput) Clone() DataInput {
+	return d.DeepCopy()
+}
+
+// copyValue returns a copy of a single element for DeepCopy.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case DataInput:
+		return v.DeepCopy()
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[strings.Clone(k)] = copyValue(e)
+		}
+		return m
+	case string:
+		return strings.Clone(v)
+	case *big.Int:
+		if v != nil {
+			return new(big.Int).Set(v)
+		}
+	case net.IP:
+		if v != nil {
+			return append(make(net.IP, 0, len(v)), v...)
+		}
+	case Decimal:
+		if v.Unscaled != nil {
+			v.Unscaled = new(big.Int).Set(v.Unscaled)
+		}
+		return v
+	case []byte:
+		if v != nil {
+			return append(make([]byte, 0, len(v)), v...)
+		}
+	}
+	return v
+}
+
+// StringAt returns the string at index i.
+func (d DataInput) StringAt(i int) (string, error) {
+	return elementAt[string](d, i)
+}
+
+// BytesAt returns the []byte blob at index i.
+func (d DataInput) BytesAt(i int) ([]byte, error) {
+	return elementAt[[]byte](d, i)
+}
+
+// Int32At returns the int32 at index i.
+func (d DataInput) Int32At(i int) (int32, error) {
+	return elementAt[int32](d, i)
+}
+
+// Int64At returns the int64 at index i.
+func (d DataInput) Int64At(i int) (int64, error) {
+	return elementAt[int64](d, i)
+}
+
+// Float64At returns the float64 at index i.
+func (d DataInput) Float64At(i int) (float64, error) {
+	return elementAt[float64](d, i)
+}
+
+// BoolAt returns the bool at index i.
+func (d DataInput) BoolAt(i int) (bool, error) {
+	return elementAt[bool](d, i)
+}
+
+// ArrayAt returns the nested DataInput at index i.
+func (d DataInput) ArrayAt(i int) (DataInput, error) {
+	return elementAt[DataInput](d, i)
+}
+
+// elementAt bounds-checks i and asserts the element there has type T.
+func elementAt[T any](d DataInput, i int) (T, error) {
+	var zero T
+	if i < 0 || i >= len(d) {
+		return zero, fmt.Errorf("%w: %d not in [0,%d)", ErrIndexOutOfRange, i, len(d))
+	}
+	v, ok := d[i].(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: element %d is %T, not %T", ErrTypeMismatch, i, d[i], zero)
+	}
+	return v, nil
+}
+
+// Walk visits every element of d depth-first, calling fn with the element's
+// index path and value. A nested DataInput or map[string]interface{} is
+// passed to fn before its own elements are visited. Map values are visited
+// in key order, and their index in the path is their position in that
+// order, as in DecodeError.Path. The path slice is reused between calls and
+// must be copied if retained. If fn returns an error, the walk stops and
+// Walk returns it.
+func Walk(d DataInput, fn func(path []int, value interface{}) error) error {
+	return walk(d, make([]int, 0, 8), fn)
+}
+
+// walk visits the elements of d beneath path.
+func walk(d DataInput, path []int, fn func(path []int, value interface{}) error) error {
+	for i, v := range d {
+		if err := walkValue(v, append(path, i), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkValue visits v at path and then anything nested in it.
+func walkValue(v interface{}, path []int, fn func(path []int, value interface{}) error) error {
+	if err := fn(path, v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case DataInput:
+		return walk(v, path, fn)
+	case map[string]interface{}:
+		for i, k := range sortedKeys(v) {
+			if err := walkValue(v[k], append(path, i), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// String renders d compactly with type annotations, for example
+// ["hello", ["world", i32(123)], f64(3.14)].
+func (d DataInput) String() string {
+	var sb strings.Builder
+	writeDataInput(&sb, d)
+	return sb.String()
+}
+
+// writeDataInput writes the String form of d to sb.
+func writeDataInput(sb *strings.Builder, d DataInput) {
+	sb.WriteByte('[')
+	for i, v := range d {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		writeValue(sb, v)
+	}
+	sb.WriteByte(']')
+}
+
+// writeMap writes m to sb as {"key": value, ...} in key order.
+func writeMap(sb *strings.Builder, m map[string]interface{}) {
+	sb.WriteByte('{')
+	for i, k := range sortedKeys(m) {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(strconv.Quote(k) + ": ")
+		writeValue(sb, m[k])
+	}
+	sb.WriteByte('}')
+}
+
+// writeValue writes the String form of a single element to sb.
+func writeValue(sb *strings.Builder, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		sb.WriteString("nil")
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case string:
+		sb.WriteString(strconv.Quote(v))
+	case []byte:
+		sb.WriteString("bytes(" + hex.EncodeToString(v) + ")")
+	case int8:
+		sb.WriteString("i8(" + strconv.FormatInt(int64(v), 10) + ")")
+	case int16:
+		sb.WriteString("i16(" + strconv.FormatInt(int64(v), 10) + ")")
+	case Enum8:
+		sb.WriteString("enum8(" + strconv.FormatInt(int64(v), 10) + ")")
+	case Enum16:
+		sb.WriteString("enum16(" + strconv.FormatInt(int64(v), 10) + ")")
+	case int32:
+		sb.WriteString("i32(" + strconv.FormatInt(int64(v), 10) + ")")
+	case int64:
+		sb.WriteString("i64(" + strconv.FormatInt(v, 10) + ")")
+	case uint8:
+		sb.WriteString("u8(" + strconv.FormatUint(uint64(v), 10) + ")")
+	case uint16:
+		sb.WriteString("u16(" + strconv.FormatUint(uint64(v), 10) + ")")
+	case uint32:
+		sb.WriteString("u32(" + strconv.FormatUint(uint64(v), 10) + ")")
+	case uint64:
+		sb.WriteString("u64(" + strconv.FormatUint(v, 10) + ")")
+	case float32:
+		sb.WriteString("f32(" + strconv.FormatFloat(float64(v), 'g', -1, 32) + ")")
+	case float64:
+		sb.WriteString("f64(" + strconv.FormatFloat(v, 'g', -1, 64) + ")")
+	case complex128:
+		sb.WriteString("c128" + strconv.FormatComplex(v, 'g', -1, 128))
+	case time.Time:
+		sb.WriteString("time(" + v.Format(time.RFC3339Nano) + ")")
+	case *big.Int:
+		sb.WriteString("bigint(" + v.String() + ")")
+	case net.IP:
+		sb.WriteString("ip(" + v.String() + ")")
+	case Decimal:
+		sb.WriteString("dec(" + v.String() + ")")
+	case DataInput:
+		writeDataInput(sb, v)
+	case map[string]interface{}:
+		writeMap(sb, v)
+	default:
+		fmt.Fprintf(sb, "%T(%v)", v, v)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWalk(t *testing.T) {
+	d := DataInput{
+		"a",
+		DataInput{int32(1), map[string]interface{}{"y": "v", "x": DataInput{true}}},
+		map[string]interface{}{},
+	}
+	var got []string
+	err := Walk(d, func(path []int, v interface{}) error {
+		got = append(got, fmt.Sprintf("%v %T", path, v))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"[0] string",
+		"[1] main.DataInput",
+		"[1 0] int32",
+		"[1 1] map[string]interface {}",
+		"[1 1 0] main.DataInput", // "x" sorts first
+		"[1 1 0 0] bool",
+		"[1 1 1] string",
+		"[2] map[string]interface {}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("visited\n%q\nwant\n%q", got, want)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = Walk(d, func(path []int, v interface{}) error {
+		if n++; len(path) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 5 {
+		t.Errorf("got %v after %d calls, want stop after 5", err, n)
+	}
+}
+
+// TestWalkMatchesDecodeErrorPath checks a map entry's Walk path is the
+// path a DecodeError reports for it.
+func TestWalkMatchesDecodeErrorPath(t *testing.T) {
+	d := DataInput{map[string]interface{}{"b": "bad", "a": int32(0)}}
+	data, err := encode(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []int
+	Walk(d, func(path []int, v interface{}) error {
+		if v == "bad" {
+			want = append([]int(nil), path...)
+		}
+		return nil
+	})
+	// Replace the identifier of "bad" with an unknown one.
+	data[bytes.LastIndex(data, []byte("bad"))-2] = 0x01
+	_, err = decode(data)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("got %v, want a DecodeError", err)
+	}
+	if !reflect.DeepEqual(de.Path, want) {
+		t.Errorf("DecodeError.Path = %v, Walk path = %v", de.Path, want)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	nested := func(leaf interface{}) DataInput {
+		d := DataInput{leaf}
+		for i := 0; i < 50; i++ {
+			d = DataInput{"level", d}
+		}
+		return d
+	}
+	nan := math.NaN()
+	otherNaN := math.Float64frombits(math.Float64bits(nan) ^ 1)
+
+	tests := []struct {
+		name string
+		a, b DataInput
+		want bool
+	}{
+		{"empty", DataInput{}, nil, true},
+		{"deep nesting", nested(int32(1)), nested(int32(1)), true},
+		{"deep leaf differs", nested(int32(1)), nested(int32(2)), false},
+		{"deep leaf type differs", nested(int32(1)), nested(int64(1)), false},
+		{"int32 and int", DataInput{int32(1)}, DataInput{1}, false},
+		{"float32 and float64", DataInput{float32(1)}, DataInput{1.0}, false},
+		{"string and blob", DataInput{"a"}, DataInput{[]byte("a")}, false},
+		{"array and map", DataInput{DataInput{}}, DataInput{map[string]interface{}{}}, false},
+		{"length", DataInput{int32(1)}, DataInput{int32(1), nil}, false},
+		{"same NaN", DataInput{nan}, DataInput{nan}, true},
+		{"different NaN bits", DataInput{nan}, DataInput{otherNaN}, false},
+		{"float32 NaN", DataInput{float32(nan)}, DataInput{float32(nan)}, true},
+		{"signed zeros", DataInput{0.0}, DataInput{math.Copysign(0, -1)}, false},
+		{"maps", DataInput{map[string]interface{}{"k": DataInput{nan}}}, DataInput{map[string]interface{}{"k": DataInput{nan}}}, true},
+		{"map values", DataInput{map[string]interface{}{"k": int32(1)}}, DataInput{map[string]interface{}{"k": int32(2)}}, false},
+		{"map keys", DataInput{map[string]interface{}{"k": nil}}, DataInput{map[string]interface{}{"j": nil}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.want {
+				t.Errorf("a.Equal(b) = %t, want %t", got, tt.want)
+			}
+			if got := tt.b.Equal(tt.a); got != tt.want {
+				t.Errorf("b.Equal(a) = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeepCopy copies a decoded value, then mutates both the input buffer
+// its strings alias and the original's nested arrays, maps, blobs and
+// big.Ints, and checks the copy is untouched.
+func TestDeepCopy(t *testing.T) {
+	in := DataInput{
+		"aliased",
+		[]byte{1, 2, 3},
+		DataInput{"nested", DataInput{int32(1)}},
+		map[string]interface{}{"key": "value"},
+		big.NewInt(7),
+		Decimal{Unscaled: big.NewInt(12345), Scale: 2},
+		net.IPv4(10, 0, 0, 1).To4(),
+	}
+	data, err := encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := orig.DeepCopy()
+
+	for i := headerLen; i < len(data); i++ {
+		data[i] = 'z'
+	}
+	orig[1].([]byte)[0] = 9
+	orig[2].(DataInput)[0] = "changed"
+	orig[2].(DataInput)[1].(DataInput)[0] = int32(2)
+	orig[3].(map[string]interface{})["key"] = "changed"
+	orig[4].(*big.Int).SetInt64(8)
+	orig[5].(Decimal).Unscaled.SetInt64(0)
+	orig[6].(net.IP)[0] = 99
+
+	if !cp.Equal(in) {
+		t.Errorf("copy changed with the original:\n got %v\nwant %v", cp, in)
+	}
+	if DataInput(nil).DeepCopy() != nil {
+		t.Error("DeepCopy of nil is not nil")
+	}
+}
+
+// TestClone mutates the original after cloning, including a value encode
+// would reject, and checks the clone is independent where a shallow copy
+// is not.
+func TestClone(t *testing.T) {
+	over := make(DataInput, DefaultConfig.MaxArrayLen+1)
+	for i := range over {
+		over[i] = int32(i)
+	}
+	orig := DataInput{"s", []byte{1, 2}, DataInput{"nested"}, map[string]interface{}{"k": []byte{3}}, over, int64(5)}
+	if _, err := encode(orig); !errors.Is(err, ErrArrayTooLong) {
+		t.Fatalf("encode: got %v, want ErrArrayTooLong", err)
+	}
+	want := DataInput{"s", []byte{1, 2}, DataInput{"nested"}, map[string]interface{}{"k": []byte{3}}, append(DataInput(nil), over...), int64(5)}
+	cp := orig.Clone()
+	shallow := append(DataInput(nil), orig...)
+
+	orig[0] = "changed"
+	orig[1].([]byte)[0] = 9
+	orig[2].(DataInput)[0] = "changed"
+	orig[3].(map[string]interface{})["k"].([]byte)[0] = 9
+	orig[4].(DataInput)[0] = "changed"
+	orig[5] = int64(6)
+
+	if !cp.Equal(want) {
+		t.Errorf("clone changed with the original")
+	}
+	if shallow[2].(DataInput)[0] != "changed" {
+		t.Error("shallow copy does not share nested arrays")
+	}
+	if shallow[0] != "s" || shallow[5] != int64(5) {
+		t.Error("shallow copy shares top-level elements")
+	}
+	if DataInput(nil).Clone() != nil {
+		t.Error("Clone of nil is not nil")
+	}
+	if c := (DataInput{}).Clone(); c == nil || len(c) != 0 {
+		t.Errorf("Clone of DataInput{} = %#v", c)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	d := DataInput{"s", []byte{1}, int32(2), int64(3), 4.5, true, DataInput{"inner"}, nil}
+
+	if v, err := d.StringAt(0); err != nil || v != "s" {
+		t.Errorf("StringAt(0) = %q, %v", v, err)
+	}
+	if v, err := d.BytesAt(1); err != nil || !bytes.Equal(v, []byte{1}) {
+		t.Errorf("BytesAt(1) = %x, %v", v, err)
+	}
+	if v, err := d.Int32At(2); err != nil || v != 2 {
+		t.Errorf("Int32At(2) = %d, %v", v, err)
+	}
+	if v, err := d.Int64At(3); err != nil || v != 3 {
+		t.Errorf("Int64At(3) = %d, %v", v, err)
+	}
+	if v, err := d.Float64At(4); err != nil || v != 4.5 {
+		t.Errorf("Float64At(4) = %v, %v", v, err)
+	}
+	if v, err := d.BoolAt(5); err != nil || !v {
+		t.Errorf("BoolAt(5) = %t, %v", v, err)
+	}
+	if v, err := d.ArrayAt(6); err != nil || !v.Equal(DataInput{"inner"}) {
+		t.Errorf("ArrayAt(6) = %v, %v", v, err)
+	}
+
+	for i, err := range []error{
+		second(d.StringAt(1)),
+		second(d.BytesAt(0)),
+		second(d.Int32At(3)),
+		second(d.Int64At(2)),
+		second(d.Float64At(2)),
+		second(d.BoolAt(7)),
+		second(d.ArrayAt(0)),
+	} {
+		if !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("wrong type %d: got %v, want ErrTypeMismatch", i, err)
+		}
+	}
+
+	for _, i := range []int{-1, len(d), len(d) + 100} {
+		if _, err := d.StringAt(i); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("StringAt(%d): got %v, want ErrIndexOutOfRange", i, err)
+		}
+	}
+	if _, err := DataInput(nil).Int32At(0); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("Int32At(0) of nil: got %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+// second returns the error of a two-result call.
+func second[T any](_ T, err error) error { return err }
+
+func TestString(t *testing.T) {
+	d := DataInput{
+		"hello",
+		DataInput{"world", int32(123), DataInput{}},
+		3.14,
+		nil, true, []byte{0xca, 0xfe},
+		int8(-1), int16(2), int64(-3), uint8(4), uint16(5), uint32(6), uint64(7),
+		float32(0.5), complex(1, -2), Enum8(1), Enum16(2),
+		time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		big.NewInt(-9), net.IPv4(10, 0, 0, 1).To4(), Decimal{Unscaled: big.NewInt(-12345), Scale: 2},
+		map[string]interface{}{"b": "x", "a": DataInput{int32(1)}},
+	}
+	want := `["hello", ["world", i32(123), []], f64(3.14), nil, true, bytes(cafe), ` +
+		`i8(-1), i16(2), i64(-3), u8(4), u16(5), u32(6), u64(7), f32(0.5), c128(1-2i), enum8(1), enum16(2), ` +
+		`time(2024-01-02T03:04:05.000000006Z), bigint(-9), ip(10.0.0.1), dec(-123.45), {"a": [i32(1)], "b": "x"}]`
+	if got := d.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if got := fmt.Sprint(DataInput{"a"}); got != `["a"]` {
+		t.Errorf("fmt.Sprint = %s, want the String form", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact fixed-point number with the value
+// Unscaled × 10^-Scale, matching ClickHouse's Decimal types. Unscaled may
+// be wider than 64 bits, so Decimal128 and Decimal256 values fit too; a nil
+// Unscaled is zero. Decimals with the same value but different scales, such
+// as 1.5 and 1.50, are distinct.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    uint8
+}
+
+// NewDecimal returns the decimal unscaled × 10^-scale.
+func NewDecimal(unscaled int64, scale uint8) Decimal {
+	return Decimal{Unscaled: big.NewInt(unscaled), Scale: scale}
+}
+
+// ParseDecimal parses a decimal such as "-123.456", keeping as many
+// fractional digits as are written as its Scale.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole+frac == "" || len(frac) > 255 || strings.ContainsAny(whole+frac, "+-_") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	u, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if strings.HasPrefix(s, "-") {
+		u.Neg(u)
+	}
+	return Decimal{Unscaled: u, Scale: uint8(len(frac))}, nil
+}
+
+// String formats d with exactly Scale fractional digits, such as "0.01".
+func (d Decimal) String() string {
+	u := d.unscaled()
+	digits := new(big.Int).Abs(u).String()
+	if n := int(d.Scale) + 1 - len(digits); n > 0 {
+		digits = strings.Repeat("0", n) + digits
+	}
+	sign := ""
+	if u.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale == 0 {
+		return sign + digits
+	}
+	point := len(digits) - int(d.Scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Equal reports whether d and other have the same unscaled value and scale.
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Scale == other.Scale && d.unscaled().Cmp(other.unscaled()) == 0
+}
+
+// unscaled returns d.Unscaled, with nil read as zero.
+func (d Decimal) unscaled() *big.Int {
+	if d.Unscaled == nil {
+		return new(big.Int)
+	}
+	return d.Unscaled
+}
+
+// mantissaLen returns the length of the shortest big-endian two's
+// complement form of u, zero for zero.
+func mantissaLen(u *big.Int) int {
+	switch u.Sign() {
+	case 0:
+		return 0
+	case 1:
+		return u.BitLen()/8 + 1
+	}
+	return new(big.Int).Not(u).BitLen()/8 + 1 // ^u is -u-1, the largest magnitude of the same width
+}
+
+// appendDecimal writes d as 'Q', the scale byte, and the unscaled value as a
+// varint length and the shortest big-endian two's complement bytes.
+func appendDecimal(buf []byte, d Decimal, cfg *Config) ([]byte, error) {
+	u := d.unscaled()
+	n := mantissaLen(u)
+	if n > cfg.MaxBigIntLen {
+		return nil, limitError(ErrBigIntTooLong, cfg.MaxBigIntLen, uint64(n))
+	}
+	buf = append(buf, byte(TypeDecimal), d.Scale)
+	buf = appendVarint(buf, uint64(n))
+	start := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	if u.Sign() < 0 {
+		// 2^(8n) + u is the two's complement bit pattern.
+		u = new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(8*n)), u)
+	}
+	u.FillBytes(buf[start:])
+	return buf, nil
+}
+
+// decimalSize returns the number of bytes appendDecimal writes for d.
+func decimalSize(d Decimal, cfg *Config) (int, error) {
+	n := mantissaLen(d.unscaled())
+	if n > cfg.MaxBigIntLen {
+		return 0, limitError(ErrBigIntTooLong, cfg.MaxBigIntLen, uint64(n))
+	}
+	return 2 + varintLen(uint64(n)) + n, nil
+}
+
+// readDecimal reads the scale and mantissa bytes of a decimal whose
+// identifier has already been consumed. The mantissa is a view into data.
+// Mantissas longer than their shortest form are rejected with
+// ErrInvalidBigInt, so every value has exactly one encoding.
+func readDecimal(data []byte, pos *int, cfg *Config) (uint8, []byte, error) {
+	if err := need(data, *pos, 1, "decimal"); err != nil {
+		return 0, nil, err
+	}
+	scale := data[*pos]
+	*pos++
+
+	n, err := readLength(data, pos, cfg.MaxBigIntLen, ErrBigIntTooLong, "decimal")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	m := data[*pos : *pos+n]
+	switch {
+	case n == 1 && m[0] == 0,
+		n > 1 && m[0] == 0x00 && m[1]&0x80 == 0,
+		n > 1 && m[0] == 0xff && m[1]&0x80 != 0:
+		return 0, nil, fmt.Errorf("%w: padded decimal mantissa", ErrInvalidBigInt)
+	}
+	*pos += n
+	return scale, m, nil
+}
+
+// decodeDecimal decodes a decimal whose identifier has already been
+// consumed.
+func decodeDecimal(data []byte, pos *int, cfg *Config) (Decimal, error) {
+	scale, m, err := readDecimal(data, pos, cfg)
+	if err != nil {
+		return Decimal{}, err
+	}
+	u := new(big.Int).SetBytes(m)
+	if len(m) > 0 && m[0]&0x80 != 0 {
+		u.Sub(u, new(big.Int).Lsh(big.NewInt(1), uint(8*len(m))))
+	}
+	return Decimal{Unscaled: u, Scale: scale}, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestDecimalRoundTrip(t *testing.T) {
+	wide, _ := new(big.Int).SetString("-123456789012345678901234567890", 10) // Needs more than int64
+	tests := []struct {
+		d       Decimal
+		str     string
+		payload []byte // Scale, length and mantissa; nil to skip
+	}{
+		{NewDecimal(1, 2), "0.01", []byte{2, 1, 0x01}},
+		{NewDecimal(-123456, 3), "-123.456", []byte{3, 3, 0xfe, 0x1d, 0xc0}},
+		{NewDecimal(0, 4), "0.0000", []byte{4, 0}},
+		{Decimal{Scale: 1}, "0.0", []byte{1, 0}},
+		{NewDecimal(127, 0), "127", []byte{0, 1, 0x7f}},
+		{NewDecimal(128, 0), "128", []byte{0, 2, 0x00, 0x80}},
+		{NewDecimal(-128, 0), "-128", []byte{0, 1, 0x80}},
+		{NewDecimal(-129, 0), "-129", []byte{0, 2, 0xff, 0x7f}},
+		{Decimal{Unscaled: wide, Scale: 10}, "-12345678901234567890.1234567890", nil},
+	}
+	for _, tt := range tests {
+		if s := tt.d.String(); s != tt.str {
+			t.Errorf("String() = %q, want %q", s, tt.str)
+		}
+		data, err := encode(DataInput{tt.d})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.str, err)
+		}
+		if tt.payload != nil && !bytes.Equal(data[headerLen+3:], tt.payload) {
+			t.Errorf("%s: payload %x, want %x", tt.str, data[headerLen+3:], tt.payload)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.str, err)
+		}
+		if d, ok := got[0].(Decimal); !ok || !d.Equal(tt.d) {
+			t.Errorf("%s: decoded %v", tt.str, got[0])
+		}
+		parsed, err := ParseDecimal(tt.str)
+		if err != nil || !parsed.Equal(tt.d) {
+			t.Errorf("ParseDecimal(%q) = %v, %v", tt.str, parsed, err)
+		}
+	}
+}
+
+func TestDecimalScaleMatters(t *testing.T) {
+	a, b := NewDecimal(15, 1), NewDecimal(150, 2) // 1.5 and 1.50
+	if a.Equal(b) || (DataInput{a}).Equal(DataInput{b}) {
+		t.Error("1.5 equals 1.50")
+	}
+	for _, s := range []string{"", "-", ".", "1.2.3", "1e5", "--1", "1_000"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Errorf("ParseDecimal(%q) succeeded", s)
+		}
+	}
+}
+
+func TestDecimalNonCanonical(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    error
+	}{
+		{"zero byte for zero", []byte{0, 1, 0x00}, ErrInvalidBigInt},
+		{"padded positive", []byte{0, 2, 0x00, 0x7f}, ErrInvalidBigInt},
+		{"padded negative", []byte{0, 2, 0xff, 0x80}, ErrInvalidBigInt},
+		{"truncated", []byte{0, 2, 0x01}, ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		data := message(append([]byte{byte(TypeArray), 1, byte(TypeDecimal)}, tt.payload...)...)
+		if _, err := decode(data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Decoder reads DataInput values from an io.Reader in the binary format.
+type Decoder struct {
+	r   *bufio.Reader
+	cfg *Config
+}
+
+// NewDecoder returns a Decoder that reads from r using DefaultConfig. The
+// Decoder may buffer data beyond the end of the current message.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithConfig(r, DefaultConfig)
+}
+
+// NewDecoderWithConfig returns a Decoder that reads from r and enforces the
+// limits in cfg.
+func NewDecoderWithConfig(r io.Reader, cfg Config) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br, cfg: cfg.withDefaults()}
+}
+
+// Decode reads and decodes the next message from the stream. It returns
+// io.EOF when the stream ends cleanly between messages and
+// io.ErrUnexpectedEOF when it ends in the middle of one.
+func (d *Decoder) Decode() (DataInput, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	// Each message gets a fresh buffer, so zero-copy strings in the
+	// result never alias memory the Decoder reuses.
+	raw, err := d.readFull(make([]byte, 0, 64), headerLen)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	version, err := checkHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := d.r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if id == byte(TypeDict) {
+		if raw, err = d.readDict(append(raw, id)); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if id, err = d.r.ReadByte(); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	switch id {
+	case byte(TypeArray):
+		raw, err = d.readArray(append(raw, id), 1)
+	case byte(TypeDeltaArray):
+		raw, err = d.readDeltaArray(append(raw, id), 1)
+	case byte(TypeRunArray):
+		raw, err = d.readRunArray(append(raw, id), 1)
+	case byte(TypeStringArray):
+		raw, err = d.readStringArray(append(raw, id), 1)
+	case byte(TypeOpenArray):
+		raw, err = d.readOpenArray(append(raw, id), 1)
+	default:
+		return nil, ErrInvalidFormat
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if version == VersionChecksum {
+		if raw, err = d.readFull(raw, checksumLen); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if raw, err = verifyChecksum(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	pos := headerLen
+	return decodeBody(context.Background(), raw, &pos, d.cfg)
+}
+
+// readArray copies the body of an array whose identifier has already been
+// appended to buf, reading just as many bytes as the array spans.
+func (d *Decoder) readArray(buf []byte, depth int) ([]byte, error) {
+	if depth > d.cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	buf, length, err := d.readVarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(d.cfg.MaxArrayLen) {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, d.cfg.MaxArrayLen, length))
+	}
+
+	for i := uint64(0); i < length; i++ {
+		if buf, err = d.readElement(buf, depth); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readDeltaArray copies the body of a delta array whose identifier has
+// already been appended to buf. Values are range-checked when decoded.
+func (d *Decoder) readDeltaArray(buf []byte, depth int) ([]byte, error) {
+	if depth > d.cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	buf, length, err := d.readVarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(d.cfg.MaxArrayLen) {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, d.cfg.MaxArrayLen, length))
+	}
+	for i := uint64(0); i < length; i++ {
+		if buf, _, err = d.readVarint(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readRunArray copies the body of a run-length array whose identifier has
+// already been appended to buf. Run lengths are checked when decoded.
+func (d *Decoder) readRunArray(buf []byte, depth int) ([]byte, error) {
+	if depth > d.cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	buf, count, err := d.readVarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(d.cfg.MaxArrayLen) {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, d.cfg.MaxArrayLen, count))
+	}
+	for i := uint64(0); i < count; i++ {
+		if buf, _, err = d.readVarint(buf); err != nil {
+			return nil, err
+		}
+		if buf, err = d.readElement(buf, depth); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readStringArray copies the body of a string array whose identifier has
+// already been appended to buf.
+func (d *Decoder) readStringArray(buf []byte, depth int) ([]byte, error) {
+	if depth > d.cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	buf, length, err := d.readVarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(d.cfg.MaxArrayLen) {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, d.cfg.MaxArrayLen, length))
+	}
+	for i := uint64(0); i < length; i++ {
+		var strLen uint64
+		if buf, strLen, err = d.readVarint(buf); err != nil {
+			return nil, err
+		}
+		if strLen > uint64(d.cfg.MaxStringLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrStringTooLong, d.cfg.MaxStringLen, strLen))
+		}
+		if buf, err = d.readFull(buf, int(strLen)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readOpenArray copies the elements of an open array whose identifier has
+// already been appended to buf, up to and including its end marker.
+func (d *Decoder) readOpenArray(buf []byte, depth int) ([]byte, error) {
+	if depth > d.cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	for n := 0; ; n++ {
+		id, err := d.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if id[0] == byte(TypeArrayEnd) {
+			return d.readFull(buf, 1)
+		}
+		if n >= d.cfg.MaxArrayLen {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, d.cfg.MaxArrayLen, uint64(n)+1))
+		}
+		if buf, err = d.readElement(buf, depth); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readDict copies the body of a dictionary preamble whose identifier has
+// already been appended to buf.
+func (d *Decoder) readDict(buf []byte) ([]byte, error) {
+	buf, count, err := d.readVarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxDictLen {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrDictTooLong, maxDictLen, count))
+	}
+	for i := uint64(0); i < count; i++ {
+		var strLen uint64
+		if buf, strLen, err = d.readVarint(buf); err != nil {
+			return nil, err
+		}
+		if strLen > uint64(d.cfg.MaxStringLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrStringTooLong, d.cfg.MaxStringLen, strLen))
+		}
+		if buf, err = d.readFull(buf, int(strLen)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readMap copies the body of a map whose identifier has already been
+// appended to buf.
+func (d *Decoder) readMap(buf []byte, depth int) ([]byte, error) {
+	if depth > d.cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	buf, length, err := d.readVarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(d.cfg.MaxMapLen) {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrMapTooLong, d.cfg.MaxMapLen, length))
+	}
+
+	for i := uint64(0); i < length; i++ {
+		var keyLen uint64
+		if buf, keyLen, err = d.readVarint(buf); err != nil {
+			return nil, err
+		}
+		if keyLen > uint64(d.cfg.MaxStringLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrStringTooLong, d.cfg.MaxStringLen, keyLen))
+		}
+		if buf, err = d.readFull(buf, int(keyLen)); err != nil {
+			return nil, err
+		}
+		if buf, err = d.readElement(buf, depth); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readElement copies one element of an array or map at the given depth.
+func (d *Decoder) readElement(buf []byte, depth int) ([]byte, error) {
+	id, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, id)
+
+	if n, ok := fixedSize(id); ok {
+		return d.readFull(buf, n)
+	}
+
+	switch Type(id) {
+	case TypeString:
+		var strLen uint64
+		buf, strLen, err = d.readVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if strLen > uint64(d.cfg.MaxStringLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrStringTooLong, d.cfg.MaxStringLen, strLen))
+		}
+		buf, err = d.readFull(buf, int(strLen))
+	case TypeBlob:
+		var blobLen uint64
+		buf, blobLen, err = d.readVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if blobLen > uint64(d.cfg.MaxBlobLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrBlobTooLong, d.cfg.MaxBlobLen, blobLen))
+		}
+		buf, err = d.readFull(buf, int(blobLen))
+	case TypeExtension:
+		var nameLen, payloadLen uint64
+		buf, nameLen, err = d.readVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if nameLen > uint64(d.cfg.MaxStringLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrStringTooLong, d.cfg.MaxStringLen, nameLen))
+		}
+		if buf, err = d.readFull(buf, int(nameLen)); err != nil {
+			return nil, err
+		}
+		buf, payloadLen, err = d.readVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if payloadLen > uint64(d.cfg.MaxBlobLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrBlobTooLong, d.cfg.MaxBlobLen, payloadLen))
+		}
+		buf, err = d.readFull(buf, int(payloadLen))
+	case TypeBigInt, TypeDecimal:
+		var sign byte // Or the decimal's scale
+		if sign, err = d.r.ReadByte(); err != nil {
+			return nil, err
+		}
+		var magLen uint64
+		buf, magLen, err = d.readVarint(append(buf, sign))
+		if err != nil {
+			return nil, err
+		}
+		if magLen > uint64(d.cfg.MaxBigIntLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrBigIntTooLong, d.cfg.MaxBigIntLen, magLen))
+		}
+		buf, err = d.readFull(buf, int(magLen))
+	case TypeIP:
+		var family byte
+		if family, err = d.r.ReadByte(); err != nil {
+			return nil, err
+		}
+		var n int
+		if n, err = ipLen(family); err != nil {
+			return nil, err
+		}
+		buf, err = d.readFull(append(buf, family), n)
+	case TypeVarInt32, TypeVarInt64, TypeDictRef:
+		buf, _, err = d.readVarint(buf)
+	case TypeArray:
+		buf, err = d.readArray(buf, depth+1)
+	case TypeMap:
+		buf, err = d.readMap(buf, depth+1)
+	case TypeDeltaArray:
+		buf, err = d.readDeltaArray(buf, depth+1)
+	case TypeRunArray:
+		buf, err = d.readRunArray(buf, depth+1)
+	case TypeStringArray:
+		buf, err = d.readStringArray(buf, depth+1)
+	case TypeOpenArray:
+		buf, err = d.readOpenArray(buf, depth+1)
+	default:
+		if _, ok := customCodec(id); !ok {
+			return nil, fmt.Errorf("%w: %c", ErrUnknownType, id)
+		}
+		var payloadLen uint64
+		buf, payloadLen, err = d.readVarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if payloadLen > uint64(d.cfg.MaxBlobLen) {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrBlobTooLong, d.cfg.MaxBlobLen, payloadLen))
+		}
+		buf, err = d.readFull(buf, int(payloadLen))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readVarint reads a varint from the stream, appending its raw bytes to buf.
+func (d *Decoder) readVarint(buf []byte) ([]byte, uint64, error) {
+	start := len(buf)
+	for i := 0; i < maxVarintLen; i++ {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		buf = append(buf, b)
+		if b < 0x80 {
+			break
+		}
+	}
+	val, _, err := readVarint(buf[start:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return buf, val, nil
+}
+
+// readFull appends exactly n bytes from the stream to buf. The message
+// buffer as a whole is held to Config.MaxTotalBytes.
+func (d *Decoder) readFull(buf []byte, n int) ([]byte, error) {
+	if d.cfg.MaxTotalBytes > 0 && n > d.cfg.MaxTotalBytes-len(buf) {
+		return nil, ErrMemoryLimitExceeded
+	}
+	pos := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	if _, err := io.ReadFull(d.r, buf[pos:]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// unexpectedEOF reports a clean EOF inside a message as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
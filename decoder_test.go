@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// TestDecoderOneByteReader decodes a stream of messages through a reader
+// that returns a single byte per Read, so any assumption that a varint or
+// payload arrives in one piece shows up as a failure.
+func TestDecoderOneByteReader(t *testing.T) {
+	msgs := []DataInput{
+		{"hello", int32(1), DataInput{float64(2.5), []byte{1, 2, 3}}},
+		{string(bytes.Repeat([]byte("x"), 300)), int64(-1 << 40), nil, true},
+		{map[string]interface{}{"a": int8(1), "b": DataInput{"c"}}},
+		{},
+	}
+	var stream bytes.Buffer
+	for _, m := range msgs {
+		b, err := encode(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Write(b)
+	}
+
+	d := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream.Bytes())))
+	for i, want := range msgs {
+		got, err := d.Decode()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("message %d: got %v, want %v", i, got, want)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("after the last message: got %v, want io.EOF", err)
+	}
+}
+
+// TestDecoderTruncated cuts a message short at every offset and checks the
+// Decoder reports io.ErrUnexpectedEOF rather than a partial value.
+func TestDecoderTruncated(t *testing.T) {
+	b, err := encode(DataInput{"hello", DataInput{int32(7), "world"}, uint64(1) << 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n < len(b); n++ {
+		d := NewDecoder(iotest.OneByteReader(bytes.NewReader(b[:n])))
+		if _, err := d.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("truncated to %d of %d bytes: got %v, want io.ErrUnexpectedEOF", n, len(b), err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxInt32Delta is the largest difference between two int32 values.
+const maxInt32Delta = math.MaxInt32 - math.MinInt32
+
+// isInt32Array reports whether d is non-empty and holds only int32 values.
+func isInt32Array(d DataInput) bool {
+	if len(d) == 0 {
+		return false
+	}
+	for _, v := range d {
+		if _, ok := v.(int32); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// appendDeltaArray writes an all-int32 array as 'V', the element count, and
+// the zigzag varint difference of each element from the one before it (the
+// first from zero). Sorted IDs and timestamps shrink to a byte or two each.
+func appendDeltaArray(buf []byte, d DataInput) []byte {
+	buf = append(buf, byte(TypeDeltaArray))
+	buf = appendVarint(buf, uint64(len(d)))
+	var prev int64
+	for _, v := range d {
+		cur := int64(v.(int32))
+		buf = appendVarint(buf, zigzag64(cur-prev))
+		prev = cur
+	}
+	return buf
+}
+
+// deltaArraySize returns the number of bytes appendDeltaArray writes for d.
+func deltaArraySize(d DataInput) int {
+	size := 1 + varintLen(uint64(len(d)))
+	var prev int64
+	for _, v := range d {
+		cur := int64(v.(int32))
+		size += varintLen(zigzag64(cur - prev))
+		prev = cur
+	}
+	return size
+}
+
+// readDeltaLen reads the element count of a delta array whose identifier
+// has already been consumed, checking the count and depth against cfg.
+func readDeltaLen(data []byte, pos *int, depth int, cfg *Config) (uint64, error) {
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+
+	length, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	*pos += bytesRead
+
+	if length > uint64(cfg.MaxArrayLen) {
+		return 0, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, length))
+	}
+	if !lengthFits(length, data, *pos, minElementSize) { // Each delta is at least one byte
+		return 0, fmt.Errorf("%w while reading delta array", ErrUnexpectedEOF)
+	}
+	return length, nil
+}
+
+// nextDelta reads one difference of a delta array and applies it to *prev,
+// returning the reconstructed element.
+func nextDelta(data []byte, pos *int, prev *int64) (int32, error) {
+	u, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	delta := unzigzag64(u)
+	if delta < -maxInt32Delta || delta > maxInt32Delta {
+		return 0, fmt.Errorf("%w for int32 delta", ErrIntOutOfRange)
+	}
+	cur := *prev + delta
+	if cur < math.MinInt32 || cur > math.MaxInt32 {
+		return 0, fmt.Errorf("%w for int32 delta", ErrIntOutOfRange)
+	}
+	*pos += bytesRead
+	*prev = cur
+	return int32(cur), nil
+}
+
+// readDeltaArray decodes a delta array whose identifier has already been
+// consumed.
+func readDeltaArray(data []byte, pos *int, depth int, cfg *Config) (DataInput, error) {
+	length, err := readDeltaLen(data, pos, depth, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result := newArray(length)
+	var prev int64
+	for i := uint64(0); i < length; i++ {
+		v, err := nextDelta(data, pos, &prev)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.NormalizeInts {
+			result = append(result, int64(v))
+		} else {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// skipDeltaArray advances past a delta array whose identifier has already
+// been consumed, enforcing the same rules as readDeltaArray without
+// allocating.
+func skipDeltaArray(data []byte, pos *int, depth int, cfg *Config) error {
+	length, err := readDeltaLen(data, pos, depth, cfg)
+	if err != nil {
+		return err
+	}
+	var prev int64
+	for i := uint64(0); i < length; i++ {
+		if _, err := nextDelta(data, pos, &prev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zigzag64 is the 64-bit form of zigzag32.
+func zigzag64(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// unzigzag64 reverses zigzag64.
+func unzigzag64(u uint64) int64 {
+	return int64(u>>1) ^ -int64(u&1)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestDeltaInts round-trips int32 arrays with DeltaInts and checks which
+// are delta encoded and how their size compares with the plain form.
+func TestDeltaInts(t *testing.T) {
+	ints := func(vs ...int32) DataInput {
+		d := make(DataInput, len(vs))
+		for i, v := range vs {
+			d[i] = v
+		}
+		return d
+	}
+	sorted := make([]int32, 500)
+	for i := range sorted {
+		sorted[i] = 1_700_000_000 + int32(i)*3
+	}
+	r := rand.New(rand.NewSource(47))
+	unsorted := make([]int32, 500)
+	for i := range unsorted {
+		unsorted[i] = int32(r.Uint32())
+	}
+
+	tests := []struct {
+		name    string
+		in      DataInput
+		delta   bool // Whether the delta form is chosen
+		smaller bool // Whether it beats the plain form
+	}{
+		{"sorted", ints(sorted...), true, true},
+		{"descending", ints(10, 9, 8, 7, 6, 5, 4, 3, 2, 1), true, true},
+		{"mixed sign", ints(-3, 5, -1000, 1000, 0, -1, 1), true, true},
+		{"extremes", ints(math.MinInt32, math.MaxInt32, math.MinInt32, 0), true, false},
+		{"unsorted", ints(unsorted...), true, true}, // Saves the per-element identifiers
+		{"not all int32", DataInput{int32(1), int32(2), int64(3)}, false, false},
+		{"empty", DataInput{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := roundTrip(t, tt.in)
+			data, err := EncodeWithConfig(tt.in, Config{DeltaInts: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.in) {
+				t.Fatalf("got %v, want %v", got, tt.in)
+			}
+			if delta := Type(data[headerLen]) == TypeDeltaArray; delta != tt.delta {
+				t.Errorf("delta encoded: %t, want %t", delta, tt.delta)
+			}
+			if smaller := len(data) < len(plain); smaller != tt.smaller {
+				t.Errorf("%d bytes against %d plain; smaller: %t, want %t", len(data), len(plain), smaller, tt.smaller)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+)
+
+// maxDictLen bounds the number of entries in a string dictionary.
+const maxDictLen = 1 << 16
+
+// buildDict chooses the strings of data worth storing once in a dictionary:
+// those repeated often enough that a varint index per occurrence plus one
+// stored copy is smaller than writing every occurrence inline. Entries are
+// numbered in order of first occurrence, visiting map values in key order,
+// so the result is deterministic.
+func buildDict(data DataInput, cfg *Config) (map[string]uint64, []string) {
+	counts := make(map[string]int)
+	var order []string
+	var visit func(v interface{})
+	visit = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if counts[v] == 0 {
+				order = append(order, v)
+			}
+			counts[v]++
+		case DataInput:
+			for _, e := range v {
+				visit(e)
+			}
+		case map[string]interface{}:
+			for _, k := range sortedKeys(v) {
+				visit(v[k])
+			}
+		}
+	}
+	visit(data)
+
+	index := make(map[string]uint64)
+	var dict []string
+	for _, s := range order {
+		if len(dict) == maxDictLen {
+			break
+		}
+		n := counts[s]
+		entry := varintLen(uint64(len(s))) + len(s)
+		inline := n * (1 + entry)
+		stored := entry + n*(1+varintLen(uint64(len(dict))))
+		if n < 2 || stored >= inline || len(s) > cfg.MaxStringLen {
+			continue
+		}
+		index[s] = uint64(len(dict))
+		dict = append(dict, s)
+	}
+	return index, dict
+}
+
+// appendDict writes the dictionary preamble: 'D', the entry count, and each
+// entry as a varint length and its bytes. An empty dictionary is omitted.
+func appendDict(buf []byte, dict []string) []byte {
+	if len(dict) == 0 {
+		return buf
+	}
+	buf = append(buf, byte(TypeDict))
+	buf = appendVarint(buf, uint64(len(dict)))
+	for _, s := range dict {
+		buf = appendVarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	return buf
+}
+
+// dictSize returns the number of bytes appendDict writes for dict.
+func dictSize(dict []string) int {
+	if len(dict) == 0 {
+		return 0
+	}
+	n := 1 + varintLen(uint64(len(dict)))
+	for _, s := range dict {
+		n += varintLen(uint64(len(s))) + len(s)
+	}
+	return n
+}
+
+// readDict consumes the dictionary preamble at *pos, if there is one, and
+// returns cfg with the dictionary attached for decodeScalar and skipHelper.
+// Entries are only materialized when collect is set, so validation stays
+// allocation-free.
+func readDict(data []byte, pos *int, cfg *Config, collect bool) (*Config, error) {
+	if *pos >= len(data) || data[*pos] != byte(TypeDict) {
+		return cfg, nil
+	}
+	*pos++ // Skip 'D'
+
+	count, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return nil, err
+	}
+	*pos += bytesRead
+	if count > maxDictLen {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrDictTooLong, maxDictLen, count))
+	}
+	if !lengthFits(count, data, *pos, minElementSize) { // Each entry is at least its length byte
+		return nil, fmt.Errorf("%w while reading dictionary", ErrUnexpectedEOF)
+	}
+
+	c := *cfg
+	c.dictLen = int(count)
+	if collect {
+		c.dict = make([]string, 0, count)
+	}
+	for i := uint64(0); i < count; i++ {
+		s, err := readRawString(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if collect {
+			c.dict = append(c.dict, s)
+		}
+	}
+	return &c, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// flushThreshold is the buffered size at which a streaming encode writes
+// its pending bytes to the underlying writer.
+const flushThreshold = 4096
+
+// Encoder writes DataInput values to an io.Writer in the binary format. It
+// owns its buffer, so separate Encoders never share memory, but a single
+// Encoder must not be used from several goroutines at once.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+	cfg *Config
+
+	open *openArray // Set between StartArray and EndArray
+}
+
+// NewEncoder returns an Encoder that writes to w using DefaultConfig.
+func NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderWithConfig(w, DefaultConfig)
+}
+
+// NewEncoderWithConfig returns an Encoder that writes to w and enforces the
+// limits in cfg.
+func NewEncoderWithConfig(w io.Writer, cfg Config) *Encoder {
+	return &Encoder{w: w, buf: make([]byte, 0, flushThreshold), cfg: cfg.withDefaults()}
+}
+
+// encoderPool holds Encoders returned by PutEncoder.
+var encoderPool = sync.Pool{
+	New: func() interface{} { return NewEncoder(nil) },
+}
+
+// GetEncoder returns an Encoder from a shared pool, writing to w with
+// DefaultConfig. Return it with PutEncoder when done, so its buffer is
+// reused by later calls.
+func GetEncoder(w io.Writer) *Encoder {
+	e := encoderPool.Get().(*Encoder)
+	e.Reset(w)
+	e.cfg = DefaultConfig.withDefaults()
+	return e
+}
+
+// PutEncoder returns e to the pool used by GetEncoder. Neither e nor any
+// slice returned by its EncodeBytes may be used after the call.
+func PutEncoder(e *Encoder) {
+	e.Reset(nil) // Do not keep the writer alive from the pool
+	encoderPool.Put(e)
+}
+
+// Reset makes e write to w, keeping its Config and buffer. An open array
+// left unfinished is abandoned.
+func (e *Encoder) Reset(w io.Writer) {
+	e.w = w
+	e.buf = e.buf[:0]
+	e.open = nil
+}
+
+// EncodeBytes encodes data into e's buffer and returns it, without touching
+// the writer. The result is only valid until the next call to EncodeBytes,
+// Encode or Reset, or until e is returned with PutEncoder; copy it to keep
+// it longer. Reusing one Encoder this way encodes without allocating once
+// its buffer has grown to fit.
+func (e *Encoder) EncodeBytes(data DataInput) ([]byte, error) {
+	if e.open != nil {
+		return nil, ErrOpenArrayOrder
+	}
+	buf, err := encodeBody(data, appendHeader(e.buf[:0], e.cfg), nil, e.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if e.cfg.Checksum {
+		buf = appendChecksum(buf)
+	}
+	e.buf = buf[:0] // Keep any growth for the next message
+	return buf, nil
+}
+
+// Encode streams the encoding of data to the underlying writer. Bytes are
+// flushed incrementally, so on error part of the message may already have
+// been written. Errors from the writer are returned unwrapped.
+func (e *Encoder) Encode(data DataInput) error {
+	if e.open != nil {
+		return ErrOpenArrayOrder
+	}
+	w := e.w
+	var cw *crcWriter
+	if e.cfg.Checksum {
+		cw = &crcWriter{w: e.w}
+		w = cw
+	}
+
+	buf, err := encodeBody(data, appendHeader(e.buf[:0], e.cfg), w, e.cfg)
+	if err != nil {
+		return err
+	}
+	e.buf = buf[:0] // Keep any growth for the next message
+
+	if len(buf) > 0 {
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	if cw != nil {
+		if _, err := e.w.Write(binary.BigEndian.AppendUint32(buf[:0], cw.crc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// countingWriter records the size of every Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+// TestEncoderMatchesEncode checks that streaming through an Encoder writes
+// the same bytes encode returns, and that a large message reaches the
+// writer in pieces rather than in one final Write.
+func TestEncoderMatchesEncode(t *testing.T) {
+	big := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range big {
+		big[i] = DataInput{string(bytes.Repeat([]byte{'a' + byte(i%26)}, 100)), int32(i)}
+	}
+	for _, in := range []DataInput{{}, {"x", int32(1), DataInput{nil, 2.5}}, big} {
+		want, err := encode(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var w countingWriter
+		if err := NewEncoder(&w).Encode(in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.Bytes(), want) {
+			t.Errorf("Encoder wrote %d bytes that differ from encode's %d", w.Len(), len(want))
+		}
+		for _, n := range w.writes {
+			if n > 2*flushThreshold {
+				t.Errorf("single Write of %d bytes, want pieces near %d", n, flushThreshold)
+			}
+		}
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestEncoderWriterError(t *testing.T) {
+	errWrite := errors.New("write failed")
+	err := NewEncoder(failingWriter{errWrite}).Encode(DataInput{"x"})
+	if err != errWrite {
+		t.Errorf("got %v, want the writer's error unwrapped", err)
+	}
+}
+
+func TestEncoderLimits(t *testing.T) {
+	e := NewEncoderWithConfig(&bytes.Buffer{}, Config{MaxArrayLen: 2})
+	if err := e.Encode(DataInput{1, 2, 3}); !errors.Is(err, ErrArrayTooLong) {
+		t.Errorf("got %v, want ErrArrayTooLong", err)
+	}
+}
+
+// TestEncoderPoolConcurrent hammers GetEncoder and PutEncoder from many
+// goroutines, copying each EncodeBytes result before the Encoder goes back
+// to the pool, and checks every copy against a fresh encode.
+func TestEncoderPoolConcurrent(t *testing.T) {
+	const goroutines, rounds = 32, 200
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				in := DataInput{fmt.Sprintf("goroutine %d round %d", g, r), bytes.Repeat([]byte{byte(g)}, r%50)}
+				e := GetEncoder(nil)
+				b, err := e.EncodeBytes(in)
+				out := append([]byte(nil), b...)
+				PutEncoder(e)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				want, err := encode(in)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(out, want) {
+					t.Errorf("goroutine %d round %d: got %x, want %x", g, r, out, want)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// TestEncoderReuse checks that a reused Encoder's buffer is overwritten by
+// the next EncodeBytes, as documented, and that Reset switches writers.
+func TestEncoderReuse(t *testing.T) {
+	e := NewEncoder(nil)
+	first, err := e.EncodeBytes(DataInput{"first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := append([]byte(nil), first...)
+	if _, err := e.EncodeBytes(DataInput{"other"}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, kept) {
+		t.Error("EncodeBytes did not reuse the buffer of the previous call")
+	}
+
+	var a, b bytes.Buffer
+	e.Reset(&a)
+	if err := e.Encode(DataInput{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	e.Reset(&b)
+	if err := e.Encode(DataInput{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		buf  *bytes.Buffer
+		want DataInput
+	}{{&a, DataInput{"a"}}, {&b, DataInput{"b"}}} {
+		got, err := decode(c.buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("got %v, want %v", got, c.want)
+		}
+	}
+
+	in := DataInput{"first", int32(1)}
+	if n := testing.AllocsPerRun(100, func() { e.EncodeBytes(in) }); n != 0 {
+		t.Errorf("reused EncodeBytes allocated %v times, want 0", n)
+	}
+}
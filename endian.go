@@ -0,0 +1,61 @@
+package main
+
+import "encoding/binary"
+
+// Endianness is the byte order of fixed-width numbers in the native format.
+type Endianness uint8
+
+const (
+	// BigEndian writes the most significant byte first. It is the default
+	// and the layout of every message written before Endianness existed.
+	BigEndian Endianness = iota
+	// LittleEndian writes the least significant byte first, matching
+	// ClickHouse's Native and RowBinary formats.
+	LittleEndian
+)
+
+// The helpers below pick a byte order per call rather than through a
+// binary.ByteOrder interface value, so the common big-endian path still
+// compiles to a single load or store.
+
+func (e Endianness) appendUint16(buf []byte, v uint16) []byte {
+	if e == LittleEndian {
+		return binary.LittleEndian.AppendUint16(buf, v)
+	}
+	return binary.BigEndian.AppendUint16(buf, v)
+}
+
+func (e Endianness) appendUint32(buf []byte, v uint32) []byte {
+	if e == LittleEndian {
+		return binary.LittleEndian.AppendUint32(buf, v)
+	}
+	return binary.BigEndian.AppendUint32(buf, v)
+}
+
+func (e Endianness) appendUint64(buf []byte, v uint64) []byte {
+	if e == LittleEndian {
+		return binary.LittleEndian.AppendUint64(buf, v)
+	}
+	return binary.BigEndian.AppendUint64(buf, v)
+}
+
+func (e Endianness) uint16(b []byte) uint16 {
+	if e == LittleEndian {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (e Endianness) uint32(b []byte) uint32 {
+	if e == LittleEndian {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (e Endianness) uint64(b []byte) uint64 {
+	if e == LittleEndian {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// Enum8 is a value of a ClickHouse Enum8 column, carried as its underlying
+// number. It encodes as 'e' plus 1 byte and decodes back to Enum8.
+type Enum8 int8
+
+// Enum16 is a value of a ClickHouse Enum16 column, carried as its underlying
+// number. It encodes as 'E' plus 2 fixed bytes and decodes back to Enum16.
+type Enum16 int16
+
+// EnumValue returns the value cfg.EnumNames gives name, failing with
+// ErrUnknownEnum for names not in the table.
+func (cfg Config) EnumValue(name string) (int16, error) {
+	return enumValue(cfg.EnumNames, name)
+}
+
+// EnumName returns the name cfg.EnumNames gives v, failing with
+// ErrUnknownEnum for values not in the table. Enum tables are small, so
+// the table is searched directly rather than indexed.
+func (cfg Config) EnumName(v int16) (string, error) {
+	return enumName(cfg.EnumNames, v)
+}
+
+// enumValue returns the value names gives name.
+func enumValue(names map[string]int16, name string) (int16, error) {
+	v, ok := names[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: name %q", ErrUnknownEnum, name)
+	}
+	return v, nil
+}
+
+// enumName returns the name names gives v.
+func enumName(names map[string]int16, v int16) (string, error) {
+	for name, value := range names {
+		if value == v {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%w: value %d", ErrUnknownEnum, v)
+}
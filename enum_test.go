@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnumRoundTrip(t *testing.T) {
+	in := DataInput{Enum8(-128), Enum8(127), Enum16(-32768), Enum16(1000)}
+	data, err := encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(in) {
+		t.Errorf("got %#v, want %#v", got, in)
+	}
+	// Enums keep their type: Enum8(1) is not int8(1).
+	if (DataInput{Enum8(1)}).Equal(DataInput{int8(1)}) {
+		t.Error("Enum8(1) equals int8(1)")
+	}
+}
+
+func TestEnumNames(t *testing.T) {
+	cfg := Config{EnumNames: map[string]int16{"active": 1, "deleted": -2}}
+	for name, want := range cfg.EnumNames {
+		v, err := cfg.EnumValue(name)
+		if err != nil || v != want {
+			t.Errorf("EnumValue(%q) = %d, %v; want %d", name, v, err, want)
+		}
+		n, err := cfg.EnumName(want)
+		if err != nil || n != name {
+			t.Errorf("EnumName(%d) = %q, %v; want %q", want, n, err, name)
+		}
+	}
+	if _, err := cfg.EnumValue("missing"); !errors.Is(err, ErrUnknownEnum) {
+		t.Errorf("unknown name: got %v, want ErrUnknownEnum", err)
+	}
+	if _, err := cfg.EnumName(3); !errors.Is(err, ErrUnknownEnum) {
+		t.Errorf("unknown value: got %v, want ErrUnknownEnum", err)
+	}
+	if _, err := (Config{}).EnumValue("active"); !errors.Is(err, ErrUnknownEnum) {
+		t.Errorf("no table: got %v, want ErrUnknownEnum", err)
+	}
+}
+
+// TestRowBinaryEnumColumns writes names to Enum columns that declare their
+// own tables and reads them back, without touching DefaultConfig.EnumNames.
+func TestRowBinaryEnumColumns(t *testing.T) {
+	types := []string{
+		"Enum8('active' = 1, 'deleted' = -2)",
+		"Nullable(Enum16('a,b' = 1000, 'it\\'s' = 2, 'x=y' = -300))",
+		"Tuple(Enum8('on' = 1, 'off' = 0), String)",
+	}
+	rows := []DataInput{
+		{"active", "a,b", Tuple{"on", "s"}},
+		{"deleted", "it's", Tuple{"off", ""}},
+		{Enum8(1), nil, Tuple{Enum8(0), "t"}},
+		{"active", "x=y", Tuple{"on", "u"}},
+	}
+	data, err := EncodeRowBinary(rows, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x01, 0x00, 0xe8, 0x03, 0x01, 0x01, 's',
+		0xfe, 0x00, 0x02, 0x00, 0x00, 0x00,
+		0x01, 0x01, 0x00, 0x01, 't',
+		0x01, 0x00, 0xd4, 0xfe, 0x01, 0x01, 'u',
+	}
+	if string(data) != string(want) {
+		t.Errorf("got %x, want %x", data, want)
+	}
+
+	got, err := DecodeRowBinary(data, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values written as Enum8 come back as names too.
+	rows[2] = DataInput{"active", nil, Tuple{"off", "t"}}
+	for i := range rows {
+		if len(got[i]) != 3 || got[i][0] != rows[i][0] || got[i][1] != rows[i][1] || !equalTuple(got[i][2], rows[i][2]) {
+			t.Errorf("row %d: got %v, want %v", i, got[i], rows[i])
+		}
+	}
+
+	if _, err := EncodeRowBinary([]DataInput{{"missing"}}, types[:1]); !errors.Is(err, ErrUnknownEnum) {
+		t.Errorf("unknown name: got %v, want ErrUnknownEnum", err)
+	}
+	if _, err := DecodeRowBinary([]byte{5}, types[:1]); !errors.Is(err, ErrUnknownEnum) {
+		t.Errorf("unknown value: got %v, want ErrUnknownEnum", err)
+	}
+
+	// A bare Enum8 column falls back to the Config table, and to numbers.
+	cfg := Config{EnumNames: map[string]int16{"x": 7}}
+	data, err = EncodeRowBinaryWithConfig([]DataInput{{"x"}}, []string{"Enum8"}, cfg)
+	if err != nil || string(data) != "\x07" {
+		t.Fatalf("bare Enum8 with EnumNames: %x, %v", data, err)
+	}
+	if got, err := DecodeRowBinaryWithConfig(data, []string{"Enum8"}, cfg); err != nil || got[0][0] != "x" {
+		t.Errorf("bare Enum8 with EnumNames decoded %v, %v", got, err)
+	}
+	if got, err := DecodeRowBinary(data, []string{"Enum8"}); err != nil || got[0][0] != Enum8(7) {
+		t.Errorf("bare Enum8 decoded %v, %v", got, err)
+	}
+}
+
+func TestRowBinaryEnumTypeErrors(t *testing.T) {
+	for _, typ := range []string{
+		"Enum8()",
+		"Enum8('a' = 1, 'b' = 1)",
+		"Enum8('a' = 1, 'a' = 2)",
+		"Enum8('a' = 128)",
+		"Enum16('a' = 32768)",
+		"Enum8(a = 1)",
+		"Enum8('a')",
+		"Enum8('a' = x)",
+		"Enum8('a\\' = 1)",
+		"Enum8('a'b' = 1)",
+	} {
+		if _, err := EncodeRowBinary(nil, []string{typ}); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%s: got %v, want ErrUnsupportedType", typ, err)
+		}
+	}
+	if _, err := EncodeRowBinary(nil, []string{"Enum8('a' = -128, 'b' = 127)", "Enum16('a' = -32768)"}); err != nil {
+		t.Errorf("range limits: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned, possibly wrapped with detail, by encoding and
+// decoding. Match them with errors.Is.
+var (
+	ErrEmptyInput          = errors.New("empty input")
+	ErrInvalidFormat       = errors.New("invalid format: expected array identifier")
+	ErrBadMagic            = errors.New("invalid format: bad magic")
+	ErrUnsupportedVersion  = errors.New("unsupported format version")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+	ErrUnexpectedEOF       = errors.New("unexpected end of data")
+	ErrUnknownType         = errors.New("unknown type identifier")
+	ErrUnsupportedType     = errors.New("unsupported data type")
+	ErrUnregisteredType    = errors.New("unregistered extension type")
+	ErrIdentifierInUse     = errors.New("type identifier already in use")
+	ErrMaxDepth            = errors.New("max nesting depth exceeded")
+	ErrArrayTooLong        = errors.New("array length exceeds limit")
+	ErrMapTooLong          = errors.New("map size exceeds limit")
+	ErrMapKeyOrder         = errors.New("map keys not in strictly increasing order")
+	ErrStringTooLong       = errors.New("string length exceeds limit")
+	ErrBlobTooLong         = errors.New("blob length exceeds limit")
+	ErrDictTooLong         = errors.New("dictionary size exceeds limit")
+	ErrDictIndex           = errors.New("dictionary index out of range")
+	ErrMemoryLimitExceeded = errors.New("decoded size exceeds memory limit")
+	ErrTooManyElements     = errors.New("decoded element count exceeds limit")
+	ErrTimeOutOfRange      = errors.New("time out of range")
+	ErrInvalidBool         = errors.New("invalid bool value")
+	ErrInvalidRun          = errors.New("invalid run")
+	ErrIntOutOfRange       = errors.New("integer out of range")
+	ErrVarintTooLong       = errors.New("varint too long")
+	ErrVarintOverflow      = errors.New("varint overflows uint64")
+	ErrTrailingData        = errors.New("trailing data after message")
+	ErrNonCanonicalVarint  = errors.New("non-canonical varint")
+	ErrBigIntTooLong       = errors.New("big.Int magnitude exceeds limit")
+	ErrInvalidBigInt       = errors.New("invalid big.Int encoding")
+	ErrInvalidIP           = errors.New("invalid IP address")
+	ErrUnknownEnum         = errors.New("unknown enum name or value")
+	ErrNonFiniteFloat      = errors.New("non-finite float")
+	ErrInvalidUTF8         = errors.New("invalid UTF-8 in string")
+	ErrFrameTooLarge       = errors.New("frame length exceeds limit")
+	ErrSchemaMismatch      = errors.New("data does not match schema")
+	ErrOpenArrayOrder      = errors.New("StartArray, WriteElement and EndArray called out of order")
+	ErrCorruptCompressed   = errors.New("corrupt compressed data")
+	ErrIndexOutOfRange     = errors.New("index out of range")
+	ErrTypeMismatch        = errors.New("element has a different type")
+	ErrFieldCount          = errors.New("element count does not match struct fields")
+	ErrInvalidJSON         = errors.New("invalid JSON")
+	ErrFixedStringTooShort = errors.New("FixedString value shorter than its width")
+	ErrUnbalancedArray     = errors.New("BeginArray and EndArray calls do not match")
+)
+
+// DecodeError records where in the input decoding failed. Err is usually
+// one of the sentinel errors above.
+type DecodeError struct {
+	Offset int   // Byte offset of the value that failed to decode
+	Path   []int // Element indexes from the top-level array to that value
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("decode error at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("decode error at offset %d, path %v: %v", e.Offset, e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// LimitError reports a length that exceeds one of the Config limits. Err is
+// the matching sentinel, such as ErrArrayTooLong or ErrStringTooLong, so
+// errors.Is still works; use errors.As to read the numbers.
+type LimitError struct {
+	Err    error
+	Limit  int    // The limit that was exceeded
+	Actual uint64 // The offending length, as encoded or declared in the input
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v (%d > %d)", e.Err, e.Actual, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// limitError returns a *LimitError for a length that exceeds limit.
+func limitError(err error, limit int, actual uint64) error {
+	return &LimitError{Err: err, Limit: limit, Actual: actual}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message returns a Version message with the given body after the header.
+func message(body ...byte) []byte {
+	return append(append(magic[:len(magic):len(magic)], Version), body...)
+}
+
+// TestDecodeSentinels checks each decoding failure path returns its
+// sentinel error, from decode and from Validate.
+func TestDecodeSentinels(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrEmptyInput},
+		{"bad magic", []byte("XHDI\x01A\x00"), ErrBadMagic},
+		{"version", append([]byte("CHDI\x09"), 'A', 0), ErrUnsupportedVersion},
+		{"not an array", message('S', 0), ErrInvalidFormat},
+		{"unknown type", message('A', 1, '?'), ErrUnknownType},
+		{"short int32", message('A', 1, 'I', 0, 0), ErrUnexpectedEOF},
+		{"short array", message('A', 2, 'N'), ErrUnexpectedEOF},
+		{"bool", message('A', 1, 'B', 2), ErrInvalidBool},
+		{"array limit", message('A', 0xe9, 0x07), ErrArrayTooLong},
+		{"string limit", message('A', 1, 'S', 0xc1, 0x84, 0x3d), ErrStringTooLong},
+		{"trailing data", message('A', 0, 0), ErrTrailingData},
+		{"map key order", message('A', 1, 'M', 2, 1, 'b', 'N', 1, 'a', 'N'), ErrMapKeyOrder},
+		{"padded varint", message('A', 1, 'S', 0x80, 0x00), ErrNonCanonicalVarint},
+		{"long varint", message('A', 1, 'l', 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80), ErrVarintTooLong},
+		{"varint overflow", message('A', 1, 'l', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02), ErrVarintOverflow},
+		{"depth", nestedMessage(DefaultConfig.MaxDepth + 1), ErrMaxDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decode(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("decode: got %v, want %v", err, tt.want)
+			}
+			if err := Validate(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Validate: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestEncodeSentinels checks each encoding failure path returns its
+// sentinel error.
+func TestEncodeSentinels(t *testing.T) {
+	deep := DataInput{}
+	for i := 0; i < DefaultConfig.MaxDepth; i++ {
+		deep = DataInput{deep}
+	}
+	tests := []struct {
+		name string
+		in   DataInput
+		want error
+	}{
+		{"array limit", make(DataInput, DefaultConfig.MaxArrayLen+1), ErrArrayTooLong},
+		{"string limit", DataInput{strings.Repeat("x", DefaultConfig.MaxStringLen+1)}, ErrStringTooLong},
+		{"blob limit", DataInput{make([]byte, DefaultConfig.MaxBlobLen+1)}, ErrBlobTooLong},
+		{"unsupported", DataInput{struct{}{}}, ErrUnsupportedType},
+		{"depth", deep, ErrMaxDepth},
+		{"time", DataInput{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)}, ErrTimeOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := encode(tt.in); !errors.Is(err, tt.want) {
+				t.Errorf("encode: got %v, want %v", err, tt.want)
+			}
+			if err := NewEncoder(&bytes.Buffer{}).Encode(tt.in); !errors.Is(err, tt.want) {
+				t.Errorf("Encoder: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestLimitError checks the array and string limits report the limit and
+// the actual length through a LimitError on both sides, in its fields and
+// its message.
+func TestLimitError(t *testing.T) {
+	array := make(DataInput, 1500)
+	str := DataInput{strings.Repeat("x", DefaultConfig.MaxStringLen+7)}
+	tests := []struct {
+		name   string
+		in     DataInput
+		raised Config // Admits in, so there is a message to decode
+		want   error
+		limit  int
+		actual uint64
+	}{
+		{"array", array, Config{MaxArrayLen: len(array)}, ErrArrayTooLong, DefaultConfig.MaxArrayLen, uint64(len(array))},
+		{"nested array", DataInput{"a", array}, Config{MaxArrayLen: len(array)}, ErrArrayTooLong, DefaultConfig.MaxArrayLen, uint64(len(array))},
+		{"string", str, Config{MaxStringLen: len(str[0].(string))}, ErrStringTooLong, DefaultConfig.MaxStringLen, uint64(len(str[0].(string)))},
+	}
+	check := func(what string, err error, want error, limit int, actual uint64) {
+		t.Helper()
+		var le *LimitError
+		if !errors.As(err, &le) {
+			t.Fatalf("%s: got %v, want a LimitError", what, err)
+		}
+		if le.Err != want || le.Limit != limit || le.Actual != actual {
+			t.Errorf("%s: got %+v, want {%v %d %d}", what, *le, want, limit, actual)
+		}
+		if !errors.Is(err, want) {
+			t.Errorf("%s: %v does not match %v", what, err, want)
+		}
+		if msg := err.Error(); !strings.Contains(msg, fmt.Sprintf("(%d > %d)", actual, limit)) {
+			t.Errorf("%s: message %q lacks both numbers", what, msg)
+		}
+	}
+	for _, tt := range tests {
+		_, err := encode(tt.in)
+		check(tt.name+": encode", err, tt.want, tt.limit, tt.actual)
+		data, err := EncodeWithConfig(tt.in, tt.raised)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_, err = decode(data)
+		check(tt.name+": decode", err, tt.want, tt.limit, tt.actual)
+		_, err = NewDecoder(bytes.NewReader(data)).Decode()
+		check(tt.name+": Decoder", err, tt.want, tt.limit, tt.actual)
+		check(tt.name+": Validate", Validate(data), tt.want, tt.limit, tt.actual)
+	}
+
+	// A declared length far beyond the data is reported as declared.
+	_, err := decode(message(byte(TypeArray), 0xff, 0xff, 0xff, 0xff, 0x0f))
+	check("declared length", err, ErrArrayTooLong, DefaultConfig.MaxArrayLen, 1<<32-1)
+}
+
+// TestDecodeErrorPosition corrupts or truncates a nested element and checks
+// the DecodeError gives its offset and path in both fields and message,
+// while errors.Is still finds the sentinel.
+func TestDecodeErrorPosition(t *testing.T) {
+	data, err := encode(DataInput{"a", DataInput{int32(1), "bc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, 'A' 2, 'S' 1 'a', 'A' 2, 'I' and 4 bytes, then "bc".
+	offset := headerLen + 2 + 3 + 2 + 5
+
+	corrupt := bytes.Clone(data)
+	corrupt[offset] = '?'
+	truncated := data[:len(data)-1]
+
+	for _, c := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"corrupt", corrupt, ErrUnknownType},
+		{"truncated", truncated, ErrUnexpectedEOF},
+	} {
+		_, err := decode(c.data)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Fatalf("%s: got %v, want a DecodeError", c.name, err)
+		}
+		if de.Offset != offset || len(de.Path) != 2 || de.Path[0] != 1 || de.Path[1] != 1 {
+			t.Errorf("%s: offset %d path %v, want %d [1 1]", c.name, de.Offset, de.Path, offset)
+		}
+		if msg := err.Error(); !strings.Contains(msg, fmt.Sprintf("offset %d,", offset)) || !strings.Contains(msg, "path [1 1]") {
+			t.Errorf("%s: message %q lacks the offset or path", c.name, msg)
+		}
+	}
+}
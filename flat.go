@@ -0,0 +1,42 @@
+package main
+
+import "bytes"
+
+// DecodeFlatStrings returns the payload of every string and blob in data,
+// in encoded order and at any depth, ignoring all other values and the
+// structure around them, for consumers such as text indexers that only
+// need the raw bytes. Map keys and extension names are structure and are
+// not included; a run-length encoded string appears once per element.
+//
+// The payloads are views into data unless DefaultConfig.CopyStrings is
+// set. The message is checked as Validate checks it, without building the
+// decoded value.
+func DecodeFlatStrings(data []byte) ([][]byte, error) {
+	cfg := DefaultConfig.withDefaults()
+	copyOut := cfg.CopyStrings
+	cfg.CopyStrings = false // So dictionary entries are views too
+
+	flat := make([][]byte, 0)
+	cfg.flat = &flat
+	if err := validate(data, cfg); err != nil {
+		return nil, err
+	}
+	if copyOut {
+		for i, b := range flat {
+			flat[i] = bytes.Clone(b)
+		}
+	}
+	return flat, nil
+}
+
+// addFlat records the string or blob payload b when skipHelper is
+// collecting them for DecodeFlatStrings.
+func addFlat(cfg *Config, b []byte) {
+	if cfg.flat == nil {
+		return
+	}
+	if len(b) == 0 {
+		b = []byte{} // Alias nothing, as decoded empty blobs do
+	}
+	*cfg.flat = append(*cfg.flat, b[:len(b):len(b)])
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// flatInput mixes strings and blobs with every kind of structure and value
+// DecodeFlatStrings skips.
+var flatInput = DataInput{
+	"a",
+	int32(1),
+	DataInput{[]byte("b"), 2.5, DataInput{"c", nil, true}},
+	map[string]interface{}{"key": "d", "other": DataInput{int64(3), []byte("e")}},
+	"",
+	[]byte{},
+	"f",
+}
+
+// flatWant is every string and blob payload of flatInput in encoded order;
+// map values come in sorted key order.
+var flatWant = []string{"a", "b", "c", "d", "e", "", "", "f"}
+
+func TestDecodeFlatStrings(t *testing.T) {
+	repeated := DataInput{"x", "x", "x", "y", DataInput{"x", "y"}}
+	tests := []struct {
+		name string
+		in   DataInput
+		cfg  Config // Encoding options, to reach each string form
+		want []string
+	}{
+		{"nested mixed", flatInput, Config{}, flatWant},
+		{"checksum", flatInput, Config{Checksum: true}, flatWant},
+		{"dictionary", repeated, Config{DictStrings: true}, []string{"x", "x", "x", "y", "x", "y"}},
+		{"runs", repeated, Config{RunLength: true}, []string{"x", "x", "x", "y", "x", "y"}},
+		{"string arrays", repeated, Config{StringArrays: true}, []string{"x", "x", "x", "y", "x", "y"}},
+		{"no strings", DataInput{int32(1), DataInput{2.5, nil}, map[string]interface{}{"k": true}}, Config{}, nil},
+		{"empty", DataInput{}, Config{}, nil},
+	}
+	for _, tt := range tests {
+		data, err := EncodeWithConfig(tt.in, tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := DecodeFlatStrings(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got == nil {
+			t.Errorf("%s: got nil, want a non-nil slice", tt.name)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		for i, w := range tt.want {
+			if string(got[i]) != w {
+				t.Errorf("%s: payload %d is %q, want %q", tt.name, i, got[i], w)
+			}
+		}
+	}
+}
+
+// TestDecodeFlatStringsAliasing checks the payloads are views into the
+// input, capped so appending to one cannot overwrite what follows it.
+func TestDecodeFlatStringsAliasing(t *testing.T) {
+	data, err := encode(DataInput{"first", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeFlatStrings(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := bytes.Clone(data)
+	_ = append(got[0], "XXXX"...)
+	if !bytes.Equal(data, kept) {
+		t.Error("appending to a payload changed the input")
+	}
+	data[bytes.Index(data, []byte("first"))] = 'F'
+	if string(got[0]) != "First" {
+		t.Errorf("got %q after changing the input, want a view reading \"First\"", got[0])
+	}
+}
+
+func TestDecodeFlatStringsErrors(t *testing.T) {
+	data, err := encode(flatInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeFlatStrings(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("truncated: got %v, want ErrUnexpectedEOF", err)
+	}
+	if _, err := DecodeFlatStrings(append(bytes.Clone(data), 0)); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("trailing byte: got %v, want ErrTrailingData", err)
+	}
+	if _, err := DecodeFlatStrings(message(byte(TypeArray), 1, '?')); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unknown identifier: got %v, want ErrUnknownType", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WriteMessage writes data to w as one frame: the encoded message prefixed
+// with its length as a varint.
+func WriteMessage(w io.Writer, data DataInput) error {
+	frame, err := encodeFrame(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(frame)
+	return err
+}
+
+// encodeFrame returns data encoded and prefixed with its length.
+func encodeFrame(data DataInput) ([]byte, error) {
+	encoded, err := encode(data)
+	if err != nil {
+		return nil, err
+	}
+	frame := appendVarint(make([]byte, 0, varintLen(uint64(len(encoded)))+len(encoded)), uint64(len(encoded)))
+	return append(frame, encoded...), nil
+}
+
+// EncodeBatch encodes msgs as consecutive WriteMessage frames in a single
+// buffer, so the result can be sent in one write and read back with
+// ReadMessage. Each message is encoded into one reused scratch buffer and
+// appended to the growing output, avoiding a pool round trip and a copy per
+// message. An error names the index of the message that failed.
+func EncodeBatch(msgs []DataInput) ([]byte, error) {
+	bp := getBuffer(0)
+	defer putBuffer(bp)
+
+	cfg := DefaultConfig.withDefaults()
+	var out []byte
+	for i, data := range msgs {
+		buf, err := encodeBody(data, appendHeader((*bp)[:0], cfg), nil, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		if cfg.Checksum {
+			buf = appendChecksum(buf)
+		}
+		*bp = buf[:0] // Keep any growth for the next message
+		out = append(appendVarint(out, uint64(len(buf))), buf...)
+	}
+	return out, nil
+}
+
+// ReadMessage reads and decodes one frame written by WriteMessage. It never
+// reads past the end of the frame, so consecutive calls on the same reader
+// return consecutive messages. It returns io.EOF if r is exhausted before
+// the frame starts and io.ErrUnexpectedEOF if it ends inside one.
+func ReadMessage(r io.Reader) (DataInput, error) {
+	return readMessage(r, math.MaxInt32)
+}
+
+// ReadMessageLimited is like ReadMessage for untrusted streams: a frame
+// whose length prefix exceeds maxFrame bytes is rejected with a *LimitError
+// wrapping ErrFrameTooLarge before anything is allocated for it. Only its
+// length prefix has been read then, so r is out of step with the frames
+// and should be discarded.
+func ReadMessageLimited(r *bufio.Reader, maxFrame int) (DataInput, error) {
+	return readMessage(r, min(max(maxFrame, 0), math.MaxInt32))
+}
+
+// readMessage reads one frame of at most maxFrame bytes and decodes it.
+func readMessage(r io.Reader, maxFrame int) (DataInput, error) {
+	size, err := readFrameLen(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(maxFrame) {
+		return nil, limitError(ErrFrameTooLarge, maxFrame, size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return decode(payload)
+}
+
+// readFrameLen reads a varint frame length from r one byte at a time.
+func readFrameLen(r io.Reader) (uint64, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+
+	var raw [10]byte
+	for i := range raw {
+		b, err := br.ReadByte()
+		if err != nil {
+			if i > 0 {
+				return 0, unexpectedEOF(err)
+			}
+			return 0, err
+		}
+		raw[i] = b
+		if b < 0x80 {
+			size, _, err := readVarint(raw[:i+1])
+			return size, err
+		}
+	}
+	return 0, ErrVarintTooLong
+}
+
+// byteReader adapts an io.Reader to io.ByteReader without buffering.
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(b.r, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var frameMessages = []DataInput{
+	{"first", int32(1)},
+	{},
+	{DataInput{"third", []byte{0, 1}}, string(bytes.Repeat([]byte("x"), 200))},
+}
+
+func TestReadMessageSequence(t *testing.T) {
+	var stream bytes.Buffer
+	for _, m := range frameMessages {
+		if err := WriteMessage(&stream, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A reader without ReadByte, so ReadMessage must not over-read.
+	r := iotest.OneByteReader(&stream)
+	for i, want := range frameMessages {
+		got, err := ReadMessage(r)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("message %d: got %v, want %v", i, got, want)
+		}
+	}
+	if _, err := ReadMessage(r); err != io.EOF {
+		t.Errorf("after the last message: got %v, want io.EOF", err)
+	}
+}
+
+// TestReadMessageTruncated cuts a two-frame stream at every offset inside
+// the second frame and checks ReadMessage returns the first message and
+// then io.ErrUnexpectedEOF.
+func TestReadMessageTruncated(t *testing.T) {
+	var stream bytes.Buffer
+	for _, m := range frameMessages[2:] {
+		if err := WriteMessage(&stream, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := stream.Len()
+	if err := WriteMessage(&stream, frameMessages[2]); err != nil {
+		t.Fatal(err)
+	}
+	full := stream.Bytes()
+
+	for n := first + 1; n < len(full); n++ {
+		r := bytes.NewReader(full[:n])
+		if _, err := ReadMessage(r); err != nil {
+			t.Fatalf("first message: %v", err)
+		}
+		if _, err := ReadMessage(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("cut at %d of %d: got %v, want io.ErrUnexpectedEOF", n, len(full), err)
+		}
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	batch, err := EncodeBatch(frameMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	for _, m := range frameMessages {
+		if err := WriteMessage(&want, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(batch, want.Bytes()) {
+		t.Errorf("batch differs from WriteMessage frames:\n got %x\nwant %x", batch, want.Bytes())
+	}
+
+	// The output does not share the scratch buffer with later batches.
+	kept := bytes.Clone(batch)
+	if _, err := EncodeBatch([]DataInput{{"overwrite", "the", "scratch", "buffer"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(batch, kept) {
+		t.Error("a later batch changed an earlier one")
+	}
+
+	r := bytes.NewReader(batch)
+	for i, m := range frameMessages {
+		got, err := ReadMessage(r)
+		if err != nil || !got.Equal(m) {
+			t.Fatalf("message %d: got %v, %v; want %v", i, got, err, m)
+		}
+	}
+	if _, err := ReadMessage(r); err != io.EOF {
+		t.Errorf("after the batch: got %v, want io.EOF", err)
+	}
+
+	if out, err := EncodeBatch(nil); err != nil || len(out) != 0 {
+		t.Errorf("empty batch: %x, %v", out, err)
+	}
+	_, err = EncodeBatch([]DataInput{{"ok"}, {make(chan int)}})
+	if !errors.Is(err, ErrUnsupportedType) || !strings.Contains(err.Error(), "message 1") {
+		t.Errorf("bad message: got %v, want ErrUnsupportedType naming message 1", err)
+	}
+}
+
+// BenchmarkEncodeBatch compares EncodeBatch with framing each message by
+// WriteMessage into one buffer.
+func BenchmarkEncodeBatch(b *testing.B) {
+	msgs := make([]DataInput, 100)
+	for i := range msgs {
+		msgs[i] = DataInput{fmt.Sprint("row ", i), int32(i), 1.5, DataInput{true, nil}}
+	}
+	b.Run("WriteMessage", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			for _, m := range msgs {
+				if err := WriteMessage(&buf, m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("EncodeBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeBatch(msgs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestReadMessageLimited(t *testing.T) {
+	var stream bytes.Buffer
+	var largest int // Payload bytes of the largest frame
+	for _, m := range frameMessages {
+		if err := WriteMessage(&stream, m); err != nil {
+			t.Fatal(err)
+		}
+		payload, err := encode(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		largest = max(largest, len(payload))
+	}
+	frames := stream.Bytes()
+
+	// Frames up to and including the limit are read in sequence.
+	r := bufio.NewReader(bytes.NewReader(frames))
+	for i, want := range frameMessages {
+		got, err := ReadMessageLimited(r, largest)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("message %d: got %v, %v; want %v", i, got, err, want)
+		}
+	}
+	if _, err := ReadMessageLimited(r, largest); err != io.EOF {
+		t.Errorf("after the frames: got %v, want io.EOF", err)
+	}
+
+	// One byte under the largest frame rejects it by its length prefix.
+	r = bufio.NewReader(bytes.NewReader(frames))
+	var err error
+	for _, m := range frameMessages {
+		var got DataInput
+		if got, err = ReadMessageLimited(r, largest-1); err != nil {
+			break
+		}
+		if !got.Equal(m) {
+			t.Fatalf("got %v, want %v", got, m)
+		}
+	}
+	var le *LimitError
+	if !errors.Is(err, ErrFrameTooLarge) || !errors.As(err, &le) || le.Limit != largest-1 || le.Actual != uint64(largest) {
+		t.Errorf("frame over the limit: got %v, want ErrFrameTooLarge (%d > %d)", err, largest, largest-1)
+	}
+}
+
+// TestReadMessageLimitedOversized checks a length prefix far beyond the
+// limit is rejected before anything is allocated or read for the frame.
+func TestReadMessageLimitedOversized(t *testing.T) {
+	for _, size := range []uint64{1 << 20, 1 << 31, 1 << 40, math.MaxUint64} {
+		prefix := appendVarint(nil, size)
+		r := bufio.NewReader(bytes.NewReader(append(prefix, "not read"...)))
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := ReadMessageLimited(r, 1<<10)
+		runtime.ReadMemStats(&after)
+		var le *LimitError
+		if !errors.Is(err, ErrFrameTooLarge) || !errors.As(err, &le) || le.Actual != size || le.Limit != 1<<10 {
+			t.Errorf("prefix %d: got %v, want ErrFrameTooLarge (%d > 1024)", size, err, size)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<16 {
+			t.Errorf("prefix %d: allocated %d bytes", size, n)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != "not read" {
+			t.Errorf("prefix %d: read past the length prefix, leaving %q", size, rest)
+		}
+	}
+
+	// A negative limit admits nothing, not even an empty frame.
+	r := bufio.NewReader(bytes.NewReader([]byte{1, 0}))
+	if _, err := ReadMessageLimited(r, -1); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("negative limit: got %v, want ErrFrameTooLarge", err)
+	}
+}
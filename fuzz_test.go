@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// FuzzDecode feeds arbitrary bytes to decode. It must never panic, and
+// must return either an error or a value that Validate also accepts and
+// that encodes back to an equal value.
+func FuzzDecode(f *testing.F) {
+	inputs := []DataInput{
+		{},
+		{"hello", int32(-1), int64(1 << 40), 2.5, float32(-0.5), true, nil, []byte{1, 2, 3}},
+		{int8(-8), int16(-16), uint8(8), uint16(16), uint32(32), uint64(1 << 63), time.Unix(1700000000, 5).UTC()},
+		{"a", "a", "a", "b", DataInput{int32(1), int32(2), int32(3), int32(3)}, map[string]interface{}{"k": DataInput{"v"}, "": nil}},
+		{DataInput{DataInput{DataInput{}}}, map[string]interface{}{}},
+	}
+	for _, cfg := range []Config{
+		{},
+		{VarintInts: true, OptimizeIntegers: true, Checksum: true},
+		{DictStrings: true, RunLength: true, DeltaInts: true},
+		{StringArrays: true},
+	} {
+		for _, in := range inputs {
+			data, err := EncodeWithConfig(in, cfg)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+
+	header := append(magic[:len(magic):len(magic)], Version)
+	at := func(b ...byte) []byte { return append(header[:len(header):len(header)], b...) }
+	nested := func(depth int) []byte {
+		return at(append(bytes.Repeat([]byte{byte(TypeArray), 1}, depth-1), byte(TypeArray), 0)...)
+	}
+	huge := binary.AppendUvarint(nil, math.MaxUint64)
+	f.Add(nested(DefaultConfig.MaxDepth))
+	f.Add(nested(DefaultConfig.MaxDepth + 1))
+	f.Add(nested(5000))
+	f.Add(at(append([]byte{byte(TypeArray)}, huge...)...))
+	f.Add(at(append([]byte{byte(TypeArray), 1, byte(TypeString)}, huge...)...))
+	f.Add(at(append([]byte{byte(TypeArray), 1, byte(TypeBlob)}, huge...)...))
+	f.Add(at(append([]byte{byte(TypeArray), 1, byte(TypeMap)}, huge...)...))
+	f.Add(at(byte(TypeArray), 0x80, 0x80))
+	f.Add(at(byte(TypeArray), 1, byte(TypeString), 0xff))
+	f.Add(at(byte(TypeArray), 1, byte(TypeVarInt32), 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := decode(data)
+		if err != nil {
+			if d != nil {
+				t.Fatalf("returned %v with error %v", d, err)
+			}
+			return
+		}
+		if d == nil {
+			t.Fatal("returned neither a value nor an error")
+		}
+		if err := Validate(data); err != nil {
+			t.Fatalf("decode accepted what Validate rejects: %v", err)
+		}
+		out, err := encode(d)
+		if errors.Is(err, ErrUnsupportedType) {
+			return // A registered type whose codec cannot write it back
+		}
+		if err != nil {
+			t.Fatalf("re-encoding %v: %v", d, err)
+		}
+		again, err := decode(out)
+		if err != nil {
+			t.Fatalf("decoding re-encoded %v: %v", d, err)
+		}
+		if !again.Equal(d) {
+			t.Fatalf("re-encoded %v decodes to %v", d, again)
+		}
+	})
+}
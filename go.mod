@@ -1,3 +1,3 @@
-module main
+module github.com/kshitijaggrwl/Clickhouse
 
 go 1.24.2
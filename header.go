@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// magic identifies a buffer as this package's binary format.
+var magic = [4]byte{'C', 'H', 'D', 'I'}
+
+// Wire format versions.
+const (
+	// Version is the plain format written by encode.
+	Version byte = 1
+	// VersionChecksum is the plain format followed by a CRC32-C of the
+	// header and payload, written when Config.Checksum is set.
+	VersionChecksum byte = 2
+)
+
+// headerLen is the size of the magic plus version prefix.
+const headerLen = len(magic) + 1
+
+// checksumLen is the size of the trailing CRC32-C in VersionChecksum messages.
+const checksumLen = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// appendHeader writes the magic and the version selected by cfg to buf.
+func appendHeader(buf []byte, cfg *Config) []byte {
+	buf = append(buf, magic[:]...)
+	if cfg.Checksum {
+		return append(buf, VersionChecksum)
+	}
+	return append(buf, Version)
+}
+
+// ReadVersion returns the format version of an encoded buffer without
+// decoding it. Any version is returned as long as the magic matches.
+func ReadVersion(data []byte) (byte, error) {
+	if len(data) < headerLen || [4]byte(data[:4]) != magic {
+		return 0, ErrBadMagic
+	}
+	return data[4], nil
+}
+
+// checkHeader validates the header of data and returns its version.
+func checkHeader(data []byte) (byte, error) {
+	version, err := ReadVersion(data)
+	if err != nil {
+		return 0, err
+	}
+	if version != Version && version != VersionChecksum {
+		return 0, ErrUnsupportedVersion
+	}
+	return version, nil
+}
+
+// appendChecksum appends the CRC32-C of msg to msg.
+func appendChecksum(msg []byte) []byte {
+	return binary.BigEndian.AppendUint32(msg, crc32.Checksum(msg, castagnoli))
+}
+
+// verifyChecksum checks the trailing CRC32-C of msg and returns msg without it.
+func verifyChecksum(msg []byte) ([]byte, error) {
+	if len(msg) < headerLen+checksumLen {
+		return nil, fmt.Errorf("%w while reading checksum", ErrUnexpectedEOF)
+	}
+	body := msg[:len(msg)-checksumLen]
+	if binary.BigEndian.Uint32(msg[len(body):]) != crc32.Checksum(body, castagnoli) {
+		return nil, ErrChecksumMismatch
+	}
+	return body, nil
+}
+
+// crcWriter forwards writes to w while accumulating their CRC32-C.
+type crcWriter struct {
+	w   io.Writer
+	crc uint32
+}
+
+func (cw *crcWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.crc = crc32.Update(cw.crc, castagnoli, p[:n])
+	return n, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	good, err := encode(DataInput{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(good, []byte("CHDI\x01")) {
+		t.Fatalf("encoded header %q, want CHDI followed by version 1", good[:headerLen])
+	}
+	withVersion := func(v byte) []byte {
+		b := bytes.Clone(good)
+		b[len(magic)] = v
+		return b
+	}
+	wrongMagic := bytes.Clone(good)
+	wrongMagic[0] = 'X'
+
+	tests := []struct {
+		name       string
+		data       []byte
+		version    byte
+		versionErr error // From ReadVersion
+		decodeErr  error
+	}{
+		{"good", good, Version, nil, nil},
+		{"wrong magic", wrongMagic, 0, ErrBadMagic, ErrBadMagic},
+		{"future version", withVersion(VersionChecksum + 1), VersionChecksum + 1, nil, ErrUnsupportedVersion},
+		{"version zero", withVersion(0), 0, nil, ErrUnsupportedVersion},
+		{"short header", good[:headerLen-1], 0, ErrBadMagic, ErrBadMagic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ReadVersion(tt.data)
+			if !errors.Is(err, tt.versionErr) || v != tt.version {
+				t.Errorf("ReadVersion = %d, %v; want %d, %v", v, err, tt.version, tt.versionErr)
+			}
+			if _, err := decode(tt.data); !errors.Is(err, tt.decodeErr) {
+				t.Errorf("decode: got %v, want %v", err, tt.decodeErr)
+			}
+			if err := Validate(tt.data); !errors.Is(err, tt.decodeErr) {
+				t.Errorf("Validate: got %v, want %v", err, tt.decodeErr)
+			}
+		})
+	}
+}
+
+// TestChecksumDetectsFlip flips each byte of a checksummed message in turn
+// and checks decoding fails, with ErrChecksumMismatch wherever the header
+// is still intact.
+func TestChecksumDetectsFlip(t *testing.T) {
+	in := DataInput{"payload", int32(42), DataInput{2.5, []byte{0, 1}}}
+	data, err := EncodeWithConfig(in, Config{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ReadVersion(data); v != VersionChecksum {
+		t.Fatalf("version %d, want VersionChecksum", v)
+	}
+	got, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(in) {
+		t.Fatalf("got %v, want %v", got, in)
+	}
+
+	for i := range data {
+		flipped := bytes.Clone(data)
+		flipped[i] ^= 0x01
+		_, err := decode(flipped)
+		if i >= headerLen && !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("byte %d flipped: got %v, want ErrChecksumMismatch", i, err)
+		} else if err == nil {
+			t.Errorf("byte %d flipped: decoded without error", i)
+		}
+	}
+
+	// Messages without the checksum still decode.
+	if _, err := decode(roundTrip(t, in)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// Family bytes of an encoded net.IP.
+const (
+	ipNil byte = 0 // Nil or empty IP, no address bytes
+	ipV4  byte = 4 // 4 address bytes
+	ipV6  byte = 6 // 16 address bytes
+)
+
+// ipFamily returns the family byte and address bytes appendIP writes for ip.
+// IPv4 addresses, including IPv4-mapped IPv6 ones such as ::ffff:1.2.3.4,
+// are always written in their 4-byte form.
+func ipFamily(ip net.IP) (byte, []byte, error) {
+	if len(ip) == 0 {
+		return ipNil, nil, nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return ipV4, v4, nil
+	}
+	if len(ip) == net.IPv6len {
+		return ipV6, ip, nil
+	}
+	return 0, nil, fmt.Errorf("%w: length %d", ErrInvalidIP, len(ip))
+}
+
+// appendIP writes ip as 'P', a family byte, and the address bytes.
+func appendIP(buf []byte, ip net.IP) ([]byte, error) {
+	family, addr, err := ipFamily(ip)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, byte(TypeIP), family)
+	return append(buf, addr...), nil
+}
+
+// ipSize returns the number of bytes appendIP writes for ip.
+func ipSize(ip net.IP) (int, error) {
+	_, addr, err := ipFamily(ip)
+	if err != nil {
+		return 0, err
+	}
+	return 2 + len(addr), nil
+}
+
+// ipLen returns the number of address bytes that follow family.
+func ipLen(family byte) (int, error) {
+	switch family {
+	case ipNil:
+		return 0, nil
+	case ipV4:
+		return net.IPv4len, nil
+	case ipV6:
+		return net.IPv6len, nil
+	}
+	return 0, fmt.Errorf("%w: family %d", ErrInvalidIP, family)
+}
+
+// readIPAddr reads the address bytes of an IP whose identifier has already
+// been consumed, as a view into data; it is nil for a nil IP. Only the
+// encoding appendIP writes is accepted, so an IPv4-mapped address in
+// 16-byte form fails with ErrInvalidIP.
+func readIPAddr(data []byte, pos *int) ([]byte, error) {
+	if err := need(data, *pos, 1, "IP"); err != nil {
+		return nil, err
+	}
+	n, err := ipLen(data[*pos])
+	if err != nil {
+		return nil, err
+	}
+	*pos++
+	if err := need(data, *pos, n, "IP"); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	addr := data[*pos : *pos+n]
+	if n == net.IPv6len && net.IP(addr).To4() != nil {
+		return nil, fmt.Errorf("%w: IPv4-mapped address in IPv6 form", ErrInvalidIP)
+	}
+	*pos += n
+	return addr, nil
+}
+
+// decodeIP decodes an IP whose identifier has already been consumed. The
+// result is a copy, so it never aliases data.
+func decodeIP(data []byte, pos *int) (net.IP, error) {
+	addr, err := readIPAddr(data, pos)
+	if err != nil || addr == nil {
+		return nil, err
+	}
+	return append(make(net.IP, 0, len(addr)), addr...), nil
+}
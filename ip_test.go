@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestIPRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      net.IP
+		want    net.IP
+		payload []byte // Family and address
+	}{
+		{"IPv4", net.IPv4(192, 0, 2, 1).To4(), net.IP{192, 0, 2, 1}, []byte{ipV4, 192, 0, 2, 1}},
+		{"IPv4-mapped", net.IPv4(192, 0, 2, 1), net.IP{192, 0, 2, 1}, []byte{ipV4, 192, 0, 2, 1}},
+		{"IPv6", net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::1"), append([]byte{ipV6}, net.ParseIP("2001:db8::1")...)},
+		{"nil", nil, nil, []byte{ipNil}},
+		{"empty", net.IP{}, nil, []byte{ipNil}},
+	}
+	for _, tt := range tests {
+		data, err := encode(DataInput{tt.in})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(data[headerLen+3:], tt.payload) {
+			t.Errorf("%s: payload %x, want %x", tt.name, data[headerLen+3:], tt.payload)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		ip, ok := got[0].(net.IP)
+		if !ok || !bytes.Equal(ip, tt.want) || len(ip) != len(tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got[0], tt.want)
+		}
+	}
+}
+
+func TestIPInvalid(t *testing.T) {
+	if _, err := encode(DataInput{net.IP{1, 2, 3}}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("3-byte IP: got %v, want ErrInvalidIP", err)
+	}
+	mapped := net.IPv4(192, 0, 2, 1)
+	tests := []struct {
+		name    string
+		payload []byte
+		want    error
+	}{
+		{"unknown family", []byte{5, 1, 2, 3, 4}, ErrInvalidIP},
+		{"IPv4-mapped in IPv6 form", append([]byte{ipV6}, mapped...), ErrInvalidIP},
+		{"truncated", []byte{ipV4, 1, 2, 3}, ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		data := message(append([]byte{byte(TypeArray), 1, byte(TypeIP)}, tt.payload...)...)
+		if _, err := decode(data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Iterator decodes the elements of an encoded message's top-level array one
+// at a time, so peak memory is proportional to a single element rather than
+// the whole message. Nested arrays and maps are decoded in full when reached.
+// Config.MaxTotalBytes and Config.MaxElements cover the whole message, not
+// each element, so an Iterator fails where decode would.
+type Iterator struct {
+	data      []byte
+	pos       int
+	index     int
+	remaining uint64
+	cfg       *Config
+	err       error
+	budget    budget // Shared by every element, so the limits cover the whole message
+
+	delta bool      // The top-level array is delta encoded
+	open  bool      // The top-level array is open and its end not yet reached
+	strs  bool      // The top-level array is a string array
+	prev  int64     // Last element of a delta-encoded array
+	runs  DataInput // A run-length encoded top-level array, expanded up front
+}
+
+// NewIterator returns an Iterator over the top-level elements of data using
+// DefaultConfig. The header, checksum and array length are checked up front.
+func NewIterator(data []byte) (*Iterator, error) {
+	return NewIteratorWithConfig(data, DefaultConfig)
+}
+
+// NewIteratorWithConfig is like NewIterator but enforces the limits in cfg.
+func NewIteratorWithConfig(data []byte, cfg Config) (*Iterator, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyInput
+	}
+	version, err := checkHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if version == VersionChecksum {
+		if data, err = verifyChecksum(data); err != nil {
+			return nil, err
+		}
+	}
+
+	it := &Iterator{data: data, pos: headerLen}
+	if it.cfg, err = readDict(data, &it.pos, cfg.withDefaults(), true); err != nil {
+		return nil, &DecodeError{Offset: headerLen, Path: []int{}, Err: err}
+	}
+	start := it.pos
+	if it.pos < len(data) && data[it.pos] == byte(TypeDeltaArray) {
+		it.delta = true
+		it.pos++
+		it.remaining, err = readDeltaLen(data, &it.pos, 1, it.cfg)
+	} else if it.pos < len(data) && data[it.pos] == byte(TypeStringArray) {
+		it.strs = true
+		it.pos++
+		it.remaining, err = readStringArrayLen(data, &it.pos, 1, it.cfg)
+	} else if it.pos < len(data) && data[it.pos] == byte(TypeOpenArray) {
+		it.open = true
+		it.pos++
+	} else if it.pos < len(data) && data[it.pos] == byte(TypeRunArray) {
+		// Runs hold only scalars, so expanding them costs little more
+		// than the slice itself.
+		it.pos++
+		if it.runs, err = readRunArray(data, &it.pos, 1, it.cfg); err == nil {
+			it.remaining = uint64(len(it.runs))
+		}
+	} else {
+		it.remaining, err = readArrayLen(data, &it.pos, 1, it.cfg)
+	}
+	it.budget.cfg = it.cfg
+	if err == nil {
+		err = it.budget.chargeArray(it.remaining)
+	}
+	if err != nil {
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: err}
+	}
+	return it, nil
+}
+
+// Remaining returns the number of top-level elements not yet returned, or
+// -1 for an open array whose end has not been reached.
+func (it *Iterator) Remaining() int {
+	if it.open {
+		return -1
+	}
+	return int(it.remaining)
+}
+
+// Next decodes and returns the next top-level element. It returns io.EOF
+// once every element has been returned, or ErrTrailingData instead if bytes
+// follow the array and the Config does not allow them. After any other
+// error the Iterator is stuck and keeps returning that error.
+func (it *Iterator) Next() (interface{}, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.open {
+		switch {
+		case it.pos >= len(it.data):
+			it.err = &DecodeError{Offset: it.pos, Path: []int{}, Err: fmt.Errorf("%w while reading open array", ErrUnexpectedEOF)}
+			return nil, it.err
+		case it.data[it.pos] == byte(TypeArrayEnd):
+			it.pos++
+			it.open = false
+		case it.index >= it.cfg.MaxArrayLen:
+			it.err = &DecodeError{Offset: it.pos, Path: []int{}, Err: fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, it.cfg.MaxArrayLen, uint64(it.index)+1))}
+			return nil, it.err
+		default:
+			if err := it.budget.chargeArray(1); err != nil {
+				it.err = &DecodeError{Offset: it.pos, Path: []int{}, Err: err}
+				return nil, it.err
+			}
+			it.remaining = 1
+		}
+	}
+	if it.remaining == 0 {
+		if it.pos != len(it.data) && !it.cfg.AllowTrailingData {
+			it.err = &DecodeError{Offset: it.pos, Path: []int{}, Err: ErrTrailingData}
+			return nil, it.err
+		}
+		return nil, io.EOF
+	}
+
+	var val interface{}
+	var err error
+	if it.runs != nil {
+		val = it.runs[it.index]
+	} else if it.strs {
+		start := it.pos
+		if val, err = readRawString(it.data, &it.pos, it.cfg); err == nil {
+			err = it.budget.chargeLeaf(val)
+		}
+		if err != nil {
+			err = &DecodeError{Offset: start, Path: []int{it.index}, Err: err}
+		}
+	} else if it.delta {
+		start := it.pos
+		var v int32
+		if v, err = nextDelta(it.data, &it.pos, &it.prev); err != nil {
+			err = &DecodeError{Offset: start, Path: []int{it.index}, Err: err}
+		} else {
+			val, _ = normalizeInt(v, it.cfg) // An int32 always converts
+		}
+	} else {
+		val, err = decodeValue(context.Background(), it.data, &it.pos, 2, it.cfg, &it.budget)
+		if de, ok := err.(*DecodeError); ok {
+			de.Path = append([]int{it.index}, de.Path...)
+		}
+	}
+	if err != nil {
+		it.err = err
+		return nil, err
+	}
+
+	it.remaining--
+	it.index++
+	return val, nil
+}
+
+// DecodeN decodes at most the first n top-level elements of data, for
+// previewing large messages, and also returns the total number of
+// top-level elements the message holds, or -1 if its top-level array is
+// open and so has no count. Elements after the first n are neither decoded
+// nor validated, so a message that DecodeN accepts may still fail a full
+// decode.
+func DecodeN(data []byte, n int) (DataInput, int, error) {
+	it, err := NewIterator(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := it.Remaining()
+	result := make(DataInput, 0, max(min(n, total), 0))
+	for len(result) < n && it.Remaining() != 0 {
+		val, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, val)
+	}
+	return result, total, nil
+}
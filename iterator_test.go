@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// iterate returns every element an Iterator yields for data.
+func iterate(t *testing.T, data []byte) DataInput {
+	t.Helper()
+	it, err := NewIterator(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got DataInput
+	for {
+		v, err := it.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+}
+
+// TestIteratorMatchesDecode iterates large arrays in each top-level array
+// encoding and compares the elements against a full decode.
+func TestIteratorMatchesDecode(t *testing.T) {
+	n := DefaultConfig.MaxArrayLen
+	mixed, ints, strs, runs := make(DataInput, n), make(DataInput, n), make(DataInput, n), make(DataInput, n)
+	for i := 0; i < n; i++ {
+		mixed[i] = DataInput{fmt.Sprint("row ", i), int32(i), map[string]interface{}{"k": float64(i)}}
+		ints[i] = int32(i * 3)
+		strs[i] = fmt.Sprint("s", i%10)
+		runs[i] = int8(i / 100)
+	}
+	tests := []struct {
+		name string
+		in   DataInput
+		cfg  Config
+	}{
+		{"plain", mixed, Config{}},
+		{"checksum", mixed, Config{Checksum: true}},
+		{"dictionary", strs, Config{DictStrings: true}},
+		{"delta", ints, Config{DeltaInts: true}},
+		{"string array", strs, Config{StringArrays: true}},
+		{"run length", runs, Config{RunLength: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeWithConfig(tt.in, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := iterate(t, data); !got.Equal(want) {
+				t.Errorf("Iterator yielded %d elements that differ from decode's %d", len(got), len(want))
+			}
+		})
+	}
+
+	var open bytes.Buffer
+	e := NewEncoder(&open)
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range mixed {
+		if err := e.WriteElement(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+	if got := iterate(t, open.Bytes()); !got.Equal(mixed) {
+		t.Error("open array: Iterator differs from the input")
+	}
+}
+
+// TestIteratorEarlyStop stops partway and checks Remaining, then that the
+// elements read so far are the first ones.
+func TestIteratorEarlyStop(t *testing.T) {
+	in := DataInput{"a", int32(1), DataInput{"b"}, nil, 2.5}
+	it, err := NewIterator(roundTrip(t, in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if it.Remaining() != len(in)-i {
+			t.Fatalf("Remaining = %d before element %d, want %d", it.Remaining(), i, len(in)-i)
+		}
+		v, err := it.Next()
+		if err != nil || !equalValue(v, in[i]) {
+			t.Fatalf("element %d = %v, %v; want %v", i, v, err, in[i])
+		}
+	}
+	if it.Remaining() != 3 {
+		t.Errorf("Remaining = %d after two elements, want 3", it.Remaining())
+	}
+
+	got, total, err := DecodeN(roundTrip(t, in), 2)
+	if err != nil || total != len(in) || !got.Equal(in[:2]) {
+		t.Errorf("DecodeN(2) = %v, %d, %v; want %v, %d", got, total, err, in[:2], len(in))
+	}
+}
+
+// TestIteratorError corrupts the third element and checks the first two
+// are still returned, then a DecodeError for index 2 that every later call
+// repeats.
+func TestIteratorError(t *testing.T) {
+	data := roundTrip(t, DataInput{"a", "b", DataInput{"c"}, "d"})
+	// Header, 'A' 4, two 'S' 1 x, then the nested array's 'A' 1 and 'S'.
+	corrupt := bytes.Clone(data)
+	corrupt[headerLen+2+3+3+2] = '?'
+
+	it, err := NewIterator(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatalf("element %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		_, err := it.Next()
+		var de *DecodeError
+		if !errors.As(err, &de) || !errors.Is(err, ErrUnknownType) || len(de.Path) != 2 || de.Path[0] != 2 || de.Path[1] != 0 {
+			t.Errorf("call %d after the error: got %v, want ErrUnknownType at path [2 0]", i, err)
+		}
+	}
+
+	trailing := append(bytes.Clone(data), 0)
+	it, err = NewIterator(trailing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatalf("element %d: %v", i, err)
+		}
+	}
+	if _, err := it.Next(); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("after the last element: got %v, want ErrTrailingData", err)
+	}
+
+	if _, err := NewIterator(data[:headerLen+1]); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("truncated count: got %v, want ErrUnexpectedEOF", err)
+	}
+	if _, err := NewIterator(nil); !errors.Is(err, ErrEmptyInput) {
+		t.Errorf("empty input: got %v, want ErrEmptyInput", err)
+	}
+}
+
+func TestDecodeN(t *testing.T) {
+	in := DataInput{"a", int32(1), DataInput{"b"}, nil, 2.5}
+	data := roundTrip(t, in)
+	for _, n := range []int{-1, 0, 2, len(in), len(in) + 3} {
+		got, total, err := DecodeN(data, n)
+		if err != nil {
+			t.Fatalf("DecodeN(%d): %v", n, err)
+		}
+		want := in[:max(min(n, len(in)), 0)]
+		if total != len(in) || !got.Equal(want) || got == nil {
+			t.Errorf("DecodeN(%d) = %#v, %d; want %v, %d", n, got, total, want, len(in))
+		}
+	}
+
+	// Elements after the first n are not decoded, so corrupting the last
+	// one only fails once n reaches it.
+	bad := bytes.Clone(data)
+	bad[len(bad)-9] = '?' // The float64's identifier
+	if got, _, err := DecodeN(bad, len(in)-1); err != nil || !got.Equal(in[:len(in)-1]) {
+		t.Errorf("DecodeN before the corrupt element = %v, %v", got, err)
+	}
+	if _, _, err := DecodeN(bad, len(in)); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("DecodeN over the corrupt element: got %v, want ErrUnknownType", err)
+	}
+	if _, _, err := DecodeN(data[:headerLen], 1); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("DecodeN of a bare header: got %v, want ErrInvalidFormat", err)
+	}
+}
+
+// TestDecodeNOpenArray checks DecodeN reports -1 for the element count of a
+// message written with StartArray.
+func TestDecodeNOpenArray(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []interface{}{"x", int32(2), "y"} {
+		if err := e.WriteElement(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{2, 5} {
+		got, total, err := DecodeN(buf.Bytes(), n)
+		want := DataInput{"x", int32(2), "y"}[:min(n, 3)]
+		if err != nil || total != -1 || !got.Equal(want) {
+			t.Errorf("DecodeN(%d) = %v, %d, %v; want %v, -1", n, got, total, err, want)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalJSON renders d as a JSON array. Strings, bools, nil and nested
+// arrays map to their natural JSON forms; int32 is written as an integer
+// literal and float64 always carries a fraction or exponent so the two can
+// be told apart. Other types are written as single-key objects:
+//
+//	{"int8": -5}      {"int16": 300}     {"uint8": 255}  (also "uint16", "uint32")
+//	{"enum8": 1}      {"enum16": 1000}
+//	{"int64": "-5"}   {"uint64": "18446744073709551615"}   {"float32": 1.5}
+//	{"bytes": "AQI="} {"time": "2024-01-02T03:04:05.000000006Z"}
+//	{"float64": "NaN"} (also "+Inf" and "-Inf")   {"complex128": "(1+2i)"}
+//	{"bigint": "-123456789012345678901234567890"}   {"ip": "192.0.2.1"} ("" for nil)
+//	{"decimal": "-123.456"} with as many fractional digits as the scale
+//	{"map": {"key": value, ...}} with keys in sorted order
+//
+// 64-bit integers are quoted to survive JSON parsers that use float64. The
+// only lossy conversion is that invalid UTF-8 in strings is replaced with
+// U+FFFD, as with encoding/json.
+func (d DataInput) MarshalJSON() ([]byte, error) {
+	return appendJSON(nil, d)
+}
+
+// appendJSON appends the JSON form of d to buf.
+func appendJSON(buf []byte, d DataInput) ([]byte, error) {
+	buf = append(buf, '[')
+	for i, v := range d {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		var err error
+		if buf, err = appendJSONValue(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	return append(buf, ']'), nil
+}
+
+// appendJSONValue appends the JSON form of a single element to buf.
+func appendJSONValue(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case string:
+		s, err := json.Marshal(v)
+		return append(buf, s...), err
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return appendTaggedJSON(buf, "float64", strconv.Quote(strconv.FormatFloat(v, 'g', -1, 64))), nil
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0" // Keep it distinguishable from int32
+		}
+		return append(buf, s...), nil
+	case int8:
+		return appendTaggedJSON(buf, "int8", strconv.FormatInt(int64(v), 10)), nil
+	case int16:
+		return appendTaggedJSON(buf, "int16", strconv.FormatInt(int64(v), 10)), nil
+	case Enum8:
+		return appendTaggedJSON(buf, "enum8", strconv.FormatInt(int64(v), 10)), nil
+	case Enum16:
+		return appendTaggedJSON(buf, "enum16", strconv.FormatInt(int64(v), 10)), nil
+	case int64:
+		return appendTaggedJSON(buf, "int64", strconv.Quote(strconv.FormatInt(v, 10))), nil
+	case int: // Written as int64, like the binary format
+		return appendTaggedJSON(buf, "int64", strconv.Quote(strconv.Itoa(v))), nil
+	case uint8:
+		return appendTaggedJSON(buf, "uint8", strconv.FormatUint(uint64(v), 10)), nil
+	case uint16:
+		return appendTaggedJSON(buf, "uint16", strconv.FormatUint(uint64(v), 10)), nil
+	case uint32:
+		return appendTaggedJSON(buf, "uint32", strconv.FormatUint(uint64(v), 10)), nil
+	case uint64:
+		return appendTaggedJSON(buf, "uint64", strconv.Quote(strconv.FormatUint(v, 10))), nil
+	case float32:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return appendTaggedJSON(buf, "float32", strconv.Quote(strconv.FormatFloat(f, 'g', -1, 32))), nil
+		}
+		return appendTaggedJSON(buf, "float32", strconv.FormatFloat(f, 'g', -1, 32)), nil
+	case complex128:
+		return appendTaggedJSON(buf, "complex128", strconv.Quote(strconv.FormatComplex(v, 'g', -1, 128))), nil
+	case []byte:
+		return appendTaggedJSON(buf, "bytes", strconv.Quote(base64.StdEncoding.EncodeToString(v))), nil
+	case map[string]interface{}:
+		buf = append(buf, `{"map":{`...)
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			key, err := json.Marshal(k)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(append(buf, key...), ':')
+			if buf, err = appendJSONValue(buf, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, "}}"...), nil
+	case time.Time:
+		return appendTaggedJSON(buf, "time", strconv.Quote(v.UTC().Format(time.RFC3339Nano))), nil
+	case *big.Int:
+		if v == nil {
+			break
+		}
+		return appendTaggedJSON(buf, "bigint", strconv.Quote(v.String())), nil
+	case Decimal:
+		return appendTaggedJSON(buf, "decimal", strconv.Quote(v.String())), nil
+	case net.IP:
+		if len(v) == 0 {
+			return appendTaggedJSON(buf, "ip", `""`), nil
+		}
+		return appendTaggedJSON(buf, "ip", strconv.Quote(v.String())), nil
+	case DataInput:
+		return appendJSON(buf, v)
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
+
+// appendTaggedJSON appends the object {"tag": value}, where value is
+// already valid JSON.
+func appendTaggedJSON(buf []byte, tag, value string) []byte {
+	buf = append(buf, `{"`...)
+	buf = append(buf, tag...)
+	buf = append(buf, `":`...)
+	buf = append(buf, value...)
+	return append(buf, '}')
+}
+
+// UnmarshalJSON parses the form written by MarshalJSON. Integer literals
+// decode to int32, or to int64 if they do not fit; other numbers decode to
+// float64.
+func (d *DataInput) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	arr, ok := raw.([]interface{})
+	if !ok {
+		return fmt.Errorf("%w: expected array, got %T", ErrInvalidJSON, raw)
+	}
+	result, err := fromJSONArray(arr, 1, DefaultConfig.withDefaults())
+	if err != nil {
+		return err
+	}
+	*d = result
+	return nil
+}
+
+// fromJSONArray converts a generic JSON array to DataInput.
+func fromJSONArray(arr []interface{}, depth int, cfg *Config) (DataInput, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	result := make(DataInput, len(arr))
+	for i, raw := range arr {
+		v, err := fromJSONValue(raw, depth, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", i, err)
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// fromJSONValue converts one generic JSON value to a DataInput element.
+func fromJSONValue(raw interface{}, depth int, cfg *Config) (interface{}, error) {
+	switch raw := raw.(type) {
+	case nil, bool, string:
+		return raw, nil
+	case json.Number:
+		s := raw.String()
+		if strings.ContainsAny(s, ".eE") {
+			return raw.Float64()
+		}
+		i, err := raw.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("%w: integer %s: %v", ErrInvalidJSON, s, err)
+		}
+		if i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i), nil
+		}
+		return i, nil
+	case []interface{}:
+		return fromJSONArray(raw, depth+1, cfg)
+	case map[string]interface{}:
+		if m, ok := raw["map"].(map[string]interface{}); ok && len(raw) == 1 {
+			return fromJSONMap(m, depth+1, cfg)
+		}
+		return fromTaggedJSON(raw)
+	}
+	return nil, fmt.Errorf("%w: JSON value %T", ErrUnsupportedType, raw)
+}
+
+// fromJSONMap converts the entries of a {"map": {...}} object.
+func fromJSONMap(obj map[string]interface{}, depth int, cfg *Config) (map[string]interface{}, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	result := make(map[string]interface{}, len(obj))
+	for k, raw := range obj {
+		v, err := fromJSONValue(raw, depth, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// fromTaggedJSON converts a single-key tagged object written by MarshalJSON.
+func fromTaggedJSON(obj map[string]interface{}) (interface{}, error) {
+	if len(obj) != 1 {
+		return nil, fmt.Errorf("%w: tagged value must have exactly one key, got %d", ErrInvalidJSON, len(obj))
+	}
+	var tag string
+	var raw interface{}
+	for tag, raw = range obj {
+	}
+
+	s, isString := raw.(string)
+	if n, isNumber := raw.(json.Number); isNumber {
+		s = n.String()
+	} else if !isString {
+		return nil, fmt.Errorf("%w: %q value must be a string or number", ErrInvalidJSON, tag)
+	}
+
+	v, err := parseTaggedJSON(tag, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q value %q: %v", ErrInvalidJSON, tag, s, err)
+	}
+	return v, nil
+}
+
+// parseTaggedJSON parses the value s of a tagged object with the given tag.
+func parseTaggedJSON(tag, s string) (interface{}, error) {
+	switch tag {
+	case "int8":
+		i, err := strconv.ParseInt(s, 10, 8)
+		return int8(i), err
+	case "int16":
+		i, err := strconv.ParseInt(s, 10, 16)
+		return int16(i), err
+	case "enum8":
+		i, err := strconv.ParseInt(s, 10, 8)
+		return Enum8(i), err
+	case "enum16":
+		i, err := strconv.ParseInt(s, 10, 16)
+		return Enum16(i), err
+	case "int64":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint8":
+		u, err := strconv.ParseUint(s, 10, 8)
+		return uint8(u), err
+	case "uint16":
+		u, err := strconv.ParseUint(s, 10, 16)
+		return uint16(u), err
+	case "uint32":
+		u, err := strconv.ParseUint(s, 10, 32)
+		return uint32(u), err
+	case "uint64":
+		return strconv.ParseUint(s, 10, 64)
+	case "float64":
+		return strconv.ParseFloat(s, 64)
+	case "float32":
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case "complex128":
+		return strconv.ParseComplex(s, 128)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(s)
+	case "time":
+		return time.Parse(time.RFC3339Nano, s)
+	case "bigint":
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, strconv.ErrSyntax
+		}
+		return v, nil
+	case "decimal":
+		return ParseDecimal(s)
+	case "ip":
+		if s == "" {
+			return net.IP(nil), nil
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, strconv.ErrSyntax
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return v4, nil
+		}
+		return ip, nil
+	}
+	return nil, errors.New("unknown type tag")
+}
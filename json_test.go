@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	in := DataInput{
+		"text", true, false, nil, int32(-7), 2.0, 1e300,
+		int8(-5), int16(300), Enum8(1), Enum16(1000),
+		int64(math.MinInt64), uint8(255), uint16(65535), uint32(math.MaxUint32), uint64(math.MaxUint64),
+		float32(1.5), float32(math.Inf(-1)), math.Inf(1), math.NaN(), complex(1, -2),
+		[]byte{0, 1, 0xff}, time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		huge, Decimal{Unscaled: big.NewInt(-123456), Scale: 3},
+		net.IPv4(192, 0, 2, 1).To4(), net.ParseIP("2001:db8::1"), net.IP(nil),
+		DataInput{DataInput{}, "nested"},
+		map[string]interface{}{"b": int32(1), "a": DataInput{"x"}},
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out DataInput
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Equal(in) {
+		t.Errorf("round trip through %s:\n got %v\nwant %v", b, out, in)
+	}
+}
+
+func TestJSONTaggedForms(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		json string
+	}{
+		{int32(5), `[5]`},
+		{5.0, `[5.0]`},
+		{int64(-5), `[{"int64":"-5"}]`},
+		{uint64(math.MaxUint64), `[{"uint64":"18446744073709551615"}]`},
+		{big.NewInt(-42), `[{"bigint":"-42"}]`},
+		{time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), `[{"time":"2024-01-02T03:04:05.000000006Z"}]`},
+		{[]byte{1, 2}, `[{"bytes":"AQI="}]`},
+		{math.NaN(), `[{"float64":"NaN"}]`},
+		{map[string]interface{}{"z": nil, "a": "b"}, `[{"map":{"a":"b","z":null}}]`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(DataInput{tt.v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.json {
+			t.Errorf("%#v marshaled as %s, want %s", tt.v, b, tt.json)
+		}
+		var out DataInput
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !out.Equal(DataInput{tt.v}) {
+			t.Errorf("%s unmarshaled as %v", b, out)
+		}
+	}
+}
+
+func TestJSONMalformed(t *testing.T) {
+	tests := []struct {
+		json string
+		want error
+	}{
+		{`{"int64":"1"}`, ErrInvalidJSON},
+		{`"text"`, ErrInvalidJSON},
+		{`[{"int64":"1","int32":"2"}]`, ErrInvalidJSON},
+		{`[{}]`, ErrInvalidJSON},
+		{`[{"int64":true}]`, ErrInvalidJSON},
+		{`[{"int64":[1]}]`, ErrInvalidJSON},
+		{`[{"int8":"300"}]`, ErrInvalidJSON},
+		{`[{"bigint":"12x"}]`, ErrInvalidJSON},
+		{`[{"ip":"300.0.0.1"}]`, ErrInvalidJSON},
+		{`[{"time":"yesterday"}]`, ErrInvalidJSON},
+		{`[{"bytes":"!!"}]`, ErrInvalidJSON},
+		{`[{"nosuchtag":"1"}]`, ErrInvalidJSON},
+		{`[100000000000000000000]`, ErrInvalidJSON},
+		{`[[[[1]]]]`, nil},
+	}
+	for _, tt := range tests {
+		var out DataInput
+		if err := json.Unmarshal([]byte(tt.json), &out); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.json, err, tt.want)
+		}
+	}
+
+	deep := ""
+	for i := 0; i <= DefaultConfig.MaxDepth; i++ {
+		deep = "[" + deep + "]"
+	}
+	var out DataInput
+	if err := json.Unmarshal([]byte(deep), &out); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("nested past MaxDepth: got %v, want ErrMaxDepth", err)
+	}
+	if _, err := json.Marshal(DataInput{struct{}{}}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("marshal struct{}: got %v, want ErrUnsupportedType", err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Limits of the LZ4 block format. A match is at least lz4MinMatch bytes, the
+// last lz4LastLiterals bytes of a block are always literals, and no match
+// starts within lz4MFLimit bytes of the end.
+const (
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5
+	lz4MFLimit      = 12
+)
+
+// Shared by the LZ4 and Snappy compressors: matches are found through a
+// hash table of 4-byte words, and offsets fit in 16 bits.
+const (
+	matchTableBits = 14
+	maxMatchOffset = 1<<16 - 1
+)
+
+// maxCompressionRatio bounds the decompressed size of a compressed body
+// against the body's own length, so a tiny corrupt input cannot force a
+// large allocation. LZ4 and Snappy cannot exceed it: an LZ4 length byte
+// adds at most 255 bytes of output. Gzip can, and EncodeCompressedWith
+// switches to LZ4 when it would.
+const maxCompressionRatio = 256
+
+// appendLZ4 compresses src as a varint of its length followed by one block
+// in the standard LZ4 block format. ClickHouse compresses with the same
+// block format, but wraps each block in its own framing of a checksum, a
+// method byte and both sizes, so this body is not readable by ClickHouse
+// as is.
+func appendLZ4(dst, src []byte) []byte {
+	dst = appendVarint(dst, uint64(len(src)))
+	var table [1 << matchTableBits]int32 // Position + 1 of the last word with each hash
+	anchor := 0
+	for i := 0; i < len(src)-lz4MFLimit; {
+		h := matchHash(src, i)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > maxMatchOffset || load32(src, cand) != load32(src, i) {
+			i++
+			continue
+		}
+		end := i + lz4MinMatch
+		for end < len(src)-lz4LastLiterals && src[end] == src[cand+end-i] {
+			end++
+		}
+		dst = appendLZ4Sequence(dst, src[anchor:i], i-cand, end-i)
+		i, anchor = end, end
+	}
+	return appendLZ4Sequence(dst, src[anchor:], 0, 0)
+}
+
+// appendLZ4Sequence writes one LZ4 sequence: a token, the literals, and a
+// match of length n at offset back, or just the literals if n is 0, as
+// the last sequence of a block must be.
+func appendLZ4Sequence(dst, lit []byte, offset, n int) []byte {
+	token := byte(min(len(lit), 15)) << 4
+	if n > 0 {
+		token |= byte(min(n-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	if len(lit) >= 15 {
+		dst = appendLZ4Length(dst, len(lit)-15)
+	}
+	dst = append(dst, lit...)
+	if n == 0 {
+		return dst
+	}
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+	if n-lz4MinMatch >= 15 {
+		dst = appendLZ4Length(dst, n-lz4MinMatch-15)
+	}
+	return dst
+}
+
+// appendLZ4Length writes the remainder of a length whose token nibble is
+// 15, as bytes of 255 and a final smaller byte.
+func appendLZ4Length(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// readLZ4 decompresses the output of appendLZ4.
+func readLZ4(src []byte) ([]byte, error) {
+	n, i, err := readDecompressedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	dst := make([]byte, 0, n)
+	for {
+		if i >= len(src) {
+			return nil, fmt.Errorf("%w while reading lz4 block", ErrUnexpectedEOF)
+		}
+		token := src[i]
+		i++
+		lit := int(token >> 4)
+		if lit == 15 {
+			if lit, i, err = readLZ4Length(src, i, lit); err != nil {
+				return nil, err
+			}
+		}
+		if lit > len(src)-i || lit > n-len(dst) {
+			return nil, fmt.Errorf("%w: lz4 literals overrun", ErrCorruptCompressed)
+		}
+		dst = append(dst, src[i:i+lit]...)
+		i += lit
+		if i == len(src) {
+			break // The last sequence has no match
+		}
+
+		if len(src)-i < 2 {
+			return nil, fmt.Errorf("%w while reading lz4 block", ErrUnexpectedEOF)
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		length := int(token & 15)
+		if length == 15 {
+			if length, i, err = readLZ4Length(src, i, length); err != nil {
+				return nil, err
+			}
+		}
+		if dst, err = appendMatch(dst, offset, length+lz4MinMatch, n); err != nil {
+			return nil, err
+		}
+	}
+	if len(dst) != n {
+		return nil, fmt.Errorf("%w: lz4 length mismatch", ErrCorruptCompressed)
+	}
+	return dst, nil
+}
+
+// readLZ4Length adds the length bytes at src[i:] to n, the 15 of a token
+// nibble, and returns the total and the position after them.
+func readLZ4Length(src []byte, i, n int) (int, int, error) {
+	for {
+		if i >= len(src) {
+			return 0, 0, fmt.Errorf("%w while reading lz4 length", ErrUnexpectedEOF)
+		}
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+// readDecompressedLen reads the varint decompressed length that starts an
+// LZ4 or Snappy body, checking it against maxCompressionRatio, and returns
+// it with the position of the block.
+func readDecompressedLen(src []byte) (int, int, error) {
+	n, bytesRead, err := readVarint(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n > maxCompressionRatio*uint64(len(src)) {
+		return 0, 0, fmt.Errorf("%w: length %d too large for %d bytes", ErrCorruptCompressed, n, len(src))
+	}
+	return int(n), bytesRead, nil
+}
+
+// appendMatch appends the length bytes found offset bytes back in dst,
+// which may overlap the bytes being appended, without growing dst past n.
+func appendMatch(dst []byte, offset, length, n int) ([]byte, error) {
+	if offset == 0 || offset > len(dst) {
+		return nil, fmt.Errorf("%w: offset %d out of range", ErrCorruptCompressed, offset)
+	}
+	if length > n-len(dst) {
+		return nil, fmt.Errorf("%w: match overrun", ErrCorruptCompressed)
+	}
+	start := len(dst) - offset
+	for length > 0 { // An overlapping match repeats the last offset bytes
+		chunk := min(length, offset)
+		dst = append(dst, dst[start:start+chunk]...)
+		start += chunk
+		length -= chunk
+	}
+	return dst, nil
+}
+
+// load32 returns the little-endian word at b[i:].
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
+
+// matchHash hashes the word at b[i:] into the compressors' match table.
+func matchHash(b []byte, i int) uint32 {
+	return load32(b, i) * 2654435761 >> (32 - matchTableBits)
+}
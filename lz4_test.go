@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// codecInputs returns inputs for the LZ4 and Snappy tests: empty, tiny,
+// incompressible, highly repetitive, overlapping matches, and text.
+func codecInputs() map[string][]byte {
+	r := rand.New(rand.NewSource(95))
+	noise := make([]byte, 5000)
+	r.Read(noise)
+	mixed := make([]byte, 0, 200000)
+	for len(mixed) < cap(mixed)-100 {
+		if r.Intn(2) == 0 {
+			n := r.Intn(100)
+			mixed = append(mixed, noise[:n]...)
+		} else if len(mixed) > 0 {
+			start := r.Intn(len(mixed))
+			mixed = append(mixed, mixed[start:start+r.Intn(len(mixed)-start)%300]...)
+		}
+	}
+	return map[string][]byte{
+		"empty":       {},
+		"one byte":    {'x'},
+		"short":       []byte("abcabcabcabc"),
+		"noise":       noise,
+		"zeros":       make([]byte, 100000),
+		"overlapping": bytes.Repeat([]byte("ab"), 3000),
+		"text":        referenceRows(),
+		"mixed":       mixed,
+	}
+}
+
+// referenceRows returns the text compressed in testdata/rows.lz4.
+func referenceRows() []byte {
+	var b bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "row %d: the quick brown fox jumps over the lazy dog %d\n", i, i*i)
+	}
+	return b.Bytes()
+}
+
+func TestLZ4RoundTrip(t *testing.T) {
+	for name, in := range codecInputs() {
+		out := appendLZ4(nil, in)
+		got, err := readLZ4(out)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, in) {
+			t.Errorf("%s: round trip changed %d bytes into %d", name, len(in), len(got))
+		}
+	}
+}
+
+// TestLZ4Reference decodes a block written by the reference lz4 command-line
+// tool (v1.9.4, "lz4 -l -9"). Its legacy frame is a magic number and the
+// little-endian block size ahead of a standard LZ4 block.
+func TestLZ4Reference(t *testing.T) {
+	frame, err := os.ReadFile(filepath.Join("testdata", "rows.lz4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(frame) != 0x184c2102 {
+		t.Fatalf("testdata/rows.lz4 is not a legacy LZ4 frame")
+	}
+	block := frame[8 : 8+binary.LittleEndian.Uint32(frame[4:])]
+	want := referenceRows()
+
+	got, err := readLZ4(append(appendVarint(nil, uint64(len(want))), block...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decoded %q, want %q", got, want)
+	}
+}
+
+// TestLZ4Corrupt checks truncated and corrupted blocks fail or decode to
+// the declared length without panicking.
+func TestLZ4Corrupt(t *testing.T) {
+	r := rand.New(rand.NewSource(95))
+	for name, in := range codecInputs() {
+		out := appendLZ4(nil, in)
+		for n := 0; n < len(out); n += 1 + n/16 {
+			if _, err := readLZ4(out[:n]); err == nil {
+				t.Errorf("%s: truncated to %d of %d bytes decoded", name, n, len(out))
+			}
+		}
+		for i := 0; i < 200 && len(out) > 1; i++ {
+			bad := bytes.Clone(out)
+			bad[1+r.Intn(len(bad)-1)] ^= byte(1 + r.Intn(255))
+			if got, err := readLZ4(bad); err == nil && len(got) != len(in) {
+				t.Errorf("%s: corrupt block decoded to %d bytes, want %d", name, len(got), len(in))
+			}
+		}
+	}
+}
@@ -1,152 +1,1159 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"encoding"
 	"fmt"
+	"io"
 	"math"
-	"sync"
+	"math/big"
+	"net"
+	"sort"
+	"time"
+	"unicode/utf8"
 	"unsafe"
 )
 
 // DataInput represents a heterogeneous array of supported data types.
 type DataInput []interface{}
 
-var bufPool = sync.Pool{
-	New: func() interface{} {
-		return make([]byte, 0, 1024) // Optimized buffer reuse
-	},
-}
+// zeroTimeNanos is the 'T' payload reserved for the zero time.Time, which lies
+// outside the range of UnixNano.
+const zeroTimeNanos = math.MinInt64
+
+// Range of instants representable as nanoseconds since the Unix epoch.
+var (
+	minTime = time.Unix(0, math.MinInt64+1)
+	maxTime = time.Unix(0, math.MaxInt64)
+)
+
+// Smallest encodings of an array element (a bare identifier such as 'N')
+// and of a map entry (an empty key and a bare identifier).
+const (
+	minElementSize  = 1
+	minMapEntrySize = 2
+)
+
+// elementSize is the memory charged per decoded element against
+// Config.MaxTotalBytes: the size of an interface{} value.
+const elementSize = 16
+
+// ctxCheckInterval is how many elements decoding processes between checks
+// for context cancellation.
+const ctxCheckInterval = 1024
 
 // encode converts DataInput into a compact byte slice for network transmission.
+// The returned slice is owned by the caller; the pooled scratch buffer is never
+// handed out, so concurrent or repeated calls cannot corrupt earlier results.
 func encode(toSend DataInput) ([]byte, error) {
-	buf := bufPool.Get().([]byte)[:0] // Reset pooled buffer
-	defer bufPool.Put(&buf)           // Return buffer to pool
+	return EncodeWithConfig(toSend, DefaultConfig)
+}
+
+// EncodeWithConfig is like encode but enforces the limits in cfg.
+func EncodeWithConfig(toSend DataInput, cfg Config) ([]byte, error) {
+	bp := getBuffer(sizeHint(toSend))
+	defer putBuffer(bp) // Return buffer to pool
+
+	c := cfg.withDefaults()
+	buf := appendHeader((*bp)[:0], c) // Reset pooled buffer
+	buf, err := encodeBody(toSend, buf, nil, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Checksum {
+		buf = appendChecksum(buf)
+	}
+	*bp = buf[:0] // Keep any growth for the next caller
 
-	return encodeHelper(toSend, buf)
+	out := make([]byte, len(buf))
+	copy(out, buf)
+	return out, nil
+}
+
+// EncodeWithHint is like encode but writes into a buffer allocated once with
+// capacity sizeHint, skipping the pool and the final copy. A hint from
+// EncodedSize avoids every reallocation on large inputs; a non-positive hint
+// falls back to encode.
+func EncodeWithHint(data DataInput, sizeHint int) ([]byte, error) {
+	if sizeHint <= 0 {
+		return encode(data)
+	}
+	cfg := DefaultConfig.withDefaults()
+	buf := appendHeader(make([]byte, 0, sizeHint), cfg)
+	buf, err := encodeBody(data, buf, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Checksum {
+		buf = appendChecksum(buf)
+	}
+	return buf, nil
+}
+
+// EncodeTo appends the encoding of data to buf, growing it as needed, and
+// returns the extended slice, so several messages can share one
+// allocation. It bypasses the internal buffer pool entirely. On error buf
+// is returned unchanged.
+func EncodeTo(buf []byte, data DataInput) ([]byte, error) {
+	cfg := DefaultConfig.withDefaults()
+	start := len(buf)
+	out := appendHeader(buf, cfg)
+	out, err := encodeBody(data, out, nil, cfg)
+	if err != nil {
+		return buf, err
+	}
+	if cfg.Checksum {
+		out = append(out[:start], appendChecksum(out[start:])...) // Covers this message only
+	}
+	return out, nil
+}
+
+// encodeBody appends everything after the header: the string dictionary
+// when cfg.DictStrings is set, then the top-level array.
+func encodeBody(data DataInput, buf []byte, w io.Writer, cfg *Config) ([]byte, error) {
+	if cfg.DictStrings {
+		c := *cfg
+		var dict []string
+		c.dictIndex, dict = buildDict(data, cfg)
+		buf = appendDict(buf, dict)
+		cfg = &c
+	}
+	return encodeHelper(data, buf, w, 1, cfg)
 }
 
 // encodeHelper recursively encodes DataInput into a byte buffer.
 // It ensures that array and string size limits are respected.
-func encodeHelper(data DataInput, buf []byte) ([]byte, error) {
-	if len(data) > 1000 {
-		return nil, errors.New("array length exceeds limit (1000)")
+// If w is non-nil, the buffer is drained to w whenever it grows past
+// flushThreshold, so arbitrarily large inputs stream in bounded memory.
+func encodeHelper(data DataInput, buf []byte, w io.Writer, depth int, cfg *Config) ([]byte, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	if len(data) > cfg.MaxArrayLen {
+		return nil, limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(len(data)))
+	}
+	switch arrayEncoding(data, cfg) {
+	case TypeDeltaArray:
+		return flush(appendDeltaArray(buf, data), w)
+	case TypeRunArray:
+		return appendRunArray(buf, data, w, cfg)
+	case TypeStringArray:
+		return appendStringArray(buf, data, w, cfg)
 	}
 
-	buf = append(buf, 'A')                     // Array identifier
+	buf = append(buf, byte(TypeArray))
 	buf = appendVarint(buf, uint64(len(data))) // Encode array length
 
 	for _, v := range data {
-		switch v := v.(type) {
-		case string:
-			if len(v) > 1000000 {
-				return nil, errors.New("string length exceeds limit (1,000,000)")
-			}
-			buf = append(buf, 'S') // String identifier
-			buf = appendVarint(buf, uint64(len(v)))
-
-			pos := len(buf)
-			buf = append(buf, make([]byte, len(v))...) // Extend buffer
-			copy(buf[pos:], v)                         // Optimized copy
-		case int32:
-			buf = append(buf, 'I')                                           // Int32 identifier
-			buf = append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v)) // Direct encoding
-		case float64:
-			buf = append(buf, 'F') // Float identifier
-			bits := math.Float64bits(v)
-			buf = append(buf,
-				byte(bits>>56), byte(bits>>48), byte(bits>>40), byte(bits>>32),
-				byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits)) // Float encoding
-		case DataInput:
-			var err error
-			buf, err = encodeHelper(v, buf) // Recursive encoding
-			if err != nil {
+		var err error
+		if buf, err = encodeValue(v, buf, w, depth, cfg); err != nil {
+			return nil, err
+		}
+		if buf, err = flush(buf, w); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// encodeValue appends a single element of an array at the given depth.
+func encodeValue(v interface{}, buf []byte, w io.Writer, depth int, cfg *Config) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		if err := checkUTF8(v, cfg); err != nil {
+			return nil, err
+		}
+		if idx, ok := cfg.dictIndex[v]; ok {
+			buf = append(buf, byte(TypeDictRef))
+			buf = appendVarint(buf, idx)
+			break
+		}
+		if len(v) > cfg.MaxStringLen {
+			return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(v)))
+		}
+		buf = append(buf, byte(TypeString))
+		buf = appendVarint(buf, uint64(len(v)))
+		buf = append(buf, v...) // Copies straight from the string, no temporary slice
+	case []byte:
+		if len(v) > cfg.MaxBlobLen {
+			return nil, limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(len(v)))
+		}
+		buf = append(buf, byte(TypeBlob))
+		buf = appendVarint(buf, uint64(len(v)))
+		buf = append(buf, v...) // Stored verbatim
+	case int8:
+		buf = append(buf, byte(TypeInt8), byte(v))
+	case int16:
+		buf = append(buf, byte(TypeInt16))
+		buf = cfg.Endianness.appendUint16(buf, uint16(v))
+	case Enum8:
+		buf = append(buf, byte(TypeEnum8), byte(v))
+	case Enum16:
+		buf = append(buf, byte(TypeEnum16))
+		buf = cfg.Endianness.appendUint16(buf, uint16(v))
+	case int32:
+		if cfg.VarintInts {
+			buf = append(buf, byte(TypeVarInt32))
+			buf = appendVarint(buf, uint64(zigzag32(v)))
+			break
+		}
+		buf = append(buf, byte(TypeInt32))
+		buf = cfg.Endianness.appendUint32(buf, uint32(v))
+	case int64:
+		buf = appendInt64(buf, v, cfg)
+	case int:
+		// int is at most 64 bits wide on every platform, so it always fits
+		// and decodes back as int64.
+		buf = appendInt64(buf, int64(v), cfg)
+	case uint8:
+		buf = append(buf, byte(TypeUint8), v)
+	case uint16:
+		buf = append(buf, byte(TypeUint16))
+		buf = cfg.Endianness.appendUint16(buf, v)
+	case uint32:
+		buf = append(buf, byte(TypeUint32))
+		buf = cfg.Endianness.appendUint32(buf, v)
+	case uint64:
+		buf = append(buf, byte(TypeUint64))
+		buf = cfg.Endianness.appendUint64(buf, v)
+	case nil:
+		buf = append(buf, byte(TypeNull)) // No payload
+	case time.Time:
+		// Encoded as nanoseconds since the Unix epoch; the location and
+		// monotonic clock reading are not preserved.
+		nanos := int64(zeroTimeNanos)
+		if !v.IsZero() {
+			if v.Before(minTime) || v.After(maxTime) {
+				return nil, fmt.Errorf("%w: %v", ErrTimeOutOfRange, v)
+			}
+			nanos = v.UnixNano()
+		}
+		buf = append(buf, byte(TypeTime))
+		buf = cfg.Endianness.appendUint64(buf, uint64(nanos))
+	case bool:
+		buf = append(buf, byte(TypeBool))
+		if v {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case float32:
+		if err := checkFloat(float64(v), cfg); err != nil {
+			return nil, err
+		}
+		buf = append(buf, byte(TypeFloat32))
+		bits := math.Float32bits(v)
+		if cfg.canonical && v != v {
+			bits = canonicalNaN32
+		}
+		buf = cfg.Endianness.appendUint32(buf, bits)
+	case float64:
+		if err := checkFloat(v, cfg); err != nil {
+			return nil, err
+		}
+		buf = append(buf, byte(TypeFloat64))
+		bits := math.Float64bits(v)
+		if cfg.canonical && v != v {
+			bits = canonicalNaN64
+		}
+		buf = cfg.Endianness.appendUint64(buf, bits)
+	case complex128:
+		buf = append(buf, byte(TypeComplex128))
+		for _, f := range [2]float64{real(v), imag(v)} { // Same layout as float64
+			if err := checkFloat(f, cfg); err != nil {
 				return nil, err
 			}
-		default:
-			return nil, fmt.Errorf("unsupported data type: %T", v)
+			bits := math.Float64bits(f)
+			if cfg.canonical && f != f {
+				bits = canonicalNaN64
+			}
+			buf = cfg.Endianness.appendUint64(buf, bits)
+		}
+	case DataInput:
+		var err error
+		buf, err = encodeHelper(v, buf, w, depth+1, cfg) // Recursive encoding
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		var err error
+		buf, err = encodeMap(v, buf, w, depth+1, cfg)
+		if err != nil {
+			return nil, err
+		}
+	case *big.Int:
+		var err error
+		if buf, err = appendBigInt(buf, v, cfg); err != nil {
+			return nil, err
+		}
+	case net.IP:
+		var err error
+		if buf, err = appendIP(buf, v); err != nil {
+			return nil, err
+		}
+	case Decimal:
+		var err error
+		if buf, err = appendDecimal(buf, v, cfg); err != nil {
+			return nil, err
+		}
+	case encoding.BinaryMarshaler: // Types registered with RegisterType
+		name, payload, err := extensionPayload(v, cfg)
+		if err != nil {
+			return nil, err
 		}
+		buf = append(buf, byte(TypeExtension))
+		buf = appendVarint(buf, uint64(len(name)))
+		buf = append(buf, name...)
+		buf = appendVarint(buf, uint64(len(payload)))
+		buf = append(buf, payload...)
+	default: // Types registered with RegisterIdentifier
+		id, payload, err := customPayload(v, cfg)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, id)
+		buf = appendVarint(buf, uint64(len(payload)))
+		buf = append(buf, payload...)
+	}
+	return buf, nil
+}
+
+// encodeMap writes m with its keys in sorted order, so equal maps always
+// encode to the same bytes.
+func encodeMap(m map[string]interface{}, buf []byte, w io.Writer, depth int, cfg *Config) ([]byte, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	if len(m) > cfg.MaxMapLen {
+		return nil, limitError(ErrMapTooLong, cfg.MaxMapLen, uint64(len(m)))
+	}
+
+	buf = append(buf, byte(TypeMap))
+	buf = appendVarint(buf, uint64(len(m)))
+	for _, k := range sortedKeys(m) {
+		if len(k) > cfg.MaxStringLen {
+			return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(k)))
+		}
+		if err := checkUTF8(k, cfg); err != nil {
+			return nil, err
+		}
+		buf = appendVarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+
+		var err error
+		if buf, err = encodeValue(m[k], buf, w, depth, cfg); err != nil {
+			return nil, err
+		}
+		if buf, err = flush(buf, w); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// sortedKeys returns the keys of m in increasing order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendInt64 writes v as 'L' and 8 fixed bytes, or as 'l' and a zigzag
+// varint when cfg.OptimizeIntegers is set and that is shorter.
+func appendInt64(buf []byte, v int64, cfg *Config) []byte {
+	if cfg.OptimizeIntegers && varintLen(zigzag64(v)) < 8 {
+		return appendVarint(append(buf, byte(TypeVarInt64)), zigzag64(v))
+	}
+	buf = append(buf, byte(TypeInt64))
+	return cfg.Endianness.appendUint64(buf, uint64(v))
+}
+
+// int64Size returns the number of bytes appendInt64 writes for v.
+func int64Size(v int64, cfg *Config) int {
+	if n := varintLen(zigzag64(v)); cfg.OptimizeIntegers && n < 8 {
+		return 1 + n
+	}
+	return 9
+}
+
+// flush drains buf to w once it grows past flushThreshold. It is a no-op
+// when w is nil.
+func flush(buf []byte, w io.Writer) ([]byte, error) {
+	if w != nil && len(buf) >= flushThreshold {
+		if _, err := w.Write(buf); err != nil {
+			return nil, err
+		}
+		buf = buf[:0]
 	}
 	return buf, nil
 }
 
 // decode converts a byte slice back into DataInput.
+// Decoded strings and blobs are zero-copy views into received, so the caller
+// must not modify or reuse received while the result is in use; see DecodeSafe.
+// Empty arrays, top-level or nested, always decode to a non-nil DataInput{},
+// and encoding a nil DataInput writes an empty array.
 func decode(received []byte) (DataInput, error) {
+	return DecodeWithConfig(received, DefaultConfig)
+}
+
+// DecodeSafe is like decode but copies every string and blob out of received, so the
+// result stays valid after received is modified or reused.
+func DecodeSafe(received []byte) (DataInput, error) {
+	cfg := DefaultConfig
+	cfg.CopyStrings = true
+	return DecodeWithConfig(received, cfg)
+}
+
+// DecodeReuse is like decode but stores the result in *dst, reusing the
+// backing arrays of *dst, and of arrays nested in it at the same positions,
+// wherever they are large enough, so repeatedly decoding similarly shaped
+// messages allocates little. Arrays that are too small, and everything
+// inside maps, are allocated as usual. *dst must be nil or the result of an
+// earlier decode that nothing else still uses, since its arrays are
+// overwritten; if decoding fails, *dst is unchanged but the contents of its
+// arrays are unspecified.
+func DecodeReuse(data []byte, dst *DataInput) error {
+	cfg := DefaultConfig
+	cfg.reuse = *dst
+	d, err := DecodeWithConfig(data, cfg)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// DecodeWithConfig is like decode but enforces the limits in cfg.
+func DecodeWithConfig(received []byte, cfg Config) (DataInput, error) {
+	return decodeContext(context.Background(), received, cfg)
+}
+
+// DecodeContext is like decode but stops early with ctx.Err() if ctx is
+// cancelled or its deadline passes while decoding.
+func DecodeContext(ctx context.Context, received []byte) (DataInput, error) {
+	return decodeContext(ctx, received, DefaultConfig)
+}
+
+// DecodeAt decodes the single message starting at data[pos] and returns it
+// along with the position just past it, so a buffer of back-to-back
+// messages can be walked without a framing layer. Bytes after the message
+// are left for the next call, and DecodeError offsets are relative to the
+// start of data. On error the returned position is pos. A VersionChecksum
+// message is verified after its payload is decoded, so corruption may
+// surface as a decode error rather than ErrChecksumMismatch.
+func DecodeAt(data []byte, pos int) (DataInput, int, error) {
+	if pos < 0 || pos > len(data) {
+		return nil, pos, ErrUnexpectedEOF
+	}
+	if pos == len(data) {
+		return nil, pos, ErrEmptyInput
+	}
+	version, err := checkHeader(data[pos:])
+	if err != nil {
+		return nil, pos, err
+	}
+	cfg := DefaultConfig.withDefaults()
+	cfg.AllowTrailingData = true // The next message, if any
+
+	end := pos + headerLen
+	result, err := decodeBody(context.Background(), data, &end, cfg)
+	if err != nil {
+		return nil, pos, err
+	}
+	if version == VersionChecksum {
+		if len(data)-end < checksumLen {
+			return nil, pos, fmt.Errorf("%w while reading checksum", ErrUnexpectedEOF)
+		}
+		end += checksumLen
+		if _, err := verifyChecksum(data[pos:end]); err != nil {
+			return nil, pos, err
+		}
+	}
+	return result, end, nil
+}
+
+// decodeContext validates the header of received and decodes its payload.
+func decodeContext(ctx context.Context, received []byte, cfg Config) (DataInput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if len(received) == 0 {
-		return nil, errors.New("empty input")
+		return nil, ErrEmptyInput
+	}
+	version, err := checkHeader(received)
+	if err != nil {
+		return nil, err
+	}
+	if version == VersionChecksum {
+		if received, err = verifyChecksum(received); err != nil {
+			return nil, err
+		}
 	}
-	pos := 0
-	return decodeHelper(received, &pos)
+	pos := headerLen
+	return decodeBody(ctx, received, &pos, cfg.withDefaults())
 }
 
-// decodeHelper recursively decodes the binary format into DataInput.
-func decodeHelper(data []byte, pos *int) (DataInput, error) {
-	if *pos >= len(data) || data[*pos] != 'A' {
-		return nil, errors.New("invalid format: expected array identifier")
+// decodeBody decodes everything after the header: an optional string
+// dictionary, then the top-level array, which must end the data unless
+// cfg.AllowTrailingData is set.
+func decodeBody(ctx context.Context, data []byte, pos *int, cfg *Config) (DataInput, error) {
+	start := *pos
+	cfg, err := readDict(data, pos, cfg, true)
+	if err != nil {
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: err}
 	}
-	*pos++ // Skip 'A'
+	result, err := decodeHelper(ctx, data, pos, 1, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if *pos != len(data) && !cfg.AllowTrailingData {
+		return nil, &DecodeError{Offset: *pos, Path: []int{}, Err: ErrTrailingData}
+	}
+	return result, nil
+}
 
-	length, bytesRead, err := readVarint(data[*pos:])
+// decodeHelper decodes the array starting at *pos into DataInput.
+func decodeHelper(ctx context.Context, data []byte, pos *int, depth int, cfg *Config) (DataInput, error) {
+	if *pos >= len(data) || !isArray(data[*pos]) {
+		return nil, &DecodeError{Offset: *pos, Path: []int{}, Err: ErrInvalidFormat}
+	}
+	v, err := decodeValue(ctx, data, pos, depth, cfg, &budget{cfg: cfg})
 	if err != nil {
 		return nil, err
 	}
-	*pos += bytesRead
+	return v.(DataInput), nil
+}
 
-	if length > 1000 {
-		return nil, errors.New("decoded array length exceeds limit (1000)")
+// budget tracks a message's decoded size and element count against
+// Config.MaxTotalBytes and Config.MaxElements. One budget covers a whole
+// message, even when it is decoded a piece at a time.
+type budget struct {
+	cfg     *Config
+	used    int
+	counted uint64
+}
+
+// charge accounts n bytes against cfg.MaxTotalBytes.
+func (b *budget) charge(n uint64) error {
+	if b.cfg.MaxTotalBytes > 0 {
+		if n > uint64(b.cfg.MaxTotalBytes-b.used) {
+			return ErrMemoryLimitExceeded
+		}
+		b.used += int(n)
 	}
+	return nil
+}
 
-	result := make(DataInput, 0, length)
-	for i := uint64(0); i < length; i++ {
-		if *pos >= len(data) {
-			return nil, errors.New("unexpected end of data")
+// count accounts n array elements or map entries against cfg.MaxElements.
+func (b *budget) count(n uint64) error {
+	if b.cfg.MaxElements > 0 {
+		if n > uint64(b.cfg.MaxElements)-b.counted {
+			return limitError(ErrTooManyElements, b.cfg.MaxElements, max(b.counted+n, n))
+		}
+		b.counted += n
+	}
+	return nil
+}
+
+// chargeArray accounts an array of n elements against both limits.
+func (b *budget) chargeArray(n uint64) error {
+	if err := b.charge(n * elementSize); err != nil {
+		return err
+	}
+	return b.count(n)
+}
+
+// chargeLeaf accounts the contents of a decoded scalar, or of an array in
+// one of the compact encodings, which hold only scalars.
+func (b *budget) chargeLeaf(val interface{}) error {
+	switch v := val.(type) {
+	case string:
+		return b.charge(uint64(len(v)))
+	case []byte:
+		return b.charge(uint64(len(v)))
+	case *big.Int:
+		return b.charge(uint64((v.BitLen() + 7) / 8))
+	case net.IP:
+		return b.charge(uint64(len(v)))
+	case Decimal:
+		return b.charge(uint64(mantissaLen(v.Unscaled)))
+	case DataInput:
+		return b.chargeArray(uint64(len(v)))
+	}
+	return nil
+}
+
+// decodeValue decodes the value starting at *pos. Nested arrays and maps are
+// tracked on an explicit stack rather than by recursion, so stack usage
+// stays constant however deeply the input is nested. ctx is polled every
+// ctxCheckInterval elements, and what is decoded is accounted against b.
+func decodeValue(ctx context.Context, data []byte, pos *int, depth int, cfg *Config, b *budget) (interface{}, error) {
+	// frame is an array or map being filled in.
+	type frame struct {
+		array     DataInput
+		m         map[string]interface{} // Non-nil for maps
+		key       string                 // Key of the map entry being decoded, or the last one
+		n         int                    // Elements decoded so far
+		remaining uint64
+		old       DataInput // Array at this position in cfg.reuse, whose nested arrays may be reused
+		reused    bool      // array is old's backing array
+		open      bool      // A TypeOpenArray, ended by TypeArrayEnd rather than a count
+	}
+	var stack []frame
+
+	// fail wraps err with the offset of the value that failed and the index
+	// path leading to it.
+	fail := func(offset int, err error) (interface{}, error) {
+		path := make([]int, len(stack))
+		for i, f := range stack {
+			path[i] = f.n
 		}
+		return nil, &DecodeError{Offset: offset, Path: path, Err: err}
+	}
 
-		switch data[*pos] {
-		case 'S': // String
+	// open pushes a frame for the array or map whose identifier is at *pos.
+	open := func() error {
+		if data[*pos] == byte(TypeOpenArray) {
+			if depth+len(stack) > cfg.MaxDepth {
+				return ErrMaxDepth
+			}
 			*pos++
-			strLen, bytesRead, err := readVarint(data[*pos:])
+			stack = append(stack, frame{array: make(DataInput, 0), open: true})
+			return nil
+		}
+		if data[*pos] == byte(TypeMap) {
+			length, err := readMapLen(data, pos, depth+len(stack), cfg)
+			if err == nil {
+				err = b.charge(length * 2 * elementSize)
+			}
+			if err == nil {
+				err = b.count(length)
+			}
 			if err != nil {
+				return err
+			}
+			stack = append(stack, frame{m: make(map[string]interface{}, length), remaining: length})
+			return nil
+		}
+		length, err := readArrayLen(data, pos, depth+len(stack), cfg)
+		if err == nil {
+			err = b.chargeArray(length)
+		}
+		if err != nil {
+			return err
+		}
+		f := frame{remaining: length, old: cfg.reuse}
+		if len(stack) > 0 {
+			f.old = nil
+			if top := &stack[len(stack)-1]; top.m == nil && top.n < len(top.old) {
+				f.old, _ = top.old[top.n].(DataInput)
+			}
+		}
+		if f.old != nil && uint64(cap(f.old)) >= length {
+			f.array, f.reused = f.old[:0], true
+		} else {
+			f.array = newArray(length)
+		}
+		stack = append(stack, f)
+		return nil
+	}
+
+	// add stores a finished element in f.
+	add := func(f *frame, v interface{}) {
+		if f.m != nil {
+			f.m[f.key] = v
+		} else {
+			f.array = append(f.array, v)
+		}
+		f.n++
+	}
+
+	// leaf decodes a value that needs no frame: a scalar, or an array in
+	// one of the compact encodings, which only hold scalars.
+	leaf := func() (interface{}, error) {
+		var val interface{}
+		var err error
+		switch Type(data[*pos]) {
+		case TypeDeltaArray:
+			*pos++
+			val, err = readDeltaArray(data, pos, depth+len(stack), cfg)
+		case TypeRunArray:
+			*pos++
+			val, err = readRunArray(data, pos, depth+len(stack), cfg)
+		case TypeStringArray:
+			*pos++
+			var n int
+			if val, n, err = readStringArray(data, pos, depth+len(stack), cfg); err == nil {
+				err = b.charge(uint64(n))
+			}
+		default:
+			if val, err = decodeScalar(data, pos, cfg); err == nil {
+				val, err = normalizeInt(val, cfg)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return val, b.chargeLeaf(val)
+	}
+
+	start := *pos
+	if *pos >= len(data) {
+		return fail(start, ErrUnexpectedEOF)
+	}
+	if !isContainer(data[*pos]) {
+		val, err := leaf()
+		if err != nil {
+			return fail(start, err)
+		}
+		return val, nil
+	}
+	if err := open(); err != nil {
+		return fail(start, err)
+	}
+
+	for elements := 1; ; elements++ {
+		if elements%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
 				return nil, err
 			}
-			*pos += bytesRead
+		}
 
-			if *pos+int(strLen) > len(data) {
-				return nil, errors.New("string length exceeds available data")
+		top := &stack[len(stack)-1]
+		if top.open {
+			// Open arrays carry no count, so they are decoded one element
+			// at a time until the end marker.
+			switch {
+			case *pos < len(data) && data[*pos] == byte(TypeArrayEnd):
+				*pos++
+				top.open = false
+			case top.n >= cfg.MaxArrayLen:
+				return fail(*pos, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(top.n)+1)))
+			default:
+				if err := b.chargeArray(1); err != nil {
+					return fail(*pos, err)
+				}
+				top.remaining = 1
+			}
+		}
+		if top.remaining == 0 {
+			if top.reused && len(top.old) > len(top.array) {
+				clear(top.array[len(top.array):len(top.old)]) // Drop stale elements
+			}
+			var done interface{} = top.array
+			if top.m != nil {
+				done = top.m
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return done, nil
 			}
+			add(&stack[len(stack)-1], done)
+			continue
+		}
+		top.remaining--
 
-			result = append(result, bytesToString(data[*pos:*pos+int(strLen)]))
-			*pos += int(strLen)
-		case 'I': // Int32
-			if *pos+4 > len(data) {
-				return nil, errors.New("unexpected end of data while reading int32")
+		start := *pos
+		if top.m != nil {
+			key, err := readRawString(data, pos, cfg)
+			if err == nil {
+				err = b.charge(uint64(len(key)))
 			}
-			*pos++
-			val := int32(data[*pos])<<24 | int32(data[*pos+1])<<16 | int32(data[*pos+2])<<8 | int32(data[*pos+3])
-			*pos += 4
-			result = append(result, val)
-		case 'F': // Float64
-			if *pos+8 > len(data) {
-				return nil, errors.New("unexpected end of data while reading float64")
+			if err == nil && top.n > 0 && key <= top.key {
+				err = fmt.Errorf("%w: %q", ErrMapKeyOrder, key)
 			}
-			*pos++
-			bits := uint64(data[*pos])<<56 | uint64(data[*pos+1])<<48 | uint64(data[*pos+2])<<40 | uint64(data[*pos+3])<<32 |
-				uint64(data[*pos+4])<<24 | uint64(data[*pos+5])<<16 | uint64(data[*pos+6])<<8 | uint64(data[*pos+7])
-			*pos += 8
-			result = append(result, math.Float64frombits(bits))
-		case 'A': // Nested array
-			nested, err := decodeHelper(data, pos)
 			if err != nil {
-				return nil, err
+				return fail(start, err)
 			}
-			result = append(result, nested)
-		default:
-			return nil, fmt.Errorf("unknown type identifier: %c", data[*pos])
+			top.key = key
+			start = *pos
+		}
+		if *pos >= len(data) {
+			return fail(start, ErrUnexpectedEOF)
+		}
+		if isContainer(data[*pos]) { // Nested array or map
+			if err := open(); err != nil {
+				return fail(start, err)
+			}
+			continue
+		}
+
+		val, err := leaf()
+		if err != nil {
+			return fail(start, err)
 		}
+		add(top, val)
 	}
-	return result, nil
 }
 
-// appendVarint encodes a uint64 as a compact varint.
+// isArray reports whether id starts a DataInput in any array encoding.
+func isArray(id byte) bool {
+	return id == byte(TypeArray) || id == byte(TypeDeltaArray) || id == byte(TypeRunArray) || id == byte(TypeStringArray) ||
+		id == byte(TypeOpenArray)
+}
+
+// isContainer reports whether id starts an array or map.
+func isContainer(id byte) bool {
+	return id == byte(TypeArray) || id == byte(TypeMap) || id == byte(TypeOpenArray)
+}
+
+// readArrayLen consumes an array identifier and its element count, checking
+// the count and depth against cfg.
+func readArrayLen(data []byte, pos *int, depth int, cfg *Config) (uint64, error) {
+	if *pos >= len(data) || data[*pos] != byte(TypeArray) {
+		return 0, ErrInvalidFormat
+	}
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+	*pos++ // Skip 'A'
+
+	length, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	*pos += bytesRead
+
+	if length > uint64(cfg.MaxArrayLen) {
+		return 0, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, length))
+	}
+	if !lengthFits(length, data, *pos, minElementSize) {
+		return 0, fmt.Errorf("%w while reading array", ErrUnexpectedEOF)
+	}
+	return length, nil
+}
+
+// readMapLen consumes a map identifier and its entry count, checking the
+// count and depth against cfg.
+func readMapLen(data []byte, pos *int, depth int, cfg *Config) (uint64, error) {
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+	*pos++ // Skip 'M'
+
+	length, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	*pos += bytesRead
+
+	if length > uint64(cfg.MaxMapLen) {
+		return 0, fmt.Errorf("decoded %w", limitError(ErrMapTooLong, cfg.MaxMapLen, length))
+	}
+	if !lengthFits(length, data, *pos, minMapEntrySize) {
+		return 0, fmt.Errorf("%w while reading map", ErrUnexpectedEOF)
+	}
+	return length, nil
+}
+
+// need checks that the n-byte payload of a what starts at data[pos] and
+// is complete, reporting how many bytes are missing otherwise. Every
+// fixed-width read goes through it.
+func need(data []byte, pos, n int, what string) error {
+	if have := len(data) - pos; n > have {
+		return fmt.Errorf("%w while reading %s: have %d of %d bytes", ErrUnexpectedEOF, what, max(have, 0), n)
+	}
+	return nil
+}
+
+// lengthFits reports whether count items of at least minSize bytes each
+// could fit in the data after pos. Declared lengths are checked with it
+// before anything is allocated for them, so a short malicious input cannot
+// force a large allocation however high the configured limits are.
+func lengthFits(count uint64, data []byte, pos int, minSize int) bool {
+	return count <= uint64(len(data)-pos)/uint64(minSize)
+}
+
+// readLength reads the varint length prefix of a string, blob or other
+// length-prefixed value at *pos and advances past it. Lengths over max fail
+// with tooLong and lengths running past the end of data with
+// ErrUnexpectedEOF while reading what, so every length-prefixed type is
+// bounded the same way before its payload is touched.
+func readLength(data []byte, pos *int, max int, tooLong error, what string) (int, error) {
+	n, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(max) {
+		return 0, fmt.Errorf("decoded %w", limitError(tooLong, max, n))
+	}
+	if n > uint64(len(data)-*pos-bytesRead) {
+		return 0, fmt.Errorf("%w while reading %s", ErrUnexpectedEOF, what)
+	}
+	*pos += bytesRead
+	return int(n), nil
+}
+
+// readRawString reads a string stored without an identifier, as a varint
+// length and the bytes, as map keys and dictionary entries are.
+func readRawString(data []byte, pos *int, cfg *Config) (string, error) {
+	n, err := readLength(data, pos, cfg.MaxStringLen, ErrStringTooLong, "string")
+	if err != nil || n == 0 {
+		// An empty string never aliases data or the arena, even when *pos
+		// is at the very end of data.
+		return "", err
+	}
+	str := data[*pos : *pos+n]
+	if err := checkUTF8(bytesToString(str), cfg); err != nil {
+		return "", err
+	}
+	*pos += n
+	if cfg.arena != nil {
+		return bytesToString(cfg.arena.alloc(str)), nil
+	}
+	if cfg.CopyStrings {
+		return string(str), nil
+	}
+	return bytesToString(str), nil
+}
+
+// readRawBlob reads a blob stored without an identifier, as a varint length
+// and the bytes.
+func readRawBlob(data []byte, pos *int, cfg *Config) ([]byte, error) {
+	n, err := readLength(data, pos, cfg.MaxBlobLen, ErrBlobTooLong, "blob")
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return []byte{}, nil // Non-nil like any decoded blob, but aliasing nothing
+	}
+	start, end := *pos, *pos+n
+	*pos = end
+	if cfg.arena != nil {
+		return cfg.arena.alloc(data[start:end]), nil
+	}
+	if cfg.CopyStrings {
+		blob := make([]byte, n)
+		copy(blob, data[start:end])
+		return blob, nil
+	}
+	return data[start:end:end], nil // Capped so appends cannot clobber data
+}
+
+// decodeScalar decodes the non-array value starting at *pos.
+func decodeScalar(data []byte, pos *int, cfg *Config) (interface{}, error) {
+	switch Type(data[*pos]) {
+	case TypeString: // String
+		*pos++
+		str, err := readRawString(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return str, nil
+	case TypeBlob: // Blob
+		*pos++
+		blob, err := readRawBlob(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return blob, nil
+	case TypeInt8: // Int8
+		*pos++
+		if err := need(data, *pos, 1, "int8"); err != nil {
+			return nil, err
+		}
+		*pos++
+		return int8(data[*pos-1]), nil
+	case TypeInt16: // Int16
+		*pos++
+		if err := need(data, *pos, 2, "int16"); err != nil {
+			return nil, err
+		}
+		val := int16(cfg.Endianness.uint16(data[*pos:]))
+		*pos += 2
+		return val, nil
+	case TypeEnum8: // Enum8
+		*pos++
+		if err := need(data, *pos, 1, "enum8"); err != nil {
+			return nil, err
+		}
+		*pos++
+		return Enum8(data[*pos-1]), nil
+	case TypeEnum16: // Enum16
+		*pos++
+		if err := need(data, *pos, 2, "enum16"); err != nil {
+			return nil, err
+		}
+		val := Enum16(cfg.Endianness.uint16(data[*pos:]))
+		*pos += 2
+		return val, nil
+	case TypeInt32: // Int32
+		*pos++
+		if err := need(data, *pos, 4, "int32"); err != nil {
+			return nil, err
+		}
+		val := int32(cfg.Endianness.uint32(data[*pos:]))
+		*pos += 4
+		return val, nil
+	case TypeVarInt32: // Zigzag varint int32
+		*pos++
+		u, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxUint32 {
+			return nil, fmt.Errorf("%w for varint int32", ErrIntOutOfRange)
+		}
+		*pos += bytesRead
+		return unzigzag32(uint32(u)), nil
+	case TypeVarInt64: // Zigzag varint int64
+		*pos++
+		u, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return nil, err
+		}
+		*pos += bytesRead
+		return unzigzag64(u), nil
+	case TypeInt64: // Int64
+		*pos++
+		if err := need(data, *pos, 8, "int64"); err != nil {
+			return nil, err
+		}
+		val := int64(cfg.Endianness.uint64(data[*pos:]))
+		*pos += 8
+		return val, nil
+	case TypeUint8: // Uint8
+		*pos++
+		if err := need(data, *pos, 1, "uint8"); err != nil {
+			return nil, err
+		}
+		*pos++
+		return data[*pos-1], nil
+	case TypeUint16: // Uint16
+		*pos++
+		if err := need(data, *pos, 2, "uint16"); err != nil {
+			return nil, err
+		}
+		val := cfg.Endianness.uint16(data[*pos:])
+		*pos += 2
+		return val, nil
+	case TypeUint32: // Uint32
+		*pos++
+		if err := need(data, *pos, 4, "uint32"); err != nil {
+			return nil, err
+		}
+		val := cfg.Endianness.uint32(data[*pos:])
+		*pos += 4
+		return val, nil
+	case TypeUint64: // Uint64
+		*pos++
+		if err := need(data, *pos, 8, "uint64"); err != nil {
+			return nil, err
+		}
+		val := cfg.Endianness.uint64(data[*pos:])
+		*pos += 8
+		return val, nil
+	case TypeTime: // Time
+		*pos++
+		if err := need(data, *pos, 8, "time"); err != nil {
+			return nil, err
+		}
+		nanos := int64(cfg.Endianness.uint64(data[*pos:]))
+		*pos += 8
+		if nanos == zeroTimeNanos {
+			return time.Time{}, nil
+		}
+		return time.Unix(0, nanos).UTC(), nil
+	case TypeDictRef: // Dictionary string
+		*pos++
+		idx, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return nil, err
+		}
+		*pos += bytesRead
+		if idx >= uint64(len(cfg.dict)) {
+			return nil, fmt.Errorf("%w: %d", ErrDictIndex, idx)
+		}
+		return cfg.dict[idx], nil
+	case TypeNull: // Null
+		*pos++
+		return nil, nil
+	case TypeExtension: // Registered BinaryMarshaler
+		*pos++
+		name, payload, err := readExtension(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return newRegistered(name, payload)
+	case TypeBool: // Boolean
+		*pos++
+		if err := need(data, *pos, 1, "bool"); err != nil {
+			return nil, err
+		}
+		*pos++
+		switch data[*pos-1] {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		}
+		return nil, fmt.Errorf("%w: %d", ErrInvalidBool, data[*pos-1])
+	case TypeFloat32: // Float32
+		*pos++
+		if err := need(data, *pos, 4, "float32"); err != nil {
+			return nil, err
+		}
+		bits := cfg.Endianness.uint32(data[*pos:])
+		*pos += 4
+		return math.Float32frombits(bits), nil
+	case TypeFloat64: // Float64
+		*pos++
+		if err := need(data, *pos, 8, "float64"); err != nil {
+			return nil, err
+		}
+		bits := cfg.Endianness.uint64(data[*pos:])
+		*pos += 8
+		return math.Float64frombits(bits), nil
+	case TypeComplex128: // Complex128
+		*pos++
+		if err := need(data, *pos, 16, "complex128"); err != nil {
+			return nil, err
+		}
+		re := math.Float64frombits(cfg.Endianness.uint64(data[*pos:]))
+		im := math.Float64frombits(cfg.Endianness.uint64(data[*pos+8:]))
+		*pos += 16
+		return complex(re, im), nil
+	case TypeBigInt: // Arbitrary-precision integer
+		*pos++
+		return decodeBigInt(data, pos, cfg)
+	case TypeIP: // IP address
+		*pos++
+		ip, err := decodeIP(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		return ip, nil
+	case TypeDecimal: // Fixed-point decimal
+		*pos++
+		d, err := decodeDecimal(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	default:
+		codec, ok := customCodec(data[*pos])
+		if !ok {
+			return nil, fmt.Errorf("%w: %c", ErrUnknownType, data[*pos])
+		}
+		*pos++
+		payload, err := readCustom(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Decode(payload)
+	}
+}
+
+// maxVarintLen is the longest varint appendVarint writes: ten 7-bit
+// groups, the last holding only bit 63 of a uint64.
+const maxVarintLen = 10
+
+// appendVarint encodes a uint64 as a compact varint of at most
+// maxVarintLen bytes, least significant group first.
 func appendVarint(buf []byte, x uint64) []byte {
 	for x >= 0x80 {
 		buf = append(buf, byte(x)|0x80)
@@ -155,21 +1162,90 @@ func appendVarint(buf []byte, x uint64) []byte {
 	return append(buf, byte(x))
 }
 
-// readVarint decodes a varint from a byte slice.
+// checkFloat rejects NaN and infinities with ErrNonFiniteFloat when
+// cfg.StrictFloats is set.
+func checkFloat(f float64, cfg *Config) error {
+	if cfg.StrictFloats && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return fmt.Errorf("%w: %v", ErrNonFiniteFloat, f)
+	}
+	return nil
+}
+
+// normalizeInt converts a decoded integer of any width to int64 when
+// cfg.NormalizeInts is set, and returns every other value unchanged.
+func normalizeInt(v interface{}, cfg *Config) (interface{}, error) {
+	if !cfg.NormalizeInts {
+		return v, nil
+	}
+	switch v := v.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("%w for int64: %d", ErrIntOutOfRange, v)
+		}
+		return int64(v), nil
+	}
+	return v, nil
+}
+
+// checkUTF8 rejects s with ErrInvalidUTF8 when cfg.ValidateUTF8 is set.
+func checkUTF8(s string, cfg *Config) error {
+	if cfg.ValidateUTF8 && !utf8.ValidString(s) {
+		return ErrInvalidUTF8
+	}
+	return nil
+}
+
+// zigzag32 maps signed integers to unsigned so small magnitudes of either
+// sign produce short varints.
+func zigzag32(v int32) uint32 {
+	return uint32(v<<1) ^ uint32(v>>31)
+}
+
+// unzigzag32 reverses zigzag32.
+func unzigzag32(u uint32) int32 {
+	return int32(u>>1) ^ -int32(u&1)
+}
+
+// readVarint decodes a varint from a byte slice. Only the minimal encoding
+// written by appendVarint is accepted: a zero final group after other
+// groups is padding and fails with ErrNonCanonicalVarint, so every value
+// has exactly one encoding. Past maxVarintLen bytes a varint fails with
+// ErrVarintTooLong, and a final tenth byte above 1, whose bits would not
+// fit in a uint64, with ErrVarintOverflow, as in encoding/binary.
 func readVarint(data []byte) (uint64, int, error) {
 	var val uint64
 	var shift uint
 	for i, b := range data {
+		if i == maxVarintLen-1 {
+			if b >= 0x80 {
+				return 0, 0, ErrVarintTooLong
+			}
+			if b > 1 {
+				return 0, 0, ErrVarintOverflow
+			}
+		}
 		val |= uint64(b&0x7F) << shift
 		if b < 0x80 {
+			if b == 0 && i > 0 {
+				return 0, 0, ErrNonCanonicalVarint
+			}
 			return val, i + 1, nil
 		}
 		shift += 7
-		if shift > 63 {
-			return 0, 0, errors.New("varint too long")
-		}
 	}
-	return 0, 0, errors.New("unexpected end of data while reading varint")
+	return 0, 0, fmt.Errorf("%w while reading varint", ErrUnexpectedEOF)
 }
 
 // bytesToString performs a zero-copy conversion from []byte to string.
@@ -177,23 +1253,8 @@ func bytesToString(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b))
 }
 
-// Example usage
-func main() {
-	originalData := DataInput{"hello", DataInput{"world", int32(123), DataInput{"Kshitij", "ClickHouse", int32(321)}}, float64(3.14)}
-
-	encoded, err := encode(originalData)
-	if err != nil {
-		fmt.Println("Encoding error:", err)
-		return
-	}
-
-	decoded, err := decode(encoded)
-	if err != nil {
-		fmt.Println("Decoding error:", err)
-		return
-	}
-
-	fmt.Println("Original:", originalData)
-	fmt.Println("Encoded:", encoded)
-	fmt.Println("Decoded:", decoded)
+// stringToBytes reverses bytesToString. The result must not be modified
+// unless s itself came from bytesToString on a mutable slice.
+func stringToBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
 }
@@ -0,0 +1,1218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestEncodeConcurrent encodes distinct values from many goroutines at once
+// and checks that no result shares memory with another through the buffer
+// pool: every message must still decode to its own input after all the
+// others have been written.
+func TestEncodeConcurrent(t *testing.T) {
+	const goroutines, rounds = 32, 50
+
+	type result struct {
+		in  DataInput
+		out []byte
+	}
+	results := make([][]result, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				in := DataInput{fmt.Sprintf("goroutine %d round %d", g, r), int32(g*rounds + r), DataInput{float64(r), bytes.Repeat([]byte{byte(g)}, r)}}
+				out, err := encode(in)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[g] = append(results[g], result{in, out})
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g, rs := range results {
+		for r, res := range rs {
+			want, err := encode(res.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(res.out, want) {
+				t.Fatalf("goroutine %d round %d: bytes changed after encode returned:\n got %x\nwant %x", g, r, res.out, want)
+			}
+			got, err := decode(res.out)
+			if err != nil {
+				t.Fatalf("goroutine %d round %d: %v", g, r, err)
+			}
+			if !got.Equal(res.in) {
+				t.Fatalf("goroutine %d round %d: decoded %v, want %v", g, r, got, res.in)
+			}
+		}
+	}
+}
+
+// nestedMessage returns a message of depth arrays nested one inside the
+// other, built byte by byte so it does not depend on encode.
+func nestedMessage(depth int) []byte {
+	b := append(magic[:len(magic):len(magic)], Version)
+	for i := 1; i < depth; i++ {
+		b = append(b, byte(TypeArray), 1)
+	}
+	return append(b, byte(TypeArray), 0)
+}
+
+// TestNestingThousandsDeep checks that input nested far past MaxDepth fails
+// cleanly with ErrMaxDepth from every decoding entry point and from encode,
+// instead of overflowing the stack.
+func TestNestingThousandsDeep(t *testing.T) {
+	const depth = 100000
+	data := nestedMessage(depth)
+
+	if _, err := decode(data); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("decode: got %v, want ErrMaxDepth", err)
+	}
+	if err := Validate(data); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Validate: got %v, want ErrMaxDepth", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(data)).Decode(); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Decoder: got %v, want ErrMaxDepth", err)
+	}
+	s := NewScanner(data)
+	for s.Scan() {
+	}
+	if !errors.Is(s.Err(), ErrMaxDepth) {
+		t.Errorf("Scanner: got %v, want ErrMaxDepth", s.Err())
+	}
+
+	nested := DataInput{}
+	for i := 1; i < depth; i++ {
+		nested = DataInput{nested}
+	}
+	if _, err := encode(nested); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("encode: got %v, want ErrMaxDepth", err)
+	}
+
+	// Exactly MaxDepth levels is still accepted.
+	if _, err := decode(nestedMessage(DefaultConfig.MaxDepth)); err != nil {
+		t.Errorf("decode at MaxDepth: %v", err)
+	}
+	if _, err := decode(nestedMessage(DefaultConfig.MaxDepth + 1)); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("decode at MaxDepth+1: got %v, want ErrMaxDepth", err)
+	}
+}
+
+// decodeRecursive is a straightforward recursive decoder for messages in
+// the plain encoding that encode writes by default, kept as a reference
+// for the iterative decodeValue.
+func decodeRecursive(data []byte, pos *int, depth int, cfg *Config) (interface{}, error) {
+	switch Type(data[*pos]) {
+	case TypeArray:
+		n, err := readArrayLen(data, pos, depth, cfg)
+		if err != nil {
+			return nil, err
+		}
+		d := make(DataInput, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := decodeRecursive(data, pos, depth+1, cfg)
+			if err != nil {
+				return nil, err
+			}
+			d = append(d, v)
+		}
+		return d, nil
+	case TypeMap:
+		n, err := readMapLen(data, pos, depth, cfg)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := readRawString(data, pos, cfg)
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = decodeRecursive(data, pos, depth+1, cfg); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return decodeScalar(data, pos, cfg)
+}
+
+// TestIterativeMatchesRecursive checks decode against decodeRecursive over
+// randomized nested messages.
+func TestIterativeMatchesRecursive(t *testing.T) {
+	r := rand.New(rand.NewSource(24))
+	cfg := DefaultConfig.withDefaults()
+	for i := 0; i < 2000; i++ {
+		in := randomArray(r, 5)
+		data, err := encode(in)
+		if err != nil {
+			t.Fatalf("%v: %v", in, err)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatalf("%v: %v", in, err)
+		}
+		pos := headerLen
+		want, err := decodeRecursive(data, &pos, 1, cfg)
+		if err != nil {
+			t.Fatalf("%v: recursive: %v", in, err)
+		}
+		if !got.Equal(want.(DataInput)) {
+			t.Fatalf("iterative %v, recursive %v", got, want)
+		}
+	}
+}
+
+// TestDecodeConstantStack decodes a message nested 100000 levels deep with
+// the goroutine stack capped far below what a recursive decoder would need.
+// Exceeding the cap is a fatal error, so this test failing crashes the run.
+func TestDecodeConstantStack(t *testing.T) {
+	const depth = 100000
+	data := nestedMessage(depth)
+	cfg := DefaultConfig
+	cfg.MaxDepth = depth
+
+	old := debug.SetMaxStack(256 << 10)
+	defer debug.SetMaxStack(old)
+	d, err := DecodeWithConfig(data, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < depth; i++ {
+		d = d[0].(DataInput)
+	}
+	if len(d) != 0 {
+		t.Fatalf("innermost array has %d elements, want 0", len(d))
+	}
+}
+
+// BenchmarkDecodeNested decodes ever deeper nesting. Time and allocations
+// grow linearly with depth while stack use stays constant, as
+// TestDecodeConstantStack checks.
+func BenchmarkDecodeNested(b *testing.B) {
+	for _, depth := range []int{16, 256, 4096, 65536} {
+		data := nestedMessage(depth)
+		cfg := DefaultConfig
+		cfg.MaxDepth = depth
+		b.Run(fmt.Sprint(depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := DecodeWithConfig(data, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// roundTrip encodes in, checks it decodes back to an equal value and
+// returns the encoded bytes.
+func roundTrip(t *testing.T, in DataInput) []byte {
+	t.Helper()
+	data, err := encode(in)
+	if err != nil {
+		t.Fatalf("encode %v: %v", in, err)
+	}
+	got, err := decode(data)
+	if err != nil {
+		t.Fatalf("decode %v: %v", in, err)
+	}
+	if !got.Equal(in) {
+		t.Fatalf("got %v, want %v", got, in)
+	}
+	return data
+}
+
+func TestInt64(t *testing.T) {
+	for _, v := range []int64{math.MinInt64, math.MaxInt64, -1, 0, 1, -1 << 40, math.MaxInt32 + 1} {
+		data := roundTrip(t, DataInput{v})
+		if Type(data[headerLen+2]) != TypeInt64 || len(data) != headerLen+3+8 {
+			t.Errorf("%d encoded as %x, want 'L' and 8 bytes", v, data[headerLen:])
+		}
+		if _, err := decode(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("%d truncated: got %v, want ErrUnexpectedEOF", v, err)
+		}
+	}
+	data := roundTrip(t, DataInput{int64(-2)})
+	if want := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}; !bytes.Equal(data[headerLen+3:], want) {
+		t.Errorf("int64(-2) payload %x, want big-endian %x", data[headerLen+3:], want)
+	}
+}
+
+func TestBool(t *testing.T) {
+	data := roundTrip(t, DataInput{true, false})
+	if want := []byte{byte(TypeBool), 1, byte(TypeBool), 0}; !bytes.Equal(data[headerLen+2:], want) {
+		t.Errorf("encoded as %x, want %x", data[headerLen+2:], want)
+	}
+	data[headerLen+3] = 2
+	if _, err := decode(data); !errors.Is(err, ErrInvalidBool) {
+		t.Errorf("bool byte 2: got %v, want ErrInvalidBool", err)
+	}
+	if err := Validate(data); !errors.Is(err, ErrInvalidBool) {
+		t.Errorf("Validate of bool byte 2: got %v, want ErrInvalidBool", err)
+	}
+}
+
+func TestNil(t *testing.T) {
+	tests := []DataInput{
+		{nil},
+		{nil, nil},
+		{DataInput{nil, DataInput{nil}}},
+		{"a", nil, int32(1), nil, DataInput{nil, 2.5}, map[string]interface{}{"k": nil}},
+	}
+	for _, in := range tests {
+		roundTrip(t, in)
+	}
+
+	got, err := decode(roundTrip(t, DataInput{nil, DataInput{nil}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != nil || got[1].(DataInput)[0] != nil {
+		t.Errorf("decoded nils are not untyped nil: %#v", got)
+	}
+}
+
+// TestDecodeSafeCopies overwrites the input after decoding and checks the
+// DecodeSafe result is unchanged while the zero-copy decode result is not.
+func TestDecodeSafeCopies(t *testing.T) {
+	in := DataInput{"hello", []byte{1, 2, 3}, DataInput{"nested"}, map[string]interface{}{"k": "value"}}
+	data := roundTrip(t, in)
+
+	safe, err := DecodeSafe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := headerLen; i < len(data); i++ {
+		data[i] = 'z'
+	}
+	if !safe.Equal(in) {
+		t.Errorf("DecodeSafe result changed with its input: %v", safe)
+	}
+	if fast.Equal(in) {
+		t.Error("decode result did not alias its input; DecodeSafe is untested")
+	}
+}
+
+func TestUint64(t *testing.T) {
+	for _, v := range []uint64{0, 1, 1 << 63, 1<<63 + 1, math.MaxUint64} {
+		data := roundTrip(t, DataInput{v})
+		if got := Type(data[headerLen+2]); got != TypeUint64 {
+			t.Errorf("%d encoded as %v, want TypeUint64", v, got)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0] != v {
+			t.Errorf("got %v (%T), want %d", got[0], got[0], v)
+		}
+		if _, err := decode(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("truncated %d: got %v, want ErrUnexpectedEOF", v, err)
+		}
+	}
+}
+
+func TestFloat32(t *testing.T) {
+	nan := float32(math.NaN())
+	for _, v := range []float32{0, float32(math.Inf(1)), float32(math.Inf(-1)), nan, math.MaxFloat32, math.SmallestNonzeroFloat32} {
+		data := roundTrip(t, DataInput{v})
+		if got := Type(data[headerLen+2]); got != TypeFloat32 || len(data) != headerLen+3+4 {
+			t.Errorf("%v encoded as %v in %d bytes, want TypeFloat32 in %d", v, got, len(data), headerLen+3+4)
+		}
+	}
+
+	// 0.1 is not exactly representable in float32: the decoded value must be
+	// the same rounded float32, not widened back towards the float64 0.1.
+	got, err := decode(roundTrip(t, DataInput{float32(0.1)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := got[0].(float32)
+	if !ok || f != float32(0.1) || float64(f) == 0.1 {
+		t.Errorf("got %v (%T), want float32(0.1)", got[0], got[0])
+	}
+	if got.Equal(DataInput{0.1}) {
+		t.Error("float32(0.1) equals float64 0.1")
+	}
+}
+
+func TestTime(t *testing.T) {
+	known := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		in   time.Time
+	}{
+		{"zero", time.Time{}},
+		{"epoch", time.Unix(0, 0)},
+		{"pre-1970", time.Date(1969, 7, 20, 20, 17, 40, 123456789, time.UTC)},
+		{"known instant", known},
+		{"other zone", known.In(time.FixedZone("UTC+5", 5*3600))},
+		{"monotonic", time.Now()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decode(roundTrip(t, DataInput{tt.in}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tm := got[0].(time.Time)
+			if tt.in.IsZero() {
+				if !tm.IsZero() {
+					t.Errorf("zero time decoded as %v", tm)
+				}
+				return
+			}
+			if tm.Location() != time.UTC || tm != tm.Round(0) {
+				t.Errorf("decoded %v is not a UTC time without a monotonic reading", tm)
+			}
+		})
+	}
+
+	data := roundTrip(t, DataInput{known})
+	if want := []byte{0x11, 0x74, 0xef, 0xed, 0xab, 0x18, 0x60, 0x00}; !bytes.Equal(data[headerLen+3:], want) {
+		t.Errorf("%v encoded as %x, want %x", known, data[headerLen+3:], want)
+	}
+
+	if _, err := encode(DataInput{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)}); !errors.Is(err, ErrTimeOutOfRange) {
+		t.Errorf("year 3000: got %v, want ErrTimeOutOfRange", err)
+	}
+}
+
+func TestBlob(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, b := range [][]byte{{}, {0}, {0, 0, 0}, {0xff, 0xfe, 0x80}, all} {
+		data := roundTrip(t, DataInput{b})
+		if got := Type(data[headerLen+2]); got != TypeBlob {
+			t.Errorf("%x encoded as %v, want TypeBlob", b, got)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := got[0].([]byte); !ok {
+			t.Errorf("%x decoded as %T, want []byte", b, got[0])
+		}
+	}
+
+	if _, err := EncodeWithConfig(DataInput{all}, Config{MaxBlobLen: 255}); !errors.Is(err, ErrBlobTooLong) {
+		t.Errorf("encode above MaxBlobLen: got %v, want ErrBlobTooLong", err)
+	}
+	if _, err := DecodeWithConfig(roundTrip(t, DataInput{all}), Config{MaxBlobLen: 255}); !errors.Is(err, ErrBlobTooLong) {
+		t.Errorf("decode above MaxBlobLen: got %v, want ErrBlobTooLong", err)
+	}
+}
+
+// TestDecodeContextCancelled checks DecodeContext returns the context's
+// error, both when it is cancelled before decoding starts and when its
+// deadline passes partway through a large message.
+func TestDecodeContextCancelled(t *testing.T) {
+	big := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range big {
+		inner := make(DataInput, DefaultConfig.MaxArrayLen)
+		for j := range inner {
+			inner[j] = int32(j)
+		}
+		big[i] = inner
+	}
+	data := roundTrip(t, big)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DecodeContext(ctx, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context: got %v, want context.Canceled", err)
+	}
+
+	// A context that reports cancellation after its first check shows the
+	// decode polls it partway through instead of running to the end.
+	ctx = &cancelAfter{Context: context.Background(), n: 1}
+	if _, err := DecodeContext(ctx, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled while decoding: got %v, want context.Canceled", err)
+	}
+	if checks := ctx.(*cancelAfter).checks; checks < 2 || checks > 3 {
+		t.Errorf("context checked %d times, want decoding to stop at the first check after cancellation", checks)
+	}
+
+	if got, err := DecodeContext(context.Background(), data); err != nil || len(got) != len(big) {
+		t.Errorf("live context: %d elements, %v", len(got), err)
+	}
+}
+
+// cancelAfter is a Context whose Err starts returning context.Canceled
+// after n calls.
+type cancelAfter struct {
+	context.Context
+	n, checks int
+}
+
+func (c *cancelAfter) Err() error {
+	c.checks++
+	if c.checks > c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestNarrowInts(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		id   Type
+		size int
+	}{
+		{int8(math.MinInt8), TypeInt8, 1},
+		{int8(-1), TypeInt8, 1},
+		{int8(math.MaxInt8), TypeInt8, 1},
+		{int16(math.MinInt16), TypeInt16, 2},
+		{int16(-2), TypeInt16, 2},
+		{int16(math.MaxInt16), TypeInt16, 2},
+	}
+	for _, tt := range tests {
+		data := roundTrip(t, DataInput{tt.v})
+		if got := Type(data[headerLen+2]); got != tt.id || len(data) != headerLen+3+tt.size {
+			t.Errorf("%v encoded as %v in %d bytes, want %v in %d", tt.v, got, len(data), tt.id, headerLen+3+tt.size)
+		}
+		if _, err := decode(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("truncated %v: got %v, want ErrUnexpectedEOF", tt.v, err)
+		}
+	}
+	if data := roundTrip(t, DataInput{int16(-2)}); !bytes.Equal(data[headerLen+3:], []byte{0xff, 0xfe}) {
+		t.Errorf("int16(-2) payload %x, want big-endian fffe", data[headerLen+3:])
+	}
+}
+
+func TestNarrowUints(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		id   Type
+		size int
+	}{
+		{uint8(0), TypeUint8, 1},
+		{uint8(math.MaxUint8), TypeUint8, 1},
+		{uint16(math.MaxUint16), TypeUint16, 2},
+		{uint32(math.MaxUint32), TypeUint32, 4},
+		{uint32(1 << 31), TypeUint32, 4},
+	}
+	for _, tt := range tests {
+		data := roundTrip(t, DataInput{tt.v})
+		if got := Type(data[headerLen+2]); got != tt.id || len(data) != headerLen+3+tt.size {
+			t.Errorf("%v encoded as %v in %d bytes, want %v in %d", tt.v, got, len(data), tt.id, headerLen+3+tt.size)
+		}
+		if _, err := decode(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("truncated %v: got %v, want ErrUnexpectedEOF", tt.v, err)
+		}
+	}
+}
+
+func TestEncodeWithHint(t *testing.T) {
+	in := largePayload()
+	want := roundTrip(t, in)
+	for _, hint := range []int{-1, 0, 1, len(want) / 2, len(want), 2 * len(want)} {
+		got, err := EncodeWithHint(in, hint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("hint %d: output differs from encode", hint)
+		}
+	}
+	if n := testing.AllocsPerRun(5, func() { EncodeWithHint(in, len(want)) }); n != 1 {
+		t.Errorf("exact hint: %v allocations, want 1", n)
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	in := DataInput{"a", int32(1)}
+	data := roundTrip(t, in)
+	trailing := append(bytes.Clone(data), 0, 'x')
+
+	_, err := decode(trailing)
+	var de *DecodeError
+	if !errors.Is(err, ErrTrailingData) || !errors.As(err, &de) || de.Offset != len(data) {
+		t.Errorf("trailing bytes: got %v, want ErrTrailingData at offset %d", err, len(data))
+	}
+	if err := Validate(trailing); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("Validate: got %v, want ErrTrailingData", err)
+	}
+
+	got, err := DecodeWithConfig(trailing, Config{AllowTrailingData: true})
+	if err != nil {
+		t.Fatalf("AllowTrailingData: %v", err)
+	}
+	if !got.Equal(in) {
+		t.Errorf("AllowTrailingData: got %v, want %v", got, in)
+	}
+
+	// Two messages back to back are trailing data to a strict decode.
+	if _, err := decode(append(bytes.Clone(data), data...)); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("concatenated messages: got %v, want ErrTrailingData", err)
+	}
+}
+
+// TestEmptyArrays checks that empty arrays decode to a non-nil DataInput{}
+// at the top level and nested, through each decoding path, and that a nil
+// DataInput encodes the same as an empty one.
+func TestEmptyArrays(t *testing.T) {
+	empty := roundTrip(t, DataInput{})
+	if want := []byte{byte(TypeArray), 0}; !bytes.Equal(empty[headerLen:], want) {
+		t.Errorf("DataInput{} encoded as %x, want %x", empty[headerLen:], want)
+	}
+	null, err := encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(null, empty) {
+		t.Errorf("nil encoded as %x, want %x", null, empty)
+	}
+
+	nested := roundTrip(t, DataInput{DataInput{}, nil, DataInput(nil), DataInput{DataInput{}}})
+	decoders := []struct {
+		name   string
+		decode func([]byte) (DataInput, error)
+	}{
+		{"decode", decode},
+		{"DecodeSafe", DecodeSafe},
+		{"Decoder", func(data []byte) (DataInput, error) { return NewDecoder(bytes.NewReader(data)).Decode() }},
+	}
+	for _, d := range decoders {
+		got, err := d.decode(empty)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		if got == nil || len(got) != 0 {
+			t.Errorf("%s of an empty array: got %#v, want DataInput{}", d.name, got)
+		}
+
+		got, err = d.decode(nested)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		for _, i := range []int{0, 2} {
+			if a, ok := got[i].(DataInput); !ok || a == nil || len(a) != 0 {
+				t.Errorf("%s of nested empty array %d: got %#v, want DataInput{}", d.name, i, got[i])
+			}
+		}
+		if got[1] != nil {
+			t.Errorf("%s: untyped nil decoded as %#v", d.name, got[1])
+		}
+		if a := got[3].(DataInput)[0].(DataInput); a == nil || len(a) != 0 {
+			t.Errorf("%s of doubly nested empty array: got %#v", d.name, a)
+		}
+	}
+}
+
+// TestEmptyStringsAndBlobs checks that empty strings and blobs decode to ""
+// and a non-nil []byte{} at the top level and nested, through each decoding
+// path, and that the empty blob shares no memory with the input.
+func TestEmptyStringsAndBlobs(t *testing.T) {
+	str := roundTrip(t, DataInput{""})
+	if want := []byte{byte(TypeArray), 1, byte(TypeString), 0}; !bytes.Equal(str[headerLen:], want) {
+		t.Errorf(`"" encoded as %x, want %x`, str[headerLen:], want)
+	}
+	blob := roundTrip(t, DataInput{[]byte{}})
+	if want := []byte{byte(TypeArray), 1, byte(TypeBlob), 0}; !bytes.Equal(blob[headerLen:], want) {
+		t.Errorf("[]byte{} encoded as %x, want %x", blob[headerLen:], want)
+	}
+	nested := roundTrip(t, DataInput{"", []byte{}, DataInput{"", DataInput{[]byte{}, ""}}, "x"})
+
+	var arena StringArena
+	decoders := []struct {
+		name   string
+		decode func([]byte) (DataInput, error)
+	}{
+		{"decode", decode},
+		{"DecodeSafe", DecodeSafe},
+		{"DecodeInArena", func(data []byte) (DataInput, error) { return DecodeInArena(data, &arena) }},
+		{"Decoder", func(data []byte) (DataInput, error) { return NewDecoder(bytes.NewReader(data)).Decode() }},
+	}
+	checkBlob := func(name string, v interface{}) {
+		t.Helper()
+		if b, ok := v.([]byte); !ok || b == nil || len(b) != 0 || cap(b) != 0 {
+			t.Errorf("%s: got %#v, want a non-nil []byte{} with no capacity", name, v)
+		}
+	}
+	for _, d := range decoders {
+		// The length byte of each empty value is the last byte of the
+		// message, so there is nothing after it to alias.
+		got, err := d.decode(str)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		if got[0] != "" {
+			t.Errorf("%s of an empty string: got %#v", d.name, got[0])
+		}
+		got, err = d.decode(blob)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		checkBlob(d.name+" of an empty blob", got[0])
+
+		got, err = d.decode(nested)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		inner := got[2].(DataInput)
+		innermost := inner[1].(DataInput)
+		if got[0] != "" || inner[0] != "" || innermost[1] != "" || got[3] != "x" {
+			t.Errorf("%s of nested empty strings: got %#v", d.name, got)
+		}
+		checkBlob(d.name+" of a nested empty blob", got[1])
+		checkBlob(d.name+" of a doubly nested empty blob", innermost[0])
+	}
+
+	// Appending to a decoded empty blob must not write into the input.
+	got, err := decode(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := bytes.Clone(nested)
+	_ = append(got[1].([]byte), 0xff, 0xff, 0xff, 0xff)
+	if !bytes.Equal(nested, kept) {
+		t.Error("appending to a decoded empty blob changed the input")
+	}
+}
+
+func TestLengthFits(t *testing.T) {
+	data := make([]byte, 10)
+	tests := []struct {
+		count   uint64
+		pos     int
+		minSize int
+		want    bool
+	}{
+		{10, 0, 1, true},
+		{11, 0, 1, false},
+		{5, 0, 2, true},
+		{6, 0, 2, false},
+		{0, 10, 1, true},
+		{1, 10, 1, false},
+		{math.MaxUint64, 0, 1, false},
+		{math.MaxUint64 / 2, 0, 2, false},
+	}
+	for _, tt := range tests {
+		if got := lengthFits(tt.count, data, tt.pos, tt.minSize); got != tt.want {
+			t.Errorf("lengthFits(%d, %d bytes, %d, %d) = %t, want %t", tt.count, len(data), tt.pos, tt.minSize, got, tt.want)
+		}
+	}
+}
+
+// TestHugeDeclaredLength decodes tiny messages declaring enormous lengths
+// under limits high enough to admit them, and checks each fails with
+// ErrUnexpectedEOF without allocating for the declared length.
+func TestHugeDeclaredLength(t *testing.T) {
+	huge := appendVarint(nil, 1<<40)
+	cfg := Config{
+		MaxArrayLen:  math.MaxInt,
+		MaxStringLen: math.MaxInt,
+		MaxBlobLen:   math.MaxInt,
+		MaxMapLen:    math.MaxInt,
+	}
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"array", append([]byte{byte(TypeArray)}, huge...)},
+		{"nested array", append([]byte{byte(TypeArray), 1, byte(TypeArray)}, huge...)},
+		{"map", append([]byte{byte(TypeArray), 1, byte(TypeMap)}, huge...)},
+		{"string", append([]byte{byte(TypeArray), 1, byte(TypeString)}, huge...)},
+		{"blob", append([]byte{byte(TypeArray), 1, byte(TypeBlob)}, huge...)},
+		{"delta array", append([]byte{byte(TypeArray), 1, byte(TypeDeltaArray)}, huge...)},
+		{"string array", append([]byte{byte(TypeArray), 1, byte(TypeStringArray)}, huge...)},
+		{"dictionary", append([]byte{byte(TypeDict)}, appendVarint(nil, maxDictLen)...)},
+	}
+	for _, tt := range tests {
+		data := message(append(tt.body, 0, 0, 0, 0)...)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := DecodeWithConfig(data, cfg)
+		runtime.ReadMemStats(&after)
+		if !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v, want ErrUnexpectedEOF", tt.name, err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<16 {
+			t.Errorf("%s: allocated %d bytes for a %d-byte message", tt.name, n, len(data))
+		}
+	}
+}
+
+func TestComplex128(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, v := range []complex128{0, complex(1.5, -2), complex(math.MaxFloat64, math.SmallestNonzeroFloat64),
+		complex(nan, 1), complex(1, nan), complex(inf, -inf), complex(math.Copysign(0, -1), 0)} {
+		data := roundTrip(t, DataInput{v})
+		if Type(data[headerLen+2]) != TypeComplex128 || len(data) != headerLen+3+16 {
+			t.Errorf("%v encoded as %x, want 'C' and 16 bytes", v, data[headerLen:])
+		}
+		// Each half has the float64 layout.
+		re, _ := encode(DataInput{real(v)})
+		im, _ := encode(DataInput{imag(v)})
+		if !bytes.Equal(data[headerLen+3:], append(re[headerLen+3:], im[headerLen+3:]...)) {
+			t.Errorf("%v: payload %x is not two float64s", v, data[headerLen+3:])
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := got[0].(complex128)
+		if math.Float64bits(real(c)) != math.Float64bits(real(v)) || math.Float64bits(imag(c)) != math.Float64bits(imag(v)) {
+			t.Errorf("%v decoded with different bits: %v", v, c)
+		}
+		if _, err := decode(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("%v truncated: got %v, want ErrUnexpectedEOF", v, err)
+		}
+	}
+}
+
+func TestEncodeTo(t *testing.T) {
+	msgs := []DataInput{{"first"}, {int32(2), DataInput{"nested"}}, {}}
+	buf := []byte("prefix")
+	var offsets []int
+	for _, m := range msgs {
+		offsets = append(offsets, len(buf))
+		var err error
+		if buf, err = EncodeTo(buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(buf[:6]) != "prefix" {
+		t.Errorf("prefix overwritten: %q", buf[:6])
+	}
+	offsets = append(offsets, len(buf))
+	for i, m := range msgs {
+		want := roundTrip(t, m)
+		if got := buf[offsets[i]:offsets[i+1]]; !bytes.Equal(got, want) {
+			t.Errorf("message %d: %x, want %x", i, got, want)
+		}
+	}
+
+	// A failed encode leaves buf as it was, even with spare capacity.
+	before := bytes.Clone(buf)
+	got, err := EncodeTo(buf, DataInput{make(chan int)})
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("got %v, want ErrUnsupportedType", err)
+	}
+	if !bytes.Equal(got, before) {
+		t.Errorf("failed encode returned %x, want %x", got, before)
+	}
+
+	// With enough capacity, nothing is allocated.
+	in := DataInput{"a", int32(1), 2.5}
+	dst := make([]byte, 0, 64)
+	if n := testing.AllocsPerRun(10, func() { EncodeTo(dst, in) }); n != 0 {
+		t.Errorf("%v allocations into a large enough buffer, want 0", n)
+	}
+}
+
+// TestDecodeReuse decodes messages of changing shapes into the same
+// DataInput, checking each result and that matching arrays are reused.
+func TestDecodeReuse(t *testing.T) {
+	msgs := []DataInput{
+		{"a", DataInput{int32(1), int32(2)}, 1.5},
+		{"b", DataInput{int32(3), int32(4)}, 2.5},                             // Same shape
+		{"c", DataInput{int32(5), int32(6), int32(7), int32(8)}, 3.5, "more"}, // Longer arrays
+		{DataInput{"swapped"}, "x"},                                           // Array and scalar swapped
+		{},
+		{map[string]interface{}{"k": DataInput{"v"}}, DataInput{nil}},
+	}
+	var dst DataInput
+	for i, m := range msgs {
+		prev := dst
+		if err := DecodeReuse(roundTrip(t, m), &dst); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !dst.Equal(m) {
+			t.Fatalf("message %d: got %v, want %v", i, dst, m)
+		}
+		if i == 1 {
+			if &dst[0] != &prev[0] || &dst[1].(DataInput)[0] != &prev[1].(DataInput)[0] {
+				t.Error("same-shaped message did not reuse the arrays")
+			}
+		}
+	}
+
+	// A failed decode leaves *dst as it was.
+	before := dst
+	if err := DecodeReuse(message('A', 1, '?'), &dst); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("got %v, want ErrUnknownType", err)
+	}
+	if len(dst) != len(before) || &dst[:1][0] != &before[:1][0] {
+		t.Error("failed decode replaced *dst")
+	}
+
+	// Repeated same-shaped decodes allocate less than decode.
+	data := roundTrip(t, msgs[0])
+	dst = nil
+	reuse := testing.AllocsPerRun(20, func() { DecodeReuse(data, &dst) })
+	fresh := testing.AllocsPerRun(20, func() { decode(data) })
+	if reuse >= fresh {
+		t.Errorf("DecodeReuse: %v allocations, decode: %v", reuse, fresh)
+	}
+}
+
+func BenchmarkDecodeReuse(b *testing.B) {
+	in := make(DataInput, 100)
+	for i := range in {
+		in[i] = DataInput{int32(i), DataInput{float64(i), true}}
+	}
+	data, err := encode(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decode(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("DecodeReuse", func(b *testing.B) {
+		b.ReportAllocs()
+		var dst DataInput
+		for i := 0; i < b.N; i++ {
+			if err := DecodeReuse(data, &dst); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestDecodeAt walks a buffer of three back-to-back messages, one with a
+// checksum, by advancing the returned position.
+func TestDecodeAt(t *testing.T) {
+	msgs := []DataInput{{"first", int32(1)}, {DataInput{"second"}}, {}}
+	var buf []byte
+	for i, m := range msgs {
+		data, err := EncodeWithConfig(m, Config{Checksum: i == 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = append(buf, data...)
+	}
+
+	pos := 0
+	for i, want := range msgs {
+		got, next, err := DecodeAt(buf, pos)
+		if err != nil {
+			t.Fatalf("message %d at %d: %v", i, pos, err)
+		}
+		if !got.Equal(want) || next <= pos {
+			t.Fatalf("message %d: got %v and position %d, want %v after %d", i, got, next, want, pos)
+		}
+		pos = next
+	}
+	if pos != len(buf) {
+		t.Errorf("ended at %d of %d bytes", pos, len(buf))
+	}
+	if _, next, err := DecodeAt(buf, pos); !errors.Is(err, ErrEmptyInput) || next != pos {
+		t.Errorf("at the end: got %v, %d; want ErrEmptyInput, %d", err, next, pos)
+	}
+
+	// Errors return the starting position, with offsets into the whole buffer.
+	second := len(roundTrip(t, msgs[0]))
+	bad := bytes.Clone(buf)
+	bad[second+headerLen+2] = '?' // The second message's nested array identifier
+	_, next, err := DecodeAt(bad, second)
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrUnknownType) || de.Offset != second+headerLen+2 || next != second {
+		t.Errorf("corrupt message: got %v at position %d", err, next)
+	}
+	bad = bytes.Clone(buf)
+	bad[second+headerLen+7] ^= 1 // Inside the string, so only the checksum catches it
+	if _, _, err := DecodeAt(bad, second); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("corrupt checksummed message: got %v, want ErrChecksumMismatch", err)
+	}
+	for _, p := range []int{-1, len(buf) + 1} {
+		if _, next, err := DecodeAt(buf, p); !errors.Is(err, ErrUnexpectedEOF) || next != p {
+			t.Errorf("position %d: got %v, %d", p, err, next)
+		}
+	}
+	if _, _, err := DecodeAt(buf, 1); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("mid-message position: got %v, want ErrBadMagic", err)
+	}
+}
+
+func TestReadLength(t *testing.T) {
+	data := append(appendVarint(nil, 3), "abcd"...)
+	tests := []struct {
+		data []byte
+		max  int
+		want error
+	}{
+		{data, 3, nil},
+		{data, 2, ErrStringTooLong},
+		{data[:3], 3, ErrUnexpectedEOF},
+		{nil, 3, ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		pos := 0
+		n, err := readLength(tt.data, &pos, tt.max, ErrStringTooLong, "test")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%x with max %d: got %v, want %v", tt.data, tt.max, err, tt.want)
+		}
+		if err == nil && (n != 3 || pos != 1) {
+			t.Errorf("%x: got length %d at %d, want 3 at 1", tt.data, n, pos)
+		}
+		if err != nil && pos != 0 {
+			t.Errorf("%x: failed read advanced to %d", tt.data, pos)
+		}
+	}
+}
+
+// TestLengthLimits checks every length-prefixed type against its limit:
+// each input decodes with the limit set to its length and fails with the
+// limit one below, reporting both through a LimitError.
+func TestLengthLimits(t *testing.T) {
+	registerTestDuration(t)
+	registerUUID.Do(func() {
+		RegisterType("test.uuid", func() encoding.BinaryUnmarshaler { return new(testUUID) })
+	})
+	tests := []struct {
+		name  string
+		in    DataInput
+		enc   Config
+		limit func(n int) Config
+		n     int
+		want  error
+	}{
+		{"string", DataInput{"hello"}, Config{}, func(n int) Config { return Config{MaxStringLen: n} }, 5, ErrStringTooLong},
+		{"map key", DataInput{map[string]interface{}{"hello": nil}}, Config{}, func(n int) Config { return Config{MaxStringLen: n} }, 5, ErrStringTooLong},
+		{"dictionary entry", DataInput{"hello", "hello"}, Config{DictStrings: true}, func(n int) Config { return Config{MaxStringLen: n} }, 5, ErrStringTooLong},
+		{"string array", DataInput{"a", "hello"}, Config{StringArrays: true}, func(n int) Config { return Config{MaxStringLen: n} }, 5, ErrStringTooLong},
+		{"blob", DataInput{[]byte("hello")}, Config{}, func(n int) Config { return Config{MaxBlobLen: n} }, 5, ErrBlobTooLong},
+		{"custom payload", DataInput{time.Duration(1)}, Config{}, func(n int) Config { return Config{MaxBlobLen: n} }, 8, ErrBlobTooLong},
+		{"extension name", DataInput{testUUID{}}, Config{}, func(n int) Config { return Config{MaxStringLen: n} }, len("test.uuid"), ErrStringTooLong},
+		{"extension payload", DataInput{testUUID{}}, Config{}, func(n int) Config { return Config{MaxBlobLen: n} }, 16, ErrBlobTooLong},
+		{"big.Int", DataInput{big.NewInt(1 << 40)}, Config{}, func(n int) Config { return Config{MaxBigIntLen: n} }, 6, ErrBigIntTooLong},
+		{"decimal", DataInput{NewDecimal(1<<40, 2)}, Config{}, func(n int) Config { return Config{MaxBigIntLen: n} }, 6, ErrBigIntTooLong},
+	}
+	for _, tt := range tests {
+		data, err := EncodeWithConfig(tt.in, tt.enc)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, err := DecodeWithConfig(data, tt.limit(tt.n)); err != nil {
+			t.Errorf("%s at its limit: %v", tt.name, err)
+		}
+		below := tt.limit(tt.n - 1)
+		_, err = DecodeWithConfig(data, below)
+		var le *LimitError
+		if !errors.Is(err, tt.want) || !errors.As(err, &le) || le.Limit != tt.n-1 || le.Actual != uint64(tt.n) {
+			t.Errorf("%s below its limit: got %v, want %v (%d > %d)", tt.name, err, tt.want, tt.n, tt.n-1)
+		}
+		if err := validate(data, below.withDefaults()); !errors.Is(err, tt.want) {
+			t.Errorf("%s: validate got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestPlainInt checks a plain int encodes exactly as the same int64 and
+// decodes back as int64.
+func TestPlainInt(t *testing.T) {
+	for _, v := range []int{0, 42, -1, math.MaxInt, math.MinInt} {
+		for _, cfg := range []Config{{}, {VarintInts: true}} {
+			got, err := EncodeWithConfig(DataInput{v}, cfg)
+			if err != nil {
+				t.Fatalf("%d: %v", v, err)
+			}
+			want, err := EncodeWithConfig(DataInput{int64(v)}, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("int %d encoded as %x, int64 as %x", v, got, want)
+			}
+			d, err := DecodeWithConfig(got, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d[0] != int64(v) {
+				t.Errorf("int %d decoded as %#v, want int64", v, d[0])
+			}
+		}
+	}
+	if n, err := EncodedSize(DataInput{42}); err != nil || n != len(roundTrip(t, DataInput{int64(42)})) {
+		t.Errorf("EncodedSize of an int = %d, %v", n, err)
+	}
+}
+
+// TestOptimizeIntegers checks OptimizeIntegers writes each int64 as a varint
+// exactly when that is shorter than 8 fixed bytes, and that every
+// magnitude decodes back as the same int64.
+func TestOptimizeIntegers(t *testing.T) {
+	optimize := Config{OptimizeIntegers: true}
+	tests := []struct {
+		v    int64
+		size int // Encoded bytes after the identifier
+	}{
+		{0, 1},
+		{1, 1},
+		{-1, 1},
+		{63, 1},
+		{-64, 1},
+		{64, 2},
+		{-65, 2},
+		{1 << 19, 3},
+		{-1 << 27, 4},
+		{1 << 40, 6},
+		{1<<48 - 1, 7}, // The largest zigzag varint shorter than 8 bytes
+		{-1 << 48, 7},
+		{1 << 48, 8},
+		{-1<<48 - 1, 8},
+		{math.MaxInt64, 8},
+		{math.MinInt64, 8},
+	}
+	for _, tt := range tests {
+		in := DataInput{tt.v, DataInput{tt.v}, map[string]interface{}{"k": tt.v}, int(tt.v)}
+		data, err := EncodeWithConfig(in, optimize)
+		if err != nil {
+			t.Fatalf("%d: %v", tt.v, err)
+		}
+		wantID := TypeVarInt64
+		if tt.size == 8 {
+			wantID = TypeInt64 // Fixed width, since the varint saves nothing
+		}
+		if got := Type(data[headerLen+2]); got != wantID {
+			t.Errorf("%d: written as %v, want %v", tt.v, got, wantID)
+		}
+		if got := int64Size(tt.v, optimize.withDefaults()); got != 1+tt.size {
+			t.Errorf("%d: int64Size %d, want %d", tt.v, got, 1+tt.size)
+		}
+		plain, err := encode(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved := len(plain) - len(data); saved != 4*(8-tt.size) {
+			t.Errorf("%d: saved %d bytes, want %d", tt.v, saved, 4*(8-tt.size))
+		}
+		if n, err := encodedSize(in, 1, optimize.withDefaults()); err != nil || headerLen+n != len(data) {
+			t.Errorf("%d: encodedSize %d, %v; want %d", tt.v, headerLen+n, err, len(data))
+		}
+		var stream bytes.Buffer
+		if err := NewEncoderWithConfig(&stream, optimize).Encode(in); err != nil || !bytes.Equal(stream.Bytes(), data) {
+			t.Errorf("%d: Encoder wrote %x, %v; want %x", tt.v, stream.Bytes(), err, data)
+		}
+
+		// Every form decodes to int64, the plain int included.
+		want := DataInput{tt.v, DataInput{tt.v}, map[string]interface{}{"k": tt.v}, tt.v}
+		if got, err := decode(data); err != nil || !got.Equal(want) {
+			t.Errorf("%d: decode got %#v, %v", tt.v, got, err)
+		}
+		if got, err := NewDecoder(bytes.NewReader(data)).Decode(); err != nil || !got.Equal(want) {
+			t.Errorf("%d: Decoder got %#v, %v", tt.v, got, err)
+		}
+		if err := Validate(data); err != nil {
+			t.Errorf("%d: Validate: %v", tt.v, err)
+		}
+	}
+
+	// Other integer widths are written as before.
+	in := DataInput{int8(1), int16(1), int32(1), uint8(1), uint16(1), uint32(1), uint64(1)}
+	plain, err := encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := EncodeWithConfig(in, optimize); err != nil || !bytes.Equal(data, plain) {
+		t.Errorf("narrow integers: got %x, %v; want %x", data, err, plain)
+	}
+}
+
+func TestNeed(t *testing.T) {
+	data := make([]byte, 10)
+	tests := []struct {
+		pos, n int
+		want   string // Error message, or "" for none
+	}{
+		{0, 10, ""},
+		{6, 4, ""},
+		{10, 0, ""},
+		{7, 4, "unexpected end of data while reading int32: have 3 of 4 bytes"},
+		{10, 1, "unexpected end of data while reading int32: have 0 of 1 bytes"},
+		{12, 1, "unexpected end of data while reading int32: have 0 of 1 bytes"},
+	}
+	for _, tt := range tests {
+		err := need(data, tt.pos, tt.n, "int32")
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("need(%d, %d): %v", tt.pos, tt.n, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUnexpectedEOF) || err.Error() != tt.want {
+			t.Errorf("need(%d, %d): got %v, want %q", tt.pos, tt.n, err, tt.want)
+		}
+	}
+}
+
+// TestTruncatedFixedWidth cuts the last byte off each fixed-width numeric
+// value, at the top level and nested, and checks every decoder reports it
+// as truncated with the count of bytes it needed.
+func TestTruncatedFixedWidth(t *testing.T) {
+	tests := []struct {
+		what string
+		v    interface{}
+		n    int // Payload bytes
+	}{
+		{"int8", int8(-1), 1},
+		{"int16", int16(-1), 2},
+		{"int32", int32(-1), 4},
+		{"int64", int64(-1), 8},
+		{"uint8", uint8(1), 1},
+		{"uint16", uint16(1), 2},
+		{"uint32", uint32(1), 4},
+		{"uint64", uint64(1), 8},
+		{"enum8", Enum8(1), 1},
+		{"enum16", Enum16(1), 2},
+		{"float32", float32(1.5), 4},
+		{"float64", 1.5, 8},
+		{"complex128", complex(1, 2), 16},
+		{"bool", true, 1},
+		{"time", time.Unix(1700000000, 0).UTC(), 8},
+	}
+	for _, tt := range tests {
+		for _, in := range []DataInput{{tt.v}, {"first", DataInput{int32(1), tt.v}}} {
+			data, err := encode(in)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.what, err)
+			}
+			cut := data[:len(data)-1]
+			msg := fmt.Sprintf("while reading %s: have %d of %d bytes", tt.what, tt.n-1, tt.n)
+			_, err = decode(cut)
+			if !errors.Is(err, ErrUnexpectedEOF) || !strings.Contains(err.Error(), msg) {
+				t.Errorf("%s in %v: decode got %v, want ErrUnexpectedEOF %s", tt.what, in, err, msg)
+			}
+			if err := Validate(cut); !errors.Is(err, ErrUnexpectedEOF) {
+				t.Errorf("%s in %v: Validate got %v, want ErrUnexpectedEOF", tt.what, in, err)
+			}
+			if _, err := NewDecoder(bytes.NewReader(cut)).Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("%s in %v: Decoder got %v, want io.ErrUnexpectedEOF", tt.what, in, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "io"
+
+// Message wraps a DataInput so it can take part in io plumbing: it
+// implements io.WriterTo and io.ReaderFrom using the frames of
+// WriteMessage and ReadMessage.
+type Message struct {
+	Data DataInput
+}
+
+// WriteTo writes m.Data to w as one frame, like WriteMessage, and returns
+// the number of bytes written.
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	frame, err := encodeFrame(m.Data)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(frame)
+	return int64(n), err
+}
+
+// ReadFrom reads one frame from r into m.Data, like ReadMessage, and
+// returns the number of bytes consumed. Unlike most io.ReaderFrom
+// implementations it stops at the end of the frame rather than reading
+// until io.EOF, so the next frame stays in r. As io.ReaderFrom requires,
+// io.EOF is not an error: if r is exhausted before the frame starts,
+// ReadFrom returns 0, nil and leaves m.Data unchanged, so a caller reading
+// frame after frame stops when n is 0. m.Data is only set on success.
+func (m *Message) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	data, err := ReadMessage(cr)
+	if err == io.EOF && cr.n == 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return cr.n, err
+	}
+	m.Data = data
+	return cr.n, nil
+}
+
+// countingReader counts the bytes read through it. It forwards ReadByte
+// when r has one, so ReadMessage still reads the frame length without
+// going through Read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	br, ok := c.r.(io.ByteReader)
+	if !ok {
+		br = byteReader{c.r}
+	}
+	b, err := br.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
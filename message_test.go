@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// Message satisfies the io interfaces it is meant to plug into.
+var (
+	_ io.WriterTo   = Message{}
+	_ io.ReaderFrom = (*Message)(nil)
+)
+
+func TestMessageBuffer(t *testing.T) {
+	var stream bytes.Buffer
+	var sizes []int64
+	for _, m := range frameMessages {
+		before := stream.Len()
+		n, err := Message{m}.WriteTo(&stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(stream.Len()-before) {
+			t.Errorf("WriteTo returned %d, wrote %d", n, stream.Len()-before)
+		}
+		sizes = append(sizes, n)
+	}
+
+	// WriteTo writes the frames of WriteMessage.
+	var want bytes.Buffer
+	for _, m := range frameMessages {
+		if err := WriteMessage(&want, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(stream.Bytes(), want.Bytes()) {
+		t.Errorf("WriteTo frames differ from WriteMessage:\n got %x\nwant %x", stream.Bytes(), want.Bytes())
+	}
+
+	// Each ReadFrom consumes exactly one frame, even from a reader without
+	// ReadByte, and returns its size.
+	r := iotest.OneByteReader(&stream)
+	var m Message
+	for i, want := range frameMessages {
+		n, err := m.ReadFrom(r)
+		if err != nil || !m.Data.Equal(want) {
+			t.Fatalf("message %d: got %v, %v; want %v", i, m.Data, err, want)
+		}
+		if n != sizes[i] {
+			t.Errorf("message %d: ReadFrom returned %d, want %d", i, n, sizes[i])
+		}
+	}
+
+	// At the end of the stream ReadFrom returns 0, nil and keeps m.Data.
+	last := m.Data
+	n, err := m.ReadFrom(r)
+	if n != 0 || err != nil {
+		t.Errorf("at end of stream: got %d, %v; want 0, nil", n, err)
+	}
+	if !m.Data.Equal(last) {
+		t.Errorf("at end of stream m.Data became %v", m.Data)
+	}
+}
+
+func TestMessagePipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, m := range frameMessages {
+			if _, err := (Message{m}).WriteTo(pw); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	var got []DataInput
+	for {
+		var m Message
+		n, err := m.ReadFrom(pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, m.Data)
+	}
+	if len(got) != len(frameMessages) {
+		t.Fatalf("read %d messages, want %d", len(got), len(frameMessages))
+	}
+	for i, want := range frameMessages {
+		if !got[i].Equal(want) {
+			t.Errorf("message %d: got %v, want %v", i, got[i], want)
+		}
+	}
+}
+
+func TestMessageErrors(t *testing.T) {
+	if n, err := (Message{DataInput{make(chan int)}}).WriteTo(io.Discard); n != 0 || !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("unencodable message: got %d, %v; want 0, ErrUnsupportedType", n, err)
+	}
+	failure := errors.New("write failed")
+	if _, err := (Message{frameMessages[0]}).WriteTo(failingWriter{failure}); !errors.Is(err, failure) {
+		t.Errorf("failing writer: got %v, want %v", err, failure)
+	}
+
+	var frame bytes.Buffer
+	if _, err := (Message{frameMessages[0]}).WriteTo(&frame); err != nil {
+		t.Fatal(err)
+	}
+	// A frame cut short is an error, not the end of the stream, and the
+	// bytes consumed before it are still counted.
+	for _, cut := range []int{1, frame.Len() - 1} {
+		m := Message{DataInput{"kept"}}
+		n, err := m.ReadFrom(bytes.NewReader(frame.Bytes()[:cut]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("frame cut to %d bytes: got %v, want io.ErrUnexpectedEOF", cut, err)
+		}
+		if n != int64(cut) {
+			t.Errorf("frame cut to %d bytes: ReadFrom returned %d", cut, n)
+		}
+		if !m.Data.Equal(DataInput{"kept"}) {
+			t.Errorf("frame cut to %d bytes: m.Data became %v", cut, m.Data)
+		}
+	}
+
+	failure = errors.New("read failed")
+	if n, err := new(Message).ReadFrom(iotest.ErrReader(failure)); n != 0 || !errors.Is(err, failure) {
+		t.Errorf("failing reader: got %d, %v; want 0, %v", n, err, failure)
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"net"
+	"time"
+)
+
+// MessagePack extension types. Timestamps use the predefined type; the
+// others are application types whose payload is the value's native
+// encoding without its identifier byte, except complex128, which is its
+// real and imaginary parts as big-endian float64.
+const (
+	msgpackTimestamp = -1
+	msgpackComplex   = 1
+	msgpackBigInt    = 2
+	msgpackIP        = 3
+	msgpackDecimal   = 4
+)
+
+// EncodeMsgPack encodes data as a MessagePack array so it can be read by
+// other languages' tooling. int32, int64 and uint64 use their fixed-width
+// MessagePack formats and float32 uses float 32, so DecodeMsgPack restores
+// the original Go types; narrower integers use the matching int 8/16 and
+// uint 8/16/32 formats and come back as DecodeMsgPack describes, as do
+// Enum8 and Enum16, written as int 8 and int 16. int is written as int 64
+// and decodes as int64. time.Time uses the timestamp extension, and
+// complex128, *big.Int, net.IP and Decimal the extension types 1 to 4,
+// which DecodeMsgPack restores. map[string]interface{} is written as a map
+// with its keys in sorted order.
+func EncodeMsgPack(data DataInput) ([]byte, error) {
+	return appendMsgPack(nil, data, 1, DefaultConfig.withDefaults())
+}
+
+// appendMsgPack appends the MessagePack encoding of data to buf.
+func appendMsgPack(buf []byte, data DataInput, depth int, cfg *Config) ([]byte, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	if len(data) > cfg.MaxArrayLen {
+		return nil, limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(len(data)))
+	}
+
+	buf = appendMsgPackLen(buf, len(data), 0x90, 15, 0xdc, 0xdd)
+	for _, v := range data {
+		var err error
+		if buf, err = appendMsgPackValue(buf, v, depth, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendMsgPackMap appends m as a MessagePack map with its keys in sorted
+// order, like encodeMap.
+func appendMsgPackMap(buf []byte, m map[string]interface{}, depth int, cfg *Config) ([]byte, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	if len(m) > cfg.MaxMapLen {
+		return nil, limitError(ErrMapTooLong, cfg.MaxMapLen, uint64(len(m)))
+	}
+
+	buf = appendMsgPackLen(buf, len(m), 0x80, 15, 0xde, 0xdf)
+	for _, k := range sortedKeys(m) {
+		var err error
+		if buf, err = appendMsgPackValue(buf, k, depth, cfg); err != nil {
+			return nil, err
+		}
+		if buf, err = appendMsgPackValue(buf, m[k], depth, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendMsgPackValue appends one element of an array or map at depth.
+func appendMsgPackValue(buf []byte, v interface{}, depth int, cfg *Config) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		buf = append(buf, 0xc0)
+	case bool:
+		if v {
+			buf = append(buf, 0xc3)
+		} else {
+			buf = append(buf, 0xc2)
+		}
+	case int8:
+		buf = append(buf, 0xd0, byte(v))
+	case int16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(v))
+	case int32:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(v))
+	case int64:
+		buf = binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v))
+	case int:
+		buf = binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v))
+	case uint8:
+		buf = append(buf, 0xcc, v)
+	case uint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xcd), v)
+	case uint32:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xce), v)
+	case uint64:
+		buf = binary.BigEndian.AppendUint64(append(buf, 0xcf), v)
+	case float32:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xca), math.Float32bits(v))
+	case float64:
+		buf = binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v))
+	case string:
+		if len(v) > cfg.MaxStringLen {
+			return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(v)))
+		}
+		switch {
+		case len(v) <= 31:
+			buf = append(buf, 0xa0|byte(len(v)))
+		case len(v) <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(len(v)))
+		default:
+			buf = appendMsgPackLen(buf, len(v), 0, -1, 0xda, 0xdb)
+		}
+		buf = append(buf, v...)
+	case []byte:
+		if len(v) > cfg.MaxBlobLen {
+			return nil, limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(len(v)))
+		}
+		if len(v) <= math.MaxUint8 {
+			buf = append(buf, 0xc4, byte(len(v)))
+		} else {
+			buf = appendMsgPackLen(buf, len(v), 0, -1, 0xc5, 0xc6)
+		}
+		buf = append(buf, v...)
+	case Enum8:
+		buf = append(buf, 0xd0, byte(v))
+	case Enum16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(v))
+	case time.Time:
+		// Timestamp 96: 4-byte nanoseconds and 8-byte seconds.
+		payload := binary.BigEndian.AppendUint32(make([]byte, 0, 12), uint32(v.Nanosecond()))
+		buf = appendMsgPackExt(buf, msgpackTimestamp, binary.BigEndian.AppendUint64(payload, uint64(v.Unix())))
+	case complex128:
+		payload := binary.BigEndian.AppendUint64(make([]byte, 0, 16), math.Float64bits(real(v)))
+		buf = appendMsgPackExt(buf, msgpackComplex, binary.BigEndian.AppendUint64(payload, math.Float64bits(imag(v))))
+	case *big.Int, net.IP, Decimal:
+		var native []byte
+		var err error
+		switch v := v.(type) {
+		case *big.Int:
+			native, err = appendBigInt(nil, v, cfg)
+		case net.IP:
+			native, err = appendIP(nil, v)
+		case Decimal:
+			native, err = appendDecimal(nil, v, cfg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = appendMsgPackExt(buf, msgpackExtType(Type(native[0])), native[1:])
+	case DataInput:
+		return appendMsgPack(buf, v, depth+1, cfg)
+	case map[string]interface{}:
+		return appendMsgPackMap(buf, v, depth+1, cfg)
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return buf, nil
+}
+
+// appendMsgPackLen appends a length using the fix format when n <= fixMax,
+// otherwise the 16- or 32-bit format.
+func appendMsgPackLen(buf []byte, n int, fix byte, fixMax int, code16, code32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, code32), uint32(n))
+	}
+}
+
+// appendMsgPackExt appends an extension value, using the fixext format when
+// the payload length allows one.
+func appendMsgPackExt(buf []byte, typ int8, payload []byte) []byte {
+	switch n := len(payload); {
+	case n == 1 || n == 2 || n == 4 || n == 8 || n == 16:
+		buf = append(buf, 0xd4+byte(bits.TrailingZeros(uint(n))))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xc7, byte(n))
+	default:
+		buf = appendMsgPackLen(buf, n, 0, -1, 0xc8, 0xc9)
+	}
+	return append(append(buf, byte(typ)), payload...)
+}
+
+// msgpackExtType returns the extension type for a value natively written
+// with identifier id.
+func msgpackExtType(id Type) int8 {
+	switch id {
+	case TypeBigInt:
+		return msgpackBigInt
+	case TypeIP:
+		return msgpackIP
+	}
+	return msgpackDecimal
+}
+
+// DecodeMsgPack decodes a MessagePack array into DataInput. Integers written
+// in the int 32, int 64 and uint 64 formats decode to int32, int64 and
+// uint64; narrower integer formats decode to int32 and uint 32 to int64.
+// Extension types 1 to 4 decode to complex128, *big.Int, net.IP and
+// Decimal, as EncodeMsgPack writes them. Maps decode to
+// map[string]interface{} and must have distinct string keys. Strings and
+// binary data are copied out of data.
+func DecodeMsgPack(data []byte) (DataInput, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyInput
+	}
+	pos := 0
+	v, err := decodeMsgPackValue(data, &pos, 1, DefaultConfig.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	result, ok := v.(DataInput)
+	if !ok {
+		return nil, errors.New("invalid format: expected array")
+	}
+	return result, nil
+}
+
+// decodeMsgPackValue decodes one MessagePack value starting at *pos.
+func decodeMsgPackValue(data []byte, pos *int, depth int, cfg *Config) (interface{}, error) {
+	next := func(n int) ([]byte, error) {
+		if n < 0 || *pos+n > len(data) {
+			return nil, ErrUnexpectedEOF
+		}
+		b := data[*pos : *pos+n]
+		*pos += n
+		return b, nil
+	}
+
+	b, err := next(1)
+	if err != nil {
+		return nil, err
+	}
+	code := b[0]
+
+	switch {
+	case code <= 0x7f: // positive fixint
+		return int32(code), nil
+	case code >= 0xe0: // negative fixint
+		return int32(int8(code)), nil
+	case code&0xf0 == 0x90: // fixarray
+		return decodeMsgPackArray(data, pos, int(code&0x0f), depth, cfg)
+	case code&0xe0 == 0xa0: // fixstr
+		s, err := next(int(code & 0x1f))
+		return string(s), err
+	case code&0xf0 == 0x80: // fixmap
+		return decodeMsgPackMap(data, pos, int(code&0x0f), depth, cfg)
+	}
+
+	// readLen reads a big-endian length of the given width.
+	readLen := func(width int) (int, error) {
+		b, err := next(width)
+		if err != nil {
+			return 0, err
+		}
+		switch width {
+		case 1:
+			return int(b[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(b)), nil
+		}
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce: // uint 8/16/32
+		width := 1 << (code - 0xcc)
+		n, err := readLen(width)
+		if err != nil {
+			return nil, err
+		}
+		if width == 4 {
+			return int64(n), nil
+		}
+		return int32(n), nil
+	case 0xcf: // uint 64
+		b, err := next(8)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	case 0xd0: // int 8
+		b, err := next(1)
+		if err != nil {
+			return nil, err
+		}
+		return int32(int8(b[0])), nil
+	case 0xd1: // int 16
+		b, err := next(2)
+		if err != nil {
+			return nil, err
+		}
+		return int32(int16(binary.BigEndian.Uint16(b))), nil
+	case 0xd2: // int 32
+		b, err := next(4)
+		if err != nil {
+			return nil, err
+		}
+		return int32(binary.BigEndian.Uint32(b)), nil
+	case 0xd3: // int 64
+		b, err := next(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case 0xca: // float 32
+		b, err := next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case 0xcb: // float 64
+		b, err := next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := readLen(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		if n > cfg.MaxStringLen {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(n)))
+		}
+		s, err := next(n)
+		return string(s), err
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := readLen(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		if n > cfg.MaxBlobLen {
+			return nil, fmt.Errorf("decoded %w", limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(n)))
+		}
+		b, err := next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append(make([]byte, 0, n), b...), nil
+	case 0xdc, 0xdd: // array 16/32
+		n, err := readLen(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackArray(data, pos, n, depth, cfg)
+	case 0xde, 0xdf: // map 16/32
+		n, err := readLen(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackMap(data, pos, n, depth, cfg)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xc7, 0xc8, 0xc9: // fixext 1/2/4/8/16, ext 8/16/32
+		var n int
+		if code >= 0xd4 {
+			n = 1 << (code - 0xd4)
+		} else if n, err = readLen(1 << (code - 0xc7)); err != nil {
+			return nil, err
+		}
+		typ, err := next(1)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := next(n)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackExt(int8(typ[0]), payload, cfg)
+	}
+	return nil, fmt.Errorf("unsupported MessagePack type: 0x%02x", code)
+}
+
+// decodeMsgPackArray decodes n array elements starting at *pos.
+func decodeMsgPackArray(data []byte, pos *int, n int, depth int, cfg *Config) (DataInput, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	if n > cfg.MaxArrayLen {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(n)))
+	}
+	result := make(DataInput, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := decodeMsgPackValue(data, pos, depth+1, cfg)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// decodeMsgPackMap decodes n map entries starting at *pos.
+func decodeMsgPackMap(data []byte, pos *int, n int, depth int, cfg *Config) (map[string]interface{}, error) {
+	if depth > cfg.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	if n > cfg.MaxMapLen {
+		return nil, fmt.Errorf("decoded %w", limitError(ErrMapTooLong, cfg.MaxMapLen, uint64(n)))
+	}
+	result := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := decodeMsgPackValue(data, pos, depth+1, cfg)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("MessagePack map key is %T, not string", k)
+		}
+		if _, dup := result[key]; dup {
+			return nil, fmt.Errorf("duplicate MessagePack map key %q", key)
+		}
+		if result[key], err = decodeMsgPackValue(data, pos, depth+1, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// decodeMsgPackExt decodes an extension value of type typ.
+func decodeMsgPackExt(typ int8, payload []byte, cfg *Config) (interface{}, error) {
+	var v interface{}
+	var err error
+	pos := 0
+	switch typ {
+	case msgpackTimestamp:
+		return decodeMsgPackTimestamp(payload)
+	case msgpackComplex:
+		if len(payload) != 16 {
+			return nil, fmt.Errorf("invalid MessagePack complex128 length: %d", len(payload))
+		}
+		re := math.Float64frombits(binary.BigEndian.Uint64(payload))
+		im := math.Float64frombits(binary.BigEndian.Uint64(payload[8:]))
+		return complex(re, im), nil
+	case msgpackBigInt:
+		v, err = decodeBigInt(payload, &pos, cfg)
+	case msgpackIP:
+		v, err = decodeIP(payload, &pos)
+	case msgpackDecimal:
+		v, err = decodeDecimal(payload, &pos, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported MessagePack extension type: %d", typ)
+	}
+	if err == nil && pos != len(payload) {
+		err = fmt.Errorf("%w in MessagePack extension type %d", ErrTrailingData, typ)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeMsgPackTimestamp decodes the 32, 64 and 96-bit timestamp layouts.
+func decodeMsgPackTimestamp(b []byte) (time.Time, error) {
+	switch len(b) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), nil
+	case 8:
+		v := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(v&0x3ffffffff), int64(v>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(b)
+		sec := int64(binary.BigEndian.Uint64(b[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid MessagePack timestamp length: %d", len(b))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMsgPackReference checks EncodeMsgPack and DecodeMsgPack against bytes
+// written by the msgpack-python 1.0.5 reference implementation. Where the
+// reference picks a narrower integer or timestamp format than EncodeMsgPack,
+// which keeps Go types fixed-width, only decoding is compared.
+func TestMsgPackReference(t *testing.T) {
+	tests := []struct {
+		name   string
+		ref    string
+		value  DataInput
+		encode bool // EncodeMsgPack must reproduce ref exactly
+	}{
+		{"scalars", "97c0c3c2a568656c6c6fc4020102cb3ff8000000000000cbbfd0000000000000",
+			DataInput{nil, true, false, "hello", []byte{1, 2}, 1.5, -0.25}, true},
+		{"nested", "939092a16191a16290",
+			DataInput{DataInput{}, DataInput{"a", DataInput{"b"}}, DataInput{}}, true},
+		{"str 8", "91d928" + strings.Repeat("78", 40),
+			DataInput{strings.Repeat("x", 40)}, true},
+		{"str 16", "91da012c" + strings.Repeat("79", 300),
+			DataInput{strings.Repeat("y", 300)}, true},
+		{"bin 16", "91c5012c" + strings.Repeat("07", 300),
+			DataInput{[]byte(strings.Repeat("\x07", 300))}, true},
+		{"float 32", "91ca3fc00000",
+			DataInput{float32(1.5)}, true},
+		{"ints", "9901ffccc8d1ff38ce00011170d2fffeee90cf0000010000000000cf8000000000000000d3ffffff0000000000",
+			DataInput{int32(1), int32(-1), int32(200), int32(-200), int64(70000), int32(-70000), uint64(1 << 40), uint64(1 << 63), int64(-1 << 40)}, false},
+		{"extensions", "95d8013ff8000000000000c000000000000000d6020102012cc7050304c0000201c711030620010db8000000000000000000000001d6040202cfc7",
+			DataInput{complex(1.5, -2), big.NewInt(-300), net.IP{192, 0, 2, 1}, net.ParseIP("2001:db8::1"), NewDecimal(-12345, 2)}, true},
+		{"timestamp 96", "91c70cff00000005ffffffffffffffff",
+			DataInput{time.Unix(-1, 5).UTC()}, true},
+		{"maps", "928082a161a173a16292c381a178c0",
+			DataInput{map[string]interface{}{}, map[string]interface{}{"a": "s", "b": DataInput{true, map[string]interface{}{"x": nil}}}}, true},
+		{"map 16", "91de0010a36b3030c0a36b3031c0a36b3032c0a36b3033c0a36b3034c0a36b3035c0a36b3036c0a36b3037c0a36b3038c0a36b3039c0a36b3130c0a36b3131c0a36b3132c0a36b3133c0a36b3134c0a36b3135c0",
+			DataInput{nullMap(16)}, true},
+		{"map ints", "9182a16e01a16d81a17aff",
+			DataInput{map[string]interface{}{"n": int32(1), "m": map[string]interface{}{"z": int32(-1)}}}, false},
+		{"timestamp 64", "91d7ff1d6f34546553f100",
+			DataInput{time.Unix(1700000000, 123456789).UTC()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := hex.DecodeString(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeMsgPack(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.value) {
+				t.Errorf("DecodeMsgPack = %v, want %v", got, tt.value)
+			}
+			if !tt.encode {
+				return
+			}
+			out, err := EncodeMsgPack(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := hex.EncodeToString(out); h != tt.ref {
+				t.Errorf("EncodeMsgPack = %s, want %s", h, tt.ref)
+			}
+		})
+	}
+}
+
+// TestMsgPackRoundTrip checks every type EncodeMsgPack writes with a fixed
+// width decodes back to the same value and Go type.
+func TestMsgPackRoundTrip(t *testing.T) {
+	in := DataInput{
+		int32(-5), int64(1 << 40), uint64(1 << 63), float32(0.5), 2.5,
+		"s", []byte{9}, nil, true, time.Unix(1, 2).UTC(),
+		complex(0, 1), big.NewInt(0), new(big.Int).Lsh(big.NewInt(-1), 100),
+		net.IP(nil), net.ParseIP("::1"), NewDecimal(0, 3), NewDecimal(-1, 0),
+		DataInput{DataInput{}}, map[string]interface{}{"b": int32(1), "a": DataInput{map[string]interface{}{}}},
+	}
+	out, err := EncodeMsgPack(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeMsgPack(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(in) {
+		t.Errorf("got %v, want %v", got, in)
+	}
+}
+
+// nullMap returns a map of n keys "k00", "k01", ... whose values are nil.
+func nullMap(n int) map[string]interface{} {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		m[fmt.Sprintf("k%02d", i)] = nil
+	}
+	return m
+}
+
+// TestMsgPackMapErrors checks maps DecodeMsgPack cannot represent are
+// rejected, and that map sizes and nesting are limited like arrays.
+func TestMsgPackMapErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{"int key", "918101c0", nil},
+		{"nil key", "9181c0c0", nil},
+		{"duplicate key", "9182a161c0a161c0", nil},
+		{"truncated", "9182a161c0", ErrUnexpectedEOF},
+		{"map 32 too long", "91dfffffffff", ErrMapTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := hex.DecodeString(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = DecodeMsgPack(in)
+			if err == nil {
+				t.Fatal("decoded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	nested := map[string]interface{}{}
+	for i := 1; i < DefaultConfig.MaxDepth; i++ {
+		nested = map[string]interface{}{"m": nested}
+	}
+	if _, err := EncodeMsgPack(DataInput{nested}); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("EncodeMsgPack of deep maps: got %v, want ErrMaxDepth", err)
+	}
+}
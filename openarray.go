@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// openArray is the state of a message being written by StartArray,
+// WriteElement and EndArray.
+type openArray struct {
+	w  io.Writer  // e.w, or cw when the message is checksummed
+	cw *crcWriter // Non-nil when Config.Checksum is set
+	n  int        // Elements written so far
+}
+
+// StartArray begins a message whose top-level array is written one element
+// at a time with WriteElement and finished with EndArray, for producers
+// such as database cursors that do not know the element count in advance.
+// The array is encoded as an open array: 'a', the elements, then the end
+// marker 'z'. Elements are flushed to the writer as the buffer fills, so
+// memory stays bounded however many are written.
+//
+// The top-level array of an open message is never dictionary, delta or
+// run-length encoded, but nested arrays still are when the Config asks.
+func (e *Encoder) StartArray() error {
+	if e.open != nil {
+		return ErrOpenArrayOrder
+	}
+	o := &openArray{w: e.w}
+	if e.cfg.Checksum {
+		o.cw = &crcWriter{w: e.w}
+		o.w = o.cw
+	}
+	e.buf = append(appendHeader(e.buf[:0], e.cfg), byte(TypeOpenArray))
+	e.open = o
+	return nil
+}
+
+// WriteElement encodes v as the next element of the array begun by
+// StartArray. On error the message is incomplete and e must be Reset
+// before it is used again.
+func (e *Encoder) WriteElement(v interface{}) error {
+	o := e.open
+	if o == nil {
+		return ErrOpenArrayOrder
+	}
+	if o.n >= e.cfg.MaxArrayLen {
+		return limitError(ErrArrayTooLong, e.cfg.MaxArrayLen, uint64(o.n)+1)
+	}
+	buf, err := encodeValue(v, e.buf, o.w, 1, e.cfg)
+	if err == nil {
+		buf, err = flush(buf, o.w)
+	}
+	if err != nil {
+		return err
+	}
+	e.buf = buf
+	o.n++
+	return nil
+}
+
+// EndArray writes the end marker, and the checksum if enabled, completing
+// the message begun by StartArray. e is then ready for the next message.
+func (e *Encoder) EndArray() error {
+	o := e.open
+	if o == nil {
+		return ErrOpenArrayOrder
+	}
+	e.open = nil
+	buf := append(e.buf, byte(TypeArrayEnd))
+	e.buf = buf[:0]
+	if _, err := o.w.Write(buf); err != nil {
+		return err
+	}
+	if o.cw != nil {
+		if _, err := e.w.Write(binary.BigEndian.AppendUint32(buf[:0], o.cw.crc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// writeOpen writes elems as an open array with e and returns the message.
+func writeOpen(t *testing.T, cfg Config, elems DataInput) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	e := NewEncoderWithConfig(&buf, cfg)
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range elems {
+		if err := e.WriteElement(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestOpenArrayRoundTrip writes arrays of unknown length and reads them
+// back through every decoding path.
+func TestOpenArrayRoundTrip(t *testing.T) {
+	inputs := []DataInput{
+		{},
+		{"row", int32(1), DataInput{"nested", nil}, map[string]interface{}{"k": 2.5}},
+	}
+	for _, cfg := range []Config{{}, {Checksum: true}, {VarintInts: true, DictStrings: true}} {
+		for _, in := range inputs {
+			data := writeOpen(t, cfg, in)
+			if data[headerLen] != byte(TypeOpenArray) {
+				t.Errorf("array written as %q, want 'a'", data[headerLen])
+			}
+			got, err := DecodeWithConfig(data, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(in) {
+				t.Errorf("decode: got %v, want %v", got, in)
+			}
+			if got, err := NewDecoderWithConfig(bytes.NewReader(data), cfg).Decode(); err != nil || !got.Equal(in) {
+				t.Errorf("Decoder: got %v, %v", got, err)
+			}
+			if got := iterate(t, data); !got.Equal(in) {
+				t.Errorf("Iterator: got %v, want %v", got, in)
+			}
+			if err := Validate(data); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+		}
+	}
+}
+
+// TestOpenArrayStreams writes more than the flush threshold and checks
+// bytes reach the writer before EndArray.
+func TestOpenArrayStreams(t *testing.T) {
+	var w countingWriter
+	e := NewEncoder(&w)
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	row := strings.Repeat("x", 1000)
+	n := 0
+	for ; w.Len() == 0; n++ {
+		if n == DefaultConfig.MaxArrayLen {
+			t.Fatal("nothing written before EndArray")
+		}
+		if err := e.WriteElement(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decode(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n {
+		t.Errorf("decoded %d elements, wrote %d", len(got), n)
+	}
+}
+
+func TestOpenArrayErrors(t *testing.T) {
+	e := NewEncoder(io.Discard)
+	if err := e.WriteElement("x"); !errors.Is(err, ErrOpenArrayOrder) {
+		t.Errorf("WriteElement before StartArray: got %v", err)
+	}
+	if err := e.EndArray(); !errors.Is(err, ErrOpenArrayOrder) {
+		t.Errorf("EndArray before StartArray: got %v", err)
+	}
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.StartArray(); !errors.Is(err, ErrOpenArrayOrder) {
+		t.Errorf("StartArray twice: got %v", err)
+	}
+	if err := e.WriteElement(make(chan int)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("unsupported element: got %v", err)
+	}
+	e.Reset(io.Discard)
+	if err := e.EndArray(); !errors.Is(err, ErrOpenArrayOrder) {
+		t.Errorf("EndArray after Reset: got %v", err)
+	}
+
+	e = NewEncoderWithConfig(io.Discard, Config{MaxArrayLen: 2})
+	e.StartArray()
+	e.WriteElement(int8(1))
+	e.WriteElement(int8(2))
+	if err := e.WriteElement(int8(3)); !errors.Is(err, ErrArrayTooLong) {
+		t.Errorf("third element with MaxArrayLen 2: got %v", err)
+	}
+
+	data := writeOpen(t, Config{}, DataInput{"a", "b"})
+	if _, err := decode(data[:len(data)-1]); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("missing end marker: got %v, want ErrUnexpectedEOF", err)
+	}
+	if _, err := DecodeWithConfig(data, Config{MaxArrayLen: 1}); !errors.Is(err, ErrArrayTooLong) {
+		t.Errorf("decoding past MaxArrayLen: got %v, want ErrArrayTooLong", err)
+	}
+}
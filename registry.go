@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// registry maps names given to RegisterType to their factories, and the Go
+// types those factories produce back to their names. It also holds the
+// codecs added with RegisterIdentifier, keyed both ways.
+var registry = struct {
+	sync.RWMutex
+	factories map[string]func() encoding.BinaryUnmarshaler
+	names     map[reflect.Type]string
+	codecs    map[byte]Codec
+	ids       map[reflect.Type]byte
+}{
+	factories: make(map[string]func() encoding.BinaryUnmarshaler),
+	names:     make(map[reflect.Type]string),
+	codecs:    make(map[byte]Codec),
+	ids:       make(map[reflect.Type]byte),
+}
+
+// Codec converts values of a custom type to and from the payload stored
+// after its identifier.
+type Codec struct {
+	Encode func(v interface{}) ([]byte, error)
+	Decode func(payload []byte) (interface{}, error)
+}
+
+// RegisterIdentifier adds a custom single-byte type identifier. Values with
+// the same Go type as example are written as id, the varint length of the
+// payload returned by codec.Encode, and the payload; decode passes the
+// payload to codec.Decode. The payload slice aliases the input, so Decode
+// must copy it to retain it. Payloads are subject to Config.MaxBlobLen.
+//
+// It returns ErrIdentifierInUse if id or the type of example is built in
+// or already registered. Types implementing encoding.BinaryMarshaler count
+// as built in, since encode writes them as RegisterType extensions.
+func RegisterIdentifier(id byte, example interface{}, codec Codec) error {
+	if codec.Encode == nil || codec.Decode == nil {
+		return errors.New("RegisterIdentifier: codec needs both Encode and Decode")
+	}
+	if example == nil {
+		return errors.New("RegisterIdentifier: nil example")
+	}
+	if isReservedType(id) {
+		return fmt.Errorf("%w: %c is built in", ErrIdentifierInUse, id)
+	}
+	if _, ok := builtinType(example); ok {
+		return fmt.Errorf("%w: %T is built in", ErrIdentifierInUse, example)
+	}
+	if _, ok := example.(encoding.BinaryMarshaler); ok {
+		return fmt.Errorf("%w: %T implements encoding.BinaryMarshaler", ErrIdentifierInUse, example)
+	}
+	t := reflect.TypeOf(example)
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.codecs[id]; dup {
+		return fmt.Errorf("%w: %c already registered", ErrIdentifierInUse, id)
+	}
+	if prev, dup := registry.ids[t]; dup {
+		return fmt.Errorf("%w: %v already registered as %c", ErrIdentifierInUse, t, prev)
+	}
+	registry.codecs[id] = codec
+	registry.ids[t] = id
+	return nil
+}
+
+// customPayload returns the identifier registered for the type of v and
+// the encoded payload, checked against cfg. It reports ErrUnsupportedType
+// if no identifier is registered.
+func customPayload(v interface{}, cfg *Config) (byte, []byte, error) {
+	registry.RLock()
+	id, ok := registry.ids[reflect.TypeOf(v)]
+	codec := registry.codecs[id]
+	registry.RUnlock()
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	payload, err := codec.Encode(v)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) > cfg.MaxBlobLen {
+		return 0, nil, limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(len(payload)))
+	}
+	return id, payload, nil
+}
+
+// customCodec returns the codec registered for id.
+func customCodec(id byte) (Codec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	codec, ok := registry.codecs[id]
+	return codec, ok
+}
+
+// readCustom reads the payload of a custom value whose identifier has
+// already been consumed. It aliases data.
+func readCustom(data []byte, pos *int, cfg *Config) ([]byte, error) {
+	n, err := readLength(data, pos, cfg.MaxBlobLen, ErrBlobTooLong, "custom payload")
+	if err != nil {
+		return nil, err
+	}
+	payload := data[*pos : *pos+n]
+	*pos += n
+	return payload, nil
+}
+
+// RegisterType makes values of the type produced by factory encodable under
+// name. Such a type must implement encoding.BinaryMarshaler; it is written
+// as its name followed by its MarshalBinary output, and decoded by calling
+// factory and then UnmarshalBinary on the result. Because UnmarshalBinary
+// needs a pointer receiver, factory usually returns a pointer, and both the
+// pointer and the type it points to encode under name. Decoding always
+// yields the value factory returns.
+//
+// Like gob.Register, RegisterType is meant to be called during
+// initialization and panics if name is empty or already registered.
+func RegisterType(name string, factory func() encoding.BinaryUnmarshaler) {
+	if name == "" {
+		panic("RegisterType: empty type name")
+	}
+	t := reflect.TypeOf(factory())
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.factories[name]; dup {
+		panic(fmt.Sprintf("RegisterType: type name %q registered twice", name))
+	}
+	registry.factories[name] = factory
+	registry.names[t] = name
+	if t.Kind() == reflect.Pointer {
+		registry.names[t.Elem()] = name
+	}
+}
+
+// extensionPayload returns the registered name and MarshalBinary output
+// of v, checked against cfg.
+func extensionPayload(v encoding.BinaryMarshaler, cfg *Config) (string, []byte, error) {
+	registry.RLock()
+	name, ok := registry.names[reflect.TypeOf(v)]
+	registry.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %T is not registered", ErrUnsupportedType, v)
+	}
+
+	payload, err := v.MarshalBinary()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(payload) > cfg.MaxBlobLen {
+		return "", nil, limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(len(payload)))
+	}
+	return name, payload, nil
+}
+
+// isRegistered reports whether name was passed to RegisterType.
+func isRegistered(name []byte) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	_, ok := registry.factories[string(name)]
+	return ok
+}
+
+// newRegistered reconstructs a value of the type registered under name from
+// its MarshalBinary output.
+func newRegistered(name, payload []byte) (encoding.BinaryUnmarshaler, error) {
+	registry.RLock()
+	factory, ok := registry.factories[string(name)]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnregisteredType, name)
+	}
+
+	v := factory()
+	if err := v.UnmarshalBinary(payload); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// readExtension reads the name and payload of an extension value whose
+// identifier has already been consumed. Both alias data.
+func readExtension(data []byte, pos *int, cfg *Config) (name, payload []byte, err error) {
+	nameLen, err := readLength(data, pos, cfg.MaxStringLen, ErrStringTooLong, "extension name")
+	if err != nil {
+		return nil, nil, err
+	}
+	name = data[*pos : *pos+nameLen]
+	*pos += nameLen
+
+	payloadLen, err := readLength(data, pos, cfg.MaxBlobLen, ErrBlobTooLong, "extension payload")
+	if err != nil {
+		return nil, nil, err
+	}
+	payload = data[*pos : *pos+payloadLen]
+	*pos += payloadLen
+	return name, payload, nil
+}
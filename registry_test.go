@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// durationID is the identifier the tests register time.Duration under.
+const durationID = '~'
+
+var registerDuration sync.Once
+
+// registerTestDuration registers time.Duration as durationID, once per test
+// binary so -count above 1 does not trip the duplicate check.
+func registerTestDuration(t *testing.T) {
+	t.Helper()
+	var err error
+	registerDuration.Do(func() {
+		err = RegisterIdentifier(durationID, time.Duration(0), Codec{
+			Encode: func(v interface{}) ([]byte, error) {
+				return binary.BigEndian.AppendUint64(nil, uint64(v.(time.Duration))), nil
+			},
+			Decode: func(payload []byte) (interface{}, error) {
+				if len(payload) != 8 {
+					return nil, fmt.Errorf("duration payload of %d bytes", len(payload))
+				}
+				return time.Duration(binary.BigEndian.Uint64(payload)), nil
+			},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterIdentifierRoundTrip(t *testing.T) {
+	registerTestDuration(t)
+	in := DataInput{time.Duration(-90 * time.Second), "x", DataInput{time.Duration(1)}}
+	data, err := encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[headerLen+2] != durationID {
+		t.Errorf("first element written as %c, want %c", data[headerLen+2], durationID)
+	}
+	got, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(in) {
+		t.Errorf("got %v, want %v", got, in)
+	}
+	if err := Validate(data); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+// textID implements encoding.BinaryMarshaler, which encode routes to
+// RegisterType instead of RegisterIdentifier.
+type textID string
+
+func (s textID) MarshalBinary() ([]byte, error) { return []byte(s), nil }
+
+func TestRegisterIdentifierRejects(t *testing.T) {
+	registerTestDuration(t)
+	codec := Codec{
+		Encode: func(interface{}) ([]byte, error) { return nil, nil },
+		Decode: func([]byte) (interface{}, error) { return nil, nil },
+	}
+	type celsius float64
+	tests := []struct {
+		name    string
+		id      byte
+		example interface{}
+		codec   Codec
+		inUse   bool
+	}{
+		{"built-in identifier", byte(TypeString), celsius(0), codec, true},
+		{"dictionary identifier", byte(TypeDict), celsius(0), codec, true},
+		{"typed array identifier", byte(TypeTypedArray), celsius(0), codec, true},
+		{"schema identifier", byte(TypeSchema), celsius(0), codec, true},
+		{"registered identifier", durationID, celsius(0), codec, true},
+		{"registered type", '!', time.Duration(0), codec, true},
+		{"built-in type", '!', int32(0), codec, true},
+		{"built-in int", '!', 0, codec, true},
+		{"built-in pointer", '!', new(big.Int), codec, true},
+		{"binary marshaler", '!', textID(""), codec, true},
+		{"nil example", '!', nil, codec, false},
+		{"missing Decode", '!', celsius(0), Codec{Encode: codec.Encode}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterIdentifier(tt.id, tt.example, tt.codec)
+			if err == nil {
+				t.Fatal("registered")
+			}
+			if errors.Is(err, ErrIdentifierInUse) != tt.inUse {
+				t.Errorf("got %v, want ErrIdentifierInUse: %t", err, tt.inUse)
+			}
+		})
+	}
+	if _, ok := customCodec('!'); ok {
+		t.Error("a rejected registration left a codec behind")
+	}
+}
+
+// testUUID is a UUID-like type round-tripped through RegisterType.
+type testUUID [16]byte
+
+func (u testUUID) MarshalBinary() ([]byte, error) { return u[:], nil }
+
+func (u *testUUID) UnmarshalBinary(b []byte) error {
+	if len(b) != len(u) {
+		return fmt.Errorf("uuid payload of %d bytes", len(b))
+	}
+	copy(u[:], b)
+	return nil
+}
+
+var registerUUID sync.Once
+
+func TestRegisterTypeRoundTrip(t *testing.T) {
+	registerUUID.Do(func() {
+		RegisterType("test.uuid", func() encoding.BinaryUnmarshaler { return new(testUUID) })
+	})
+	u := testUUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	for _, v := range []interface{}{u, &u} {
+		data, err := encode(DataInput{v, "after"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Type(data[headerLen+2]); got != TypeExtension {
+			t.Errorf("%T encoded as %v, want TypeExtension", v, got)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, ok := got[0].(*testUUID); !ok || *p != u || got[1] != "after" {
+			t.Errorf("decoded %#v, want *testUUID %x then \"after\"", got, u)
+		}
+		if err := Validate(data); err != nil {
+			t.Errorf("Validate: %v", err)
+		}
+	}
+
+	// A payload UnmarshalBinary rejects, and a name nobody registered.
+	data, err := encode(DataInput{u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := append(bytes.Clone(data[:len(data)-17]), 15)
+	short = append(short, u[:15]...)
+	if _, err := decode(short); err == nil {
+		t.Error("decoded a 15-byte uuid")
+	}
+	unknown := bytes.Replace(data, []byte("test.uuid"), []byte("test.xxxx"), 1)
+	if _, err := decode(unknown); !errors.Is(err, ErrUnregisteredType) {
+		t.Errorf("unregistered name: got %v, want ErrUnregisteredType", err)
+	}
+	if _, err := encode(DataInput{textID("x")}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("unregistered BinaryMarshaler: got %v, want ErrUnsupportedType", err)
+	}
+}
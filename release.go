@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// arrayPools[c] holds released DataInput backing arrays with capacity in
+// (1<<(c-1), 1<<c]; larger arrays are left to the garbage collector.
+var arrayPools [17]sync.Pool
+
+// holderPool recycles the *DataInput boxes arrayPools stores, so that a
+// steady Release/decode cycle does not allocate them.
+var holderPool = sync.Pool{
+	New: func() interface{} { return new(DataInput) },
+}
+
+// Release returns the backing arrays of d and every array nested in it,
+// including inside maps, to a pool that later decodes draw from. d must be a
+// value returned by a decode function, and neither d nor anything obtained
+// from it may be used after the call. Strings and blobs are not recycled,
+// since they usually alias the input.
+func Release(d DataInput) {
+	for i, v := range d {
+		releaseValue(v)
+		d[i] = nil // Drop references so the pool does not retain them
+	}
+	if cap(d) == 0 {
+		return
+	}
+	c := bits.Len(uint(cap(d) - 1))
+	if c >= len(arrayPools) {
+		return
+	}
+	p := holderPool.Get().(*DataInput)
+	*p = d[:0]
+	arrayPools[c].Put(p)
+}
+
+// releaseValue releases the arrays held by a single element.
+func releaseValue(v interface{}) {
+	switch v := v.(type) {
+	case DataInput:
+		Release(v)
+	case map[string]interface{}:
+		for _, e := range v {
+			releaseValue(e)
+		}
+	}
+}
+
+// newArray returns an empty DataInput with capacity for n elements, reusing
+// a released array when one is available.
+func newArray(n uint64) DataInput {
+	if n == 0 {
+		return make(DataInput, 0)
+	}
+	c := bits.Len64(n - 1)
+	if c < len(arrayPools) {
+		if p, ok := arrayPools[c].Get().(*DataInput); ok {
+			d := *p
+			*p = nil
+			holderPool.Put(p)
+			if uint64(cap(d)) >= n { // Same class can still be too small
+				return d
+			}
+		}
+	}
+	return make(DataInput, 0, n)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestReleaseReuse decodes, releases and decodes again, checking results
+// stay correct and that released arrays are handed to later decodes.
+func TestReleaseReuse(t *testing.T) {
+	in := DataInput{"a", DataInput{int32(1), int32(2), DataInput{"deep"}}, map[string]interface{}{"k": DataInput{nil, nil}}}
+	data := roundTrip(t, in)
+
+	reused := false
+	for i := 0; i < 100 && !reused; i++ {
+		d, err := decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Equal(in) {
+			t.Fatalf("cycle %d: got %v, want %v", i, d, in)
+		}
+		released := make(map[*interface{}]bool)
+		Walk(d, func(_ []int, v interface{}) error {
+			if a, ok := v.(DataInput); ok && cap(a) > 0 {
+				released[&a[:1][0]] = true
+			}
+			return nil
+		})
+		released[&d[:1][0]] = true
+		Release(d)
+		for _, v := range d[:cap(d)] {
+			if v != nil {
+				t.Fatalf("released array still holds %v", v)
+			}
+		}
+		if next := newArray(uint64(len(in))); cap(next) > 0 && released[&next[:1][0]] {
+			reused = true
+		}
+	}
+	if !reused {
+		t.Error("no released array was handed out again in 100 cycles")
+	}
+}
+
+// TestNewArrayCapacity releases arrays of every capacity within a few size
+// classes and checks newArray never hands one out that is too small.
+func TestNewArrayCapacity(t *testing.T) {
+	const most = 70
+	for round := 0; round < 10; round++ {
+		for c := 1; c <= most; c++ {
+			Release(make(DataInput, c))
+		}
+		for n := uint64(0); n <= most; n++ {
+			d := newArray(n)
+			if len(d) != 0 || uint64(cap(d)) < n {
+				t.Fatalf("newArray(%d) has len %d, cap %d", n, len(d), cap(d))
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeRelease(b *testing.B) {
+	in := make(DataInput, 100)
+	for i := range in {
+		in[i] = DataInput{fmt.Sprint(i), int32(i), DataInput{float64(i)}}
+	}
+	data, err := encode(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decode(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("DecodeRelease", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			d, err := decode(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			Release(d)
+		}
+	})
+}
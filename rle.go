@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// isScalarArray reports whether d is non-empty and holds no nested arrays
+// or maps.
+func isScalarArray(d DataInput) bool {
+	if len(d) == 0 {
+		return false
+	}
+	for _, v := range d {
+		switch v.(type) {
+		case DataInput, map[string]interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+// sameRun reports whether b can share a run with a. Blobs never do, so
+// decoded elements never share a mutable buffer, and neither do custom
+// types, whose equality the package cannot judge.
+func sameRun(a, b interface{}) bool {
+	switch a.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64, uint8, uint16, uint32, uint64,
+		float32, float64, complex128, time.Time, Enum8, Enum16:
+		return equalValue(a, b)
+	}
+	return false
+}
+
+// runLen returns the length of the run starting at d[i].
+func runLen(d DataInput, i int) int {
+	n := 1
+	for i+n < len(d) && sameRun(d[i], d[i+n]) {
+		n++
+	}
+	return n
+}
+
+// arrayEncoding picks how encodeHelper writes data: the plain 'A' form, or
+// whichever enabled compact form is smaller. Ties go to the delta form,
+// then to the plain form. A string array is always smaller than the plain
+// form, so it is only weighed against runs.
+func arrayEncoding(data DataInput, cfg *Config) Type {
+	delta := cfg.DeltaInts && isInt32Array(data)
+	runs := cfg.RunLength && isScalarArray(data)
+	if cfg.StringArrays && isStringArray(data, cfg) {
+		if runs {
+			n, err := stringArraySize(data, cfg)
+			if rn, rerr := runArraySize(data, cfg); err == nil && rerr == nil && rn < n {
+				return TypeRunArray
+			}
+		}
+		return TypeStringArray
+	}
+	if !delta && !runs {
+		return TypeArray
+	}
+
+	best := TypeArray
+	bestSize := 1 + varintLen(uint64(len(data)))
+	for _, v := range data {
+		n, err := valueSize(v, 0, cfg)
+		if err != nil {
+			return TypeArray // Let the plain encoder report it
+		}
+		bestSize += n
+	}
+	if delta {
+		if n := deltaArraySize(data); n <= bestSize {
+			best, bestSize = TypeDeltaArray, n
+		}
+	}
+	if runs {
+		if n, err := runArraySize(data, cfg); err == nil && n < bestSize {
+			best = TypeRunArray
+		}
+	}
+	return best
+}
+
+// appendRunArray writes a scalar array as 'R', the number of runs, and each
+// run as its varint length followed by the repeated value.
+func appendRunArray(buf []byte, data DataInput, w io.Writer, cfg *Config) ([]byte, error) {
+	count := 0
+	for i := 0; i < len(data); i += runLen(data, i) {
+		count++
+	}
+	buf = append(buf, byte(TypeRunArray))
+	buf = appendVarint(buf, uint64(count))
+
+	for i := 0; i < len(data); {
+		n := runLen(data, i)
+		buf = appendVarint(buf, uint64(n))
+		var err error
+		if buf, err = encodeValue(data[i], buf, w, 0, cfg); err != nil {
+			return nil, err
+		}
+		if buf, err = flush(buf, w); err != nil {
+			return nil, err
+		}
+		i += n
+	}
+	return buf, nil
+}
+
+// runArraySize returns the number of bytes appendRunArray writes for data.
+func runArraySize(data DataInput, cfg *Config) (int, error) {
+	count, size := 0, 0
+	for i := 0; i < len(data); {
+		n := runLen(data, i)
+		vs, err := valueSize(data[i], 0, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += varintLen(uint64(n)) + vs
+		count++
+		i += n
+	}
+	return 1 + varintLen(uint64(count)) + size, nil
+}
+
+// readRunHeader reads the run count of a run-length array whose identifier
+// has already been consumed, checking depth against cfg.
+func readRunHeader(data []byte, pos *int, depth int, cfg *Config) (uint64, error) {
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+	count, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	*pos += bytesRead
+	if count > uint64(cfg.MaxArrayLen) { // Every run holds at least one element
+		return 0, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, count))
+	}
+	return count, nil
+}
+
+// readRun reads the length of the next run, given the number of elements
+// so far, and checks that the value that follows is a scalar.
+func readRun(data []byte, pos *int, total uint64, cfg *Config) (uint64, error) {
+	n, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	*pos += bytesRead
+	if n == 0 {
+		return 0, ErrInvalidRun
+	}
+	if n > uint64(cfg.MaxArrayLen)-total {
+		return 0, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, max(total+n, n))) // Just n should the sum overflow
+	}
+	if *pos >= len(data) {
+		return 0, fmt.Errorf("%w while reading run", ErrUnexpectedEOF)
+	}
+	if id := data[*pos]; isContainer(id) || id == byte(TypeDeltaArray) || id == byte(TypeRunArray) || id == byte(TypeStringArray) {
+		return 0, fmt.Errorf("%w: %c in run", ErrInvalidRun, id)
+	}
+	return n, nil
+}
+
+// readRunArray decodes a run-length array whose identifier has already been
+// consumed. Every element of a run is the same decoded value.
+func readRunArray(data []byte, pos *int, depth int, cfg *Config) (DataInput, error) {
+	count, err := readRunHeader(data, pos, depth, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var result DataInput
+	for i := uint64(0); i < count; i++ {
+		n, err := readRun(data, pos, uint64(len(result)), cfg)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decodeScalar(data, pos, cfg)
+		if err == nil {
+			v, err = normalizeInt(v, cfg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < n; j++ {
+			result = append(result, v)
+		}
+	}
+	if result == nil {
+		result = DataInput{}
+	}
+	return result, nil
+}
+
+// skipRunArray advances past a run-length array whose identifier has
+// already been consumed, enforcing the same rules as readRunArray.
+func skipRunArray(data []byte, pos *int, depth int, cfg *Config) error {
+	count, err := readRunHeader(data, pos, depth, cfg)
+	if err != nil {
+		return err
+	}
+	var total uint64
+	for i := uint64(0); i < count; i++ {
+		n, err := readRun(data, pos, total, cfg)
+		if err != nil {
+			return err
+		}
+		total += n
+		var flat int
+		if cfg.flat != nil {
+			flat = len(*cfg.flat)
+		}
+		if err := skipHelper(data, pos, depth+1, cfg); err != nil {
+			return err
+		}
+		if cfg.flat != nil && len(*cfg.flat) > flat {
+			for j := uint64(1); j < n; j++ { // The run's value stands for n elements
+				*cfg.flat = append(*cfg.flat, (*cfg.flat)[flat])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+// TestRunLength round-trips scalar arrays with RunLength, alone and with
+// DictStrings, and checks when the run form is chosen.
+func TestRunLength(t *testing.T) {
+	repeat := func(v interface{}, n int) DataInput {
+		d := make(DataInput, n)
+		for i := range d {
+			d[i] = v
+		}
+		return d
+	}
+	distinct := make(DataInput, 100)
+	for i := range distinct {
+		distinct[i] = int64(i) << 40
+	}
+	mixed := append(append(append(repeat("north", 40), "south", "east"), repeat(nil, 30)...), repeat(2.5, 20)...)
+
+	tests := []struct {
+		name string
+		in   DataInput
+		runs bool // Whether the run form is chosen
+	}{
+		{"all same", repeat(int32(7), 500), true},
+		{"all same strings", repeat("category", 500), true},
+		{"all distinct", distinct, false},
+		{"mixed runs", mixed, true},
+		{"int32 and int64 do not share a run", DataInput{int32(1), int64(1), int32(1), int64(1)}, false},
+		{"nested array", DataInput{DataInput{}, DataInput{}, DataInput{}}, false},
+	}
+	for _, tt := range tests {
+		for _, cfg := range []Config{{RunLength: true}, {RunLength: true, DictStrings: true}} {
+			data, err := EncodeWithConfig(tt.in, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decode(data)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !got.Equal(tt.in) {
+				t.Fatalf("%s: got %v, want %v", tt.name, got, tt.in)
+			}
+			top := headerLen // Past the dictionary, if any
+			if _, err := readDict(data, &top, DefaultConfig.withDefaults(), false); err != nil {
+				t.Fatal(err)
+			}
+			if runs := Type(data[top]) == TypeRunArray; runs != tt.runs {
+				t.Errorf("%s with %+v: run encoded %t, want %t", tt.name, cfg, runs, tt.runs)
+			}
+			if plain := roundTrip(t, tt.in); tt.runs && len(data) >= len(plain) {
+				t.Errorf("%s: %d bytes, no smaller than the plain %d", tt.name, len(data), len(plain))
+			}
+		}
+	}
+}
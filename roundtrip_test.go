@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// randomInput is a DataInput that testing/quick generates with randomArray.
+type randomInput DataInput
+
+// Generate implements quick.Generator, nesting up to five levels below the
+// top-level array, well inside DefaultConfig.MaxDepth.
+func (randomInput) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(randomInput(randomArray(r, r.Intn(6))))
+}
+
+// TestRoundTripProperty checks decode(encode(x)) equals x for random inputs
+// covering every type randomValue generates, under each encoding option.
+func TestRoundTripProperty(t *testing.T) {
+	configs := []struct {
+		name string
+		cfg  Config
+	}{
+		{"default", Config{}},
+		{"varint", Config{VarintInts: true}},
+		{"optimized ints", Config{OptimizeIntegers: true}},
+		{"checksum", Config{Checksum: true}},
+		{"compact", Config{DictStrings: true, RunLength: true, DeltaInts: true}},
+		{"canonical", Config{canonical: true}},
+		{"string arrays", Config{StringArrays: true}},
+	}
+	for _, c := range configs {
+		cfg := c.cfg
+		t.Run(c.name, func(t *testing.T) {
+			property := func(in randomInput) bool {
+				data, err := EncodeWithConfig(DataInput(in), cfg)
+				if err != nil {
+					t.Logf("encode %v: %v", DataInput(in), err)
+					return false
+				}
+				got, err := decode(data)
+				if err != nil {
+					t.Logf("decode %v: %v", DataInput(in), err)
+					return false
+				}
+				return got.Equal(DataInput(in))
+			}
+			qc := &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(55))}
+			if err := quick.Check(property, qc); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// randomValue returns a random element of any supported type, nesting
+// arrays and maps at most depth levels further. Lengths stay far below the
+// DefaultConfig limits. int is left out, since it decodes as int64.
+func randomValue(r *rand.Rand, depth int) interface{} {
+	kinds := 23
+	if depth <= 0 {
+		kinds = 21 // Scalars only
+	}
+	switch r.Intn(kinds) {
+	case 0:
+		return randomString(r)
+	case 1:
+		b := make([]byte, r.Intn(16))
+		r.Read(b)
+		return b
+	case 2:
+		return r.Intn(2) == 1
+	case 3:
+		return nil
+	case 4:
+		return int8(r.Uint32())
+	case 5:
+		return int16(r.Uint32())
+	case 6:
+		return int32(r.Uint32())
+	case 7:
+		return int64(r.Uint64())
+	case 8:
+		return uint8(r.Uint32())
+	case 9:
+		return uint16(r.Uint32())
+	case 10:
+		return r.Uint32()
+	case 11:
+		return r.Uint64()
+	case 12:
+		return math.Float32frombits(r.Uint32())
+	case 13:
+		return math.Float64frombits(r.Uint64())
+	case 14:
+		return complex(r.NormFloat64(), r.NormFloat64())
+	case 15:
+		return time.Unix(0, r.Int63()-r.Int63()).UTC()
+	case 16:
+		return Enum8(r.Uint32())
+	case 17:
+		return Enum16(r.Uint32())
+	case 18:
+		return randomBigInt(r)
+	case 19:
+		if r.Intn(2) == 0 {
+			return net.IPv4(byte(r.Uint32()), byte(r.Uint32()), byte(r.Uint32()), byte(r.Uint32())).To4()
+		}
+		ip := make(net.IP, net.IPv6len)
+		r.Read(ip)
+		ip[0] = 0x20 // Not IPv4-mapped
+		return ip
+	case 20:
+		return Decimal{Unscaled: randomBigInt(r), Scale: uint8(r.Intn(40))}
+	case 21:
+		return randomArray(r, depth-1)
+	default:
+		m := make(map[string]interface{})
+		for i := r.Intn(5); i > 0; i-- {
+			m[randomString(r)] = randomValue(r, depth-1)
+		}
+		return m
+	}
+}
+
+// randomArray returns a DataInput of up to 8 random elements nested at most
+// depth levels further.
+func randomArray(r *rand.Rand, depth int) DataInput {
+	d := make(DataInput, r.Intn(9))
+	for i := range d {
+		d[i] = randomValue(r, depth)
+	}
+	return d
+}
+
+// randomBigInt returns an integer of up to about 260 bits of either sign.
+func randomBigInt(r *rand.Rand) *big.Int {
+	n := new(big.Int).Lsh(big.NewInt(r.Int63()), uint(r.Intn(200)))
+	if r.Intn(2) == 0 {
+		n.Neg(n)
+	}
+	return n
+}
+
+// randomString returns a short string, occasionally with multi-byte runes.
+func randomString(r *rand.Rand) string {
+	const alphabet = "abcxyz 0-_é世"
+	runes := []rune(alphabet)
+	b := make([]rune, r.Intn(12))
+	for i := range b {
+		b[i] = runes[r.Intn(len(runes))]
+	}
+	return string(b)
+}
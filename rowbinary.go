@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// rowBinaryColumn is a parsed RowBinary column type.
+type rowBinaryColumn struct {
+	typ      string            // Base ClickHouse type, such as "Int32" or "FixedString"
+	size     int               // N of FixedString(N)
+	nullable bool              // Declared as Nullable(typ)
+	elems    []rowBinaryColumn // Element types of a Tuple
+	enum     map[string]int16  // Names of Enum8('a' = 1, ...), or nil for a bare Enum8
+}
+
+// Tuple is a value of a ClickHouse Tuple column: a fixed number of elements,
+// each of its own type. Unlike a nested DataInput it carries no length in
+// RowBinary, since the column type fixes the arity. Tuples are only
+// supported by EncodeRowBinary and DecodeRowBinary.
+type Tuple []interface{}
+
+// EncodeRowBinary serializes rows in ClickHouse's RowBinary format, ready to
+// send with INSERT ... FORMAT RowBinary. columnTypes names the ClickHouse
+// type of each column; every row must have one element per column, of the
+// Go type that column type maps to:
+//
+//	String, FixedString(N)          string or []byte
+//	Int8, Int16, Int32, Int64       int8, int16, int32, int64
+//	UInt8, UInt16, UInt32, UInt64   uint8, uint16, uint32, uint64
+//	Float32, Float64                float32, float64
+//	Bool                            bool
+//	Enum8, Enum16                   Enum8, Enum16, or a name
+//	Tuple(T1, T2, ...)              Tuple with one element per type
+//
+// Any of these may be wrapped as Nullable(T), in which case nil is also
+// accepted; each value is then preceded by ClickHouse's null flag byte.
+// Enum columns may declare their names as ClickHouse does, such as
+// Enum8('active' = 1, 'deleted' = 2); names are looked up in that table,
+// or in DefaultConfig.EnumNames for a bare Enum8 or Enum16, failing with
+// ErrUnknownEnum for names not in it.
+// Numbers are little-endian and strings carry a varint length prefix, as
+// ClickHouse expects. FixedString(N) values are written as exactly N bytes
+// with no prefix: shorter values are padded with NUL bytes, or rejected
+// with ErrFixedStringTooShort if StrictFixedStrings is set, and longer ones
+// are an error. Tuple elements are written one after another with no count.
+// Rows, tuples and values that do not match their column types fail with
+// ErrSchemaMismatch.
+// Limits from DefaultConfig apply to strings.
+func EncodeRowBinary(rows []DataInput, columnTypes []string) ([]byte, error) {
+	return EncodeRowBinaryWithConfig(rows, columnTypes, DefaultConfig)
+}
+
+// EncodeRowBinaryWithConfig is like EncodeRowBinary but takes its enum
+// names, FixedString padding and limits from cfg instead of DefaultConfig.
+func EncodeRowBinaryWithConfig(rows []DataInput, columnTypes []string, cfg Config) ([]byte, error) {
+	cols, err := parseRowBinaryColumns(columnTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	c := cfg.withDefaults()
+	var buf []byte
+	for r, row := range rows {
+		if len(row) != len(cols) {
+			return nil, fmt.Errorf("row %d: %w: has %d values, want %d", r, ErrSchemaMismatch, len(row), len(cols))
+		}
+		for i, v := range row {
+			if buf, err = appendRowBinaryColumn(buf, cols[i], v, c); err != nil {
+				return nil, fmt.Errorf("row %d, column %d: %w", r, i, err)
+			}
+		}
+	}
+	return buf, nil
+}
+
+// DecodeRowBinary parses rows written in ClickHouse's RowBinary format with
+// the given column types, the reverse of EncodeRowBinary. Values decode to
+// the Go types listed there, FixedString(N) to an N-byte string including
+// any padding, Tuple columns to a Tuple, and null values of Nullable
+// columns to nil. Enum columns decode to their names when the column
+// declares them or DefaultConfig.EnumNames is set, failing with
+// ErrUnknownEnum for values not in the table, and to Enum8 or Enum16
+// otherwise.
+// Strings are views into data unless DefaultConfig.CopyStrings is set.
+// Errors are *DecodeError values whose Path is the row and column index.
+func DecodeRowBinary(data []byte, columnTypes []string) ([]DataInput, error) {
+	return DecodeRowBinaryWithConfig(data, columnTypes, DefaultConfig)
+}
+
+// DecodeRowBinaryWithConfig is like DecodeRowBinary but takes its enum
+// names, CopyStrings and limits from cfg instead of DefaultConfig.
+func DecodeRowBinaryWithConfig(data []byte, columnTypes []string, cfg Config) ([]DataInput, error) {
+	cols, err := parseRowBinaryColumns(columnTypes)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		if len(data) > 0 {
+			return nil, fmt.Errorf("%w: data for zero columns", ErrInvalidFormat)
+		}
+		return nil, nil
+	}
+
+	c := cfg.withDefaults()
+	var rows []DataInput
+	pos := 0
+	for pos < len(data) {
+		row := make(DataInput, len(cols))
+		for i, col := range cols {
+			start := pos
+			v, err := readRowBinaryColumn(data, &pos, col, c)
+			if err != nil {
+				return nil, &DecodeError{Offset: start, Path: []int{len(rows), i}, Err: err}
+			}
+			row[i] = v
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseRowBinaryColumns parses and checks the column types passed to
+// EncodeRowBinary and DecodeRowBinary.
+func parseRowBinaryColumns(columnTypes []string) ([]rowBinaryColumn, error) {
+	cols := make([]rowBinaryColumn, len(columnTypes))
+	for i, typ := range columnTypes {
+		col, ok := parseRowBinaryColumn(typ)
+		if !ok {
+			return nil, fmt.Errorf("column %d: %w: %q", i, ErrUnsupportedType, typ)
+		}
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+// parseRowBinaryColumn parses a single column type, recursing into the
+// element types of a Tuple. It reports false for unsupported types.
+func parseRowBinaryColumn(typ string) (rowBinaryColumn, bool) {
+	typ = strings.TrimSpace(typ)
+	col := rowBinaryColumn{typ: typ}
+	if inner, ok := strings.CutPrefix(typ, "Nullable("); ok && strings.HasSuffix(inner, ")") {
+		col = rowBinaryColumn{typ: strings.TrimSuffix(inner, ")"), nullable: true}
+	}
+	if n, ok := strings.CutPrefix(col.typ, "FixedString("); ok && strings.HasSuffix(n, ")") {
+		size, err := strconv.Atoi(strings.TrimSuffix(n, ")"))
+		if err != nil || size <= 0 || size > DefaultConfig.MaxStringLen {
+			return rowBinaryColumn{}, false
+		}
+		col.typ, col.size = "FixedString", size
+	}
+	for _, typ := range []string{"Enum8", "Enum16"} {
+		if list, ok := strings.CutPrefix(col.typ, typ+"("); ok && strings.HasSuffix(list, ")") {
+			names, ok := parseEnumNames(strings.TrimSuffix(list, ")"), typ)
+			if !ok {
+				return rowBinaryColumn{}, false
+			}
+			col.typ, col.enum = typ, names
+		}
+	}
+	if inner, ok := strings.CutPrefix(col.typ, "Tuple("); ok && strings.HasSuffix(inner, ")") {
+		for _, elem := range splitTypeList(strings.TrimSuffix(inner, ")")) {
+			e, ok := parseRowBinaryColumn(elem)
+			if !ok {
+				return rowBinaryColumn{}, false
+			}
+			col.elems = append(col.elems, e)
+		}
+		if len(col.elems) == 0 {
+			return rowBinaryColumn{}, false
+		}
+		col.typ = "Tuple"
+	}
+	return col, isRowBinaryType(col.typ)
+}
+
+// parseEnumNames parses the name table of an Enum8 or Enum16 type, such as
+// 'a' = 1, 'b' = 2. Names are single-quoted with backslash escapes; names
+// and values must be distinct and values must fit typ.
+func parseEnumNames(list, typ string) (map[string]int16, bool) {
+	bits := 8
+	if typ == "Enum16" {
+		bits = 16
+	}
+	entries := splitTypeList(list)
+	if len(entries) == 0 {
+		return nil, false
+	}
+	names := make(map[string]int16, len(entries))
+	values := make(map[int16]bool, len(entries))
+	for _, entry := range entries {
+		eq := strings.LastIndexByte(entry, '=') // Names may contain '=', values cannot
+		if eq < 0 {
+			return nil, false
+		}
+		name, ok := unquoteEnumName(strings.TrimSpace(entry[:eq]))
+		if !ok {
+			return nil, false
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(entry[eq+1:]), 10, bits)
+		if err != nil {
+			return nil, false
+		}
+		if _, dup := names[name]; dup || values[int16(v)] {
+			return nil, false
+		}
+		names[name], values[int16(v)] = int16(v), true
+	}
+	return names, true
+}
+
+// unquoteEnumName returns the name in a single-quoted Enum name, where a
+// backslash escapes the character after it.
+func unquoteEnumName(quoted string) (string, bool) {
+	if len(quoted) < 2 || quoted[0] != '\'' || quoted[len(quoted)-1] != '\'' {
+		return "", false
+	}
+	var name strings.Builder
+	for i := 1; i < len(quoted)-1; i++ {
+		switch quoted[i] {
+		case '\\':
+			i++
+			if i == len(quoted)-1 {
+				return "", false // The closing quote was escaped
+			}
+		case '\'':
+			return "", false
+		}
+		name.WriteByte(quoted[i])
+	}
+	return name.String(), true
+}
+
+// splitTypeList splits a comma-separated list of types, ignoring commas
+// inside parentheses, such as the elements of Tuple(String, Tuple(Int8, Bool)),
+// and inside the quoted names of an Enum.
+func splitTypeList(list string) []string {
+	var types []string
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '\'':
+			for i++; i < len(list) && list[i] != '\''; i++ {
+				if list[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(list) == "" {
+		return types
+	}
+	return append(types, list[start:])
+}
+
+// isRowBinaryType reports whether EncodeRowBinary supports the ClickHouse
+// type typ.
+func isRowBinaryType(typ string) bool {
+	switch typ {
+	case "String", "FixedString", "Int8", "Int16", "Int32", "Int64", "UInt8", "UInt16", "UInt32", "UInt64",
+		"Float32", "Float64", "Bool", "Enum8", "Enum16", "Tuple":
+		return true
+	}
+	return false
+}
+
+// appendRowBinaryColumn appends v as a value of col, preceded by its null
+// flag if the column is nullable.
+func appendRowBinaryColumn(buf []byte, col rowBinaryColumn, v interface{}, cfg *Config) ([]byte, error) {
+	if col.nullable {
+		if v == nil {
+			return append(buf, 1), nil
+		}
+		buf = append(buf, 0)
+	}
+	return appendRowBinaryValue(buf, col, v, cfg)
+}
+
+// appendRowBinaryValue appends v as a RowBinary value of col's type.
+func appendRowBinaryValue(buf []byte, col rowBinaryColumn, v interface{}, cfg *Config) ([]byte, error) {
+	typ := col.typ
+	switch v := v.(type) {
+	case string:
+		if typ == "FixedString" {
+			return appendFixedString(buf, v, col.size, cfg.StrictFixedStrings)
+		}
+		if typ == "Enum8" || typ == "Enum16" {
+			return appendRowBinaryEnumName(buf, col, v, cfg)
+		}
+		if typ == "String" {
+			if len(v) > cfg.MaxStringLen {
+				return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(v)))
+			}
+			return append(appendVarint(buf, uint64(len(v))), v...), nil
+		}
+	case []byte:
+		if typ == "FixedString" {
+			return appendFixedString(buf, v, col.size, cfg.StrictFixedStrings)
+		}
+		if typ == "String" {
+			if len(v) > cfg.MaxStringLen {
+				return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(v)))
+			}
+			return append(appendVarint(buf, uint64(len(v))), v...), nil
+		}
+	case int8:
+		if typ == "Int8" {
+			return append(buf, byte(v)), nil
+		}
+	case int16:
+		if typ == "Int16" {
+			return binary.LittleEndian.AppendUint16(buf, uint16(v)), nil
+		}
+	case int32:
+		if typ == "Int32" {
+			return binary.LittleEndian.AppendUint32(buf, uint32(v)), nil
+		}
+	case int64:
+		if typ == "Int64" {
+			return binary.LittleEndian.AppendUint64(buf, uint64(v)), nil
+		}
+	case uint8:
+		if typ == "UInt8" {
+			return append(buf, v), nil
+		}
+	case uint16:
+		if typ == "UInt16" {
+			return binary.LittleEndian.AppendUint16(buf, v), nil
+		}
+	case uint32:
+		if typ == "UInt32" {
+			return binary.LittleEndian.AppendUint32(buf, v), nil
+		}
+	case uint64:
+		if typ == "UInt64" {
+			return binary.LittleEndian.AppendUint64(buf, v), nil
+		}
+	case float32:
+		if typ == "Float32" {
+			return binary.LittleEndian.AppendUint32(buf, math.Float32bits(v)), nil
+		}
+	case float64:
+		if typ == "Float64" {
+			return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v)), nil
+		}
+	case Enum8:
+		if typ == "Enum8" {
+			return append(buf, byte(v)), nil
+		}
+	case Enum16:
+		if typ == "Enum16" {
+			return binary.LittleEndian.AppendUint16(buf, uint16(v)), nil
+		}
+	case bool:
+		if typ == "Bool" {
+			if v {
+				return append(buf, 1), nil
+			}
+			return append(buf, 0), nil
+		}
+	case Tuple:
+		if typ == "Tuple" {
+			if len(v) != len(col.elems) {
+				return nil, fmt.Errorf("%w: tuple has %d elements, want %d", ErrSchemaMismatch, len(v), len(col.elems))
+			}
+			var err error
+			for i, elem := range v {
+				if buf, err = appendRowBinaryColumn(buf, col.elems[i], elem, cfg); err != nil {
+					return nil, fmt.Errorf("tuple element %d: %w", i, err)
+				}
+			}
+			return buf, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: cannot write %T as %s", ErrSchemaMismatch, v, typ)
+}
+
+// appendRowBinaryEnumName appends the value col's name table gives name to
+// an Enum8 or Enum16 column.
+func appendRowBinaryEnumName(buf []byte, col rowBinaryColumn, name string, cfg *Config) ([]byte, error) {
+	v, err := enumValue(col.enumNames(cfg), name)
+	if err != nil {
+		return nil, err
+	}
+	if col.typ == "Enum16" {
+		return binary.LittleEndian.AppendUint16(buf, uint16(v)), nil
+	}
+	if v < math.MinInt8 || v > math.MaxInt8 {
+		return nil, fmt.Errorf("%w for Enum8: %d", ErrIntOutOfRange, v)
+	}
+	return append(buf, byte(v)), nil
+}
+
+// appendFixedString appends s padded with NUL bytes to exactly size bytes,
+// or fails if s is shorter and strict is set.
+func appendFixedString[T string | []byte](buf []byte, s T, size int, strict bool) ([]byte, error) {
+	if len(s) > size {
+		return nil, limitError(ErrStringTooLong, size, uint64(len(s)))
+	}
+	if strict && len(s) < size {
+		return nil, fmt.Errorf("%w: %d of %d bytes", ErrFixedStringTooShort, len(s), size)
+	}
+	buf = append(buf, s...)
+	return append(buf, make([]byte, size-len(s))...), nil
+}
+
+// readRowBinaryColumn reads one value of col, including its null flag if
+// the column is nullable.
+func readRowBinaryColumn(data []byte, pos *int, col rowBinaryColumn, cfg *Config) (interface{}, error) {
+	if col.nullable {
+		if err := need(data, *pos, 1, "null flag"); err != nil {
+			return nil, err
+		}
+		flag := data[*pos]
+		*pos++
+		switch flag {
+		case 1:
+			return nil, nil
+		case 0:
+		default:
+			return nil, fmt.Errorf("%w for null flag: %d", ErrInvalidBool, flag)
+		}
+	}
+	return readRowBinaryValue(data, pos, col, cfg)
+}
+
+// readRowBinaryValue reads one RowBinary value of col's type.
+func readRowBinaryValue(data []byte, pos *int, col rowBinaryColumn, cfg *Config) (interface{}, error) {
+	typ := col.typ
+	if typ == "String" {
+		s, err := readRawString(data, pos, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if typ == "Tuple" {
+		t := make(Tuple, len(col.elems))
+		for i, elem := range col.elems {
+			v, err := readRowBinaryColumn(data, pos, elem, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("tuple element %d: %w", i, err)
+			}
+			t[i] = v
+		}
+		return t, nil
+	}
+
+	var size int
+	switch typ {
+	case "FixedString":
+		size = col.size
+	case "Int8", "UInt8", "Bool", "Enum8":
+		size = 1
+	case "Int16", "UInt16", "Enum16":
+		size = 2
+	case "Int32", "UInt32", "Float32":
+		size = 4
+	default:
+		size = 8
+	}
+	if err := need(data, *pos, size, typ); err != nil {
+		return nil, err
+	}
+	b := data[*pos : *pos+size]
+	*pos += size
+
+	switch typ {
+	case "FixedString":
+		if cfg.CopyStrings {
+			return string(b), nil
+		}
+		return bytesToString(b), nil
+	case "Int8":
+		return int8(b[0]), nil
+	case "UInt8":
+		return b[0], nil
+	case "Bool":
+		switch b[0] {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		}
+		return nil, fmt.Errorf("%w: %d", ErrInvalidBool, b[0])
+	case "Enum8":
+		if names := col.enumNames(cfg); names != nil {
+			return rowBinaryEnumName(int16(int8(b[0])), names)
+		}
+		return Enum8(b[0]), nil
+	case "Enum16":
+		v := int16(binary.LittleEndian.Uint16(b))
+		if names := col.enumNames(cfg); names != nil {
+			return rowBinaryEnumName(v, names)
+		}
+		return Enum16(v), nil
+	case "Int16":
+		return int16(binary.LittleEndian.Uint16(b)), nil
+	case "UInt16":
+		return binary.LittleEndian.Uint16(b), nil
+	case "Int32":
+		return int32(binary.LittleEndian.Uint32(b)), nil
+	case "UInt32":
+		return binary.LittleEndian.Uint32(b), nil
+	case "Float32":
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case "Int64":
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case "UInt64":
+		return binary.LittleEndian.Uint64(b), nil
+	default: // Float64
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
+// enumNames returns the name table of an Enum column: the one its type
+// declares, or cfg.EnumNames for a bare Enum8 or Enum16.
+func (col rowBinaryColumn) enumNames(cfg *Config) map[string]int16 {
+	if col.enum != nil {
+		return col.enum
+	}
+	return cfg.EnumNames
+}
+
+// rowBinaryEnumName returns the name names gives the Enum value v.
+func rowBinaryEnumName(v int16, names map[string]int16) (interface{}, error) {
+	name, err := enumName(names, v)
+	if err != nil {
+		return nil, err
+	}
+	return name, nil
+}
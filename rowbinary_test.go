@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// TestRowBinaryGolden checks EncodeRowBinary against the byte layouts in
+// ClickHouse's RowBinary documentation for every supported column type,
+// and that DecodeRowBinary reads them back.
+func TestRowBinaryGolden(t *testing.T) {
+	tests := []struct {
+		typ     string
+		v       interface{}
+		hex     string
+		decoded interface{} // What DecodeRowBinary returns, if not v
+	}{
+		{"String", "hello", "0568656c6c6f", nil},
+		{"String", []byte{0, 1}, "020001", "\x00\x01"},
+		{"String", "", "00", nil},
+		{"FixedString(4)", "ab", "61620000", "ab\x00\x00"},
+		{"FixedString(2)", []byte("xy"), "7879", "xy"},
+		{"Int8", int8(-1), "ff", nil},
+		{"Int16", int16(-2), "feff", nil},
+		{"Int32", int32(1), "01000000", nil},
+		{"Int64", int64(-1), "ffffffffffffffff", nil},
+		{"UInt8", uint8(255), "ff", nil},
+		{"UInt16", uint16(0x1234), "3412", nil},
+		{"UInt32", uint32(0x12345678), "78563412", nil},
+		{"UInt64", uint64(1) << 56, "0000000000000001", nil},
+		{"Float32", float32(1.5), "0000c03f", nil},
+		{"Float64", 1.5, "000000000000f83f", nil},
+		{"Bool", true, "01", nil},
+		{"Bool", false, "00", nil},
+		{"Enum8", Enum8(-1), "ff", nil},
+		{"Enum16", Enum16(1000), "e803", nil},
+		{"Tuple(String, Int8)", Tuple{"a", int8(2)}, "016102", nil},
+		{"Tuple(Int8, Tuple(Bool, Nullable(Int8)))", Tuple{int8(1), Tuple{true, nil}}, "010101", nil},
+		{"Nullable(Int32)", nil, "01", nil},
+		{"Nullable(Int32)", int32(5), "0005000000", nil},
+		{"Nullable(String)", "x", "000178", nil},
+	}
+	for _, tt := range tests {
+		want, err := hex.DecodeString(tt.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := EncodeRowBinary([]DataInput{{tt.v}}, []string{tt.typ})
+		if err != nil {
+			t.Errorf("%s %#v: %v", tt.typ, tt.v, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s %#v: got %x, want %s", tt.typ, tt.v, got, tt.hex)
+		}
+
+		rows, err := DecodeRowBinary(want, []string{tt.typ})
+		if err != nil {
+			t.Errorf("decode %s %s: %v", tt.typ, tt.hex, err)
+			continue
+		}
+		decoded := tt.decoded
+		if decoded == nil {
+			decoded = tt.v
+		}
+		if len(rows) != 1 || !equalValue(rows[0][0], decoded) && !equalTuple(rows[0][0], decoded) {
+			t.Errorf("decode %s %s: got %#v, want %#v", tt.typ, tt.hex, rows, decoded)
+		}
+	}
+}
+
+// equalTuple compares Tuples, which equalValue does not know.
+func equalTuple(a, b interface{}) bool {
+	ta, ok1 := a.(Tuple)
+	tb, ok2 := b.(Tuple)
+	if !ok1 || !ok2 || len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if !equalValue(ta[i], tb[i]) && !equalTuple(ta[i], tb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestRowBinaryRows writes several rows of several columns and checks the
+// values are laid out row after row with no separators.
+func TestRowBinaryRows(t *testing.T) {
+	types := []string{"String", "Int32", "Float64"}
+	rows := []DataInput{
+		{"a", int32(1), 0.5},
+		{"bc", int32(-1), 2.0},
+	}
+	want, _ := hex.DecodeString("0161" + "01000000" + "000000000000e03f" + "026263" + "ffffffff" + "0000000000000040")
+	got, err := EncodeRowBinary(rows, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got  %x\nwant %x", got, want)
+	}
+	back, err := DecodeRowBinary(got, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != 2 || !back[0].Equal(rows[0]) || !back[1].Equal(rows[1]) {
+		t.Errorf("decoded %v, want %v", back, rows)
+	}
+}
+
+func TestRowBinaryFixedString(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      interface{}
+		strict bool
+		hex    string
+		want   error
+	}{
+		{"exact", "abcd", false, "61626364", nil},
+		{"exact strict", []byte("abcd"), true, "61626364", nil},
+		{"padded", "ab", false, "61620000", nil},
+		{"padded blob", []byte{}, false, "00000000", nil},
+		{"short strict", "ab", true, "", ErrFixedStringTooShort},
+		{"short blob strict", []byte("abc"), true, "", ErrFixedStringTooShort},
+		{"too long", "abcde", false, "", ErrStringTooLong},
+		{"too long strict", []byte("abcde"), true, "", ErrStringTooLong},
+	}
+	for _, tt := range tests {
+		got, err := EncodeRowBinaryWithConfig([]DataInput{{tt.v}}, []string{"FixedString(4)"}, Config{StrictFixedStrings: tt.strict})
+		if tt.want != nil {
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.hex {
+			t.Errorf("%s: got %x, want %s", tt.name, got, tt.hex)
+		}
+	}
+
+	// The default config pads.
+	if got, err := EncodeRowBinary([]DataInput{{"a"}}, []string{"FixedString(2)"}); err != nil || !bytes.Equal(got, []byte{'a', 0}) {
+		t.Errorf("EncodeRowBinary: got %x, %v", got, err)
+	}
+}
+
+func TestRowBinaryTuple(t *testing.T) {
+	types := []string{"Tuple(String, Int32, Float64)"}
+	rows := []DataInput{
+		{Tuple{"a", int32(-1), 0.5}},
+		{Tuple{"", int32(1 << 30), -2.0}},
+	}
+	data, err := EncodeRowBinary(rows, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No count or length before the elements.
+	want, _ := hex.DecodeString("0161" + "ffffffff" + "000000000000e03f" + "00" + "00000040" + "00000000000000c0")
+	if !bytes.Equal(data, want) {
+		t.Errorf("got  %x\nwant %x", data, want)
+	}
+	got, err := DecodeRowBinary(data, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !equalTuple(got[0][0], rows[0][0]) || !equalTuple(got[1][0], rows[1][0]) {
+		t.Errorf("decoded %v, want %v", got, rows)
+	}
+
+	for _, bad := range []DataInput{
+		{Tuple{"a", int32(1)}},
+		{Tuple{"a", int32(1), 0.5, 0.5}},
+		{Tuple{"a", int64(1), 0.5}},
+		{DataInput{"a", int32(1), 0.5}},
+		{Tuple{"a", int32(1), 0.5}, "extra column"},
+	} {
+		if _, err := EncodeRowBinary([]DataInput{bad}, types); !errors.Is(err, ErrSchemaMismatch) {
+			t.Errorf("%v: got %v, want ErrSchemaMismatch", bad, err)
+		}
+	}
+	if _, err := DecodeRowBinary(data[:len(data)-1], types); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("truncated: got %v, want ErrUnexpectedEOF", err)
+	}
+	if _, err := encode(DataInput{Tuple{"a"}}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("native encode of a Tuple: got %v, want ErrUnsupportedType", err)
+	}
+	for _, typ := range []string{"Tuple()", "Tuple(String, Foo)", "Tuple(String"} {
+		if _, err := EncodeRowBinary(nil, []string{typ}); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%s: got %v, want ErrUnsupportedType", typ, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import "fmt"
+
+// TokenKind classifies the tokens a Scanner yields.
+type TokenKind int
+
+const (
+	TokenValue      TokenKind = iota // A scalar, or an array in a compact form
+	TokenKey                         // A map key, before its value
+	TokenArrayStart                  // Identifier and length of a plain or open array
+	TokenArrayEnd                    // End of an array: empty, or an open array's end marker
+	TokenMapStart                    // Identifier and entry count of a map
+	TokenMapEnd                      // End of a map, always empty
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenValue:
+		return "value"
+	case TokenKey:
+		return "key"
+	case TokenArrayStart:
+		return "array start"
+	case TokenArrayEnd:
+		return "array end"
+	case TokenMapStart:
+		return "map start"
+	case TokenMapEnd:
+		return "map end"
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Token is one step of a Scanner: an element, map key or nesting event,
+// and the bytes of the message it spans.
+type Token struct {
+	Kind  TokenKind
+	Type  Type // Identifier of the value or container; zero for keys and counted ends
+	Start int  // Offset of the token's first byte
+	End   int  // Offset just past the token; equal to Start for empty end tokens
+	Depth int  // Number of enclosing arrays and maps; 0 for the top-level array
+}
+
+// Scanner tokenizes an encoded message without decoding it, for tools such
+// as hex viewers and profilers that need each element's type and byte range
+// rather than its value. It reports array and map boundaries, map keys, and
+// one token per element. A dictionary preamble comes first, as a TokenValue
+// of TypeDict. Delta, run-length and string arrays have no per-element
+// identifiers, so each is a single TokenValue.
+//
+// Use it like bufio.Scanner:
+//
+//	s := NewScanner(data)
+//	for s.Scan() {
+//		tok := s.Token()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+//
+// It enforces the same rules and limits as Validate. Offsets are relative
+// to data, header included.
+type Scanner struct {
+	data    []byte
+	pos     int
+	cfg     *Config
+	stack   []scanFrame
+	tok     Token
+	started bool // The header has been checked
+	begun   bool // The top-level array has been reached
+	err     error
+}
+
+// scanFrame is an array or map the Scanner is inside.
+type scanFrame struct {
+	typ       Type
+	n         int    // Elements or map values started so far
+	remaining uint64 // Elements or entries left, unless typ is TypeOpenArray
+	key       string // Last map key, for the order check
+	keyNext   bool   // A map key comes next
+}
+
+// NewScanner returns a Scanner over data that enforces the limits in
+// DefaultConfig.
+func NewScanner(data []byte) *Scanner {
+	return NewScannerWithConfig(data, DefaultConfig)
+}
+
+// NewScannerWithConfig is like NewScanner but enforces the limits in cfg.
+func NewScannerWithConfig(data []byte, cfg Config) *Scanner {
+	return &Scanner{data: data, cfg: cfg.withDefaults()}
+}
+
+// Token returns the token produced by the last call to Scan.
+func (s *Scanner) Token() Token {
+	return s.tok
+}
+
+// Err returns the first error met while scanning, or nil if the message
+// was well formed. Errors past the header are *DecodeError.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Scan advances to the next token, which is then available from Token. It
+// returns false at the end of the message or on error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	if !s.started {
+		s.started = true
+		if !s.header() {
+			return false
+		}
+		if s.pos < len(s.data) && s.data[s.pos] == byte(TypeDict) {
+			start := s.pos
+			cfg, err := readDict(s.data, &s.pos, s.cfg, false)
+			if err != nil {
+				return s.fail(start, err)
+			}
+			s.cfg = cfg
+			s.tok = Token{Kind: TokenValue, Type: TypeDict, Start: start, End: s.pos}
+			return true
+		}
+	}
+	if !s.begun {
+		s.begun = true
+		if s.pos >= len(s.data) || !isArray(s.data[s.pos]) {
+			return s.fail(s.pos, ErrInvalidFormat)
+		}
+		return s.element(0)
+	}
+	if len(s.stack) == 0 {
+		if s.pos != len(s.data) && !s.cfg.AllowTrailingData {
+			s.fail(s.pos, ErrTrailingData)
+		}
+		return false
+	}
+
+	start := s.pos
+	top := &s.stack[len(s.stack)-1]
+	if top.typ == TypeOpenArray {
+		switch {
+		case s.pos >= len(s.data):
+			return s.fail(start, fmt.Errorf("%w while reading open array", ErrUnexpectedEOF))
+		case s.data[s.pos] == byte(TypeArrayEnd):
+			s.pos++
+			return s.end(TokenArrayEnd, TypeArrayEnd, start)
+		case top.n >= s.cfg.MaxArrayLen:
+			return s.fail(start, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, s.cfg.MaxArrayLen, uint64(top.n)+1)))
+		}
+	} else if top.remaining == 0 {
+		if top.typ == TypeMap {
+			return s.end(TokenMapEnd, 0, start)
+		}
+		return s.end(TokenArrayEnd, 0, start)
+	}
+
+	if top.keyNext {
+		key, err := readRawString(s.data, &s.pos, s.cfg)
+		if err == nil && top.n > 0 && key <= top.key {
+			err = fmt.Errorf("%w: %q", ErrMapKeyOrder, key)
+		}
+		if err != nil {
+			return s.fail(start, err)
+		}
+		top.key, top.keyNext = key, false
+		s.tok = Token{Kind: TokenKey, Start: start, End: s.pos, Depth: len(s.stack)}
+		return true
+	}
+	top.n++
+	if top.typ != TypeOpenArray {
+		top.remaining--
+		top.keyNext = top.typ == TypeMap && top.remaining > 0
+	}
+	return s.element(len(s.stack))
+}
+
+// header checks the header and checksum and moves past the header.
+func (s *Scanner) header() bool {
+	if len(s.data) == 0 {
+		s.err = ErrEmptyInput
+		return false
+	}
+	version, err := checkHeader(s.data)
+	if err == nil && version == VersionChecksum {
+		s.data, err = verifyChecksum(s.data)
+	}
+	if err != nil {
+		s.err = err
+		return false
+	}
+	s.pos = headerLen
+	return true
+}
+
+// element yields the element at s.pos, nested depth containers deep: the
+// start of an array or map, or a whole value.
+func (s *Scanner) element(depth int) bool {
+	start := s.pos
+	if start >= len(s.data) {
+		return s.fail(start, ErrUnexpectedEOF)
+	}
+	id := Type(s.data[start])
+	kind := TokenArrayStart
+	frame := scanFrame{typ: id}
+	var err error
+	switch id {
+	case TypeArray:
+		frame.remaining, err = readArrayLen(s.data, &s.pos, depth+1, s.cfg)
+	case TypeMap:
+		kind = TokenMapStart
+		frame.remaining, err = readMapLen(s.data, &s.pos, depth+1, s.cfg)
+		frame.keyNext = frame.remaining > 0
+	case TypeOpenArray:
+		if depth+1 > s.cfg.MaxDepth {
+			err = ErrMaxDepth
+		}
+		s.pos++
+	default:
+		if err := skipHelper(s.data, &s.pos, depth+1, s.cfg); err != nil {
+			return s.fail(start, err)
+		}
+		s.tok = Token{Kind: TokenValue, Type: id, Start: start, End: s.pos, Depth: depth}
+		return true
+	}
+	if err != nil {
+		return s.fail(start, err)
+	}
+	s.stack = append(s.stack, frame)
+	s.tok = Token{Kind: kind, Type: id, Start: start, End: s.pos, Depth: depth}
+	return true
+}
+
+// end pops the innermost container and yields its end token.
+func (s *Scanner) end(kind TokenKind, id Type, start int) bool {
+	s.stack = s.stack[:len(s.stack)-1]
+	s.tok = Token{Kind: kind, Type: id, Start: start, End: s.pos, Depth: len(s.stack)}
+	return true
+}
+
+// fail records err as a DecodeError at offset and stops the scan.
+func (s *Scanner) fail(offset int, err error) bool {
+	path := []int{}
+	for _, f := range s.stack {
+		if f.n == 0 {
+			break
+		}
+		path = append(path, f.n-1)
+	}
+	s.err = &DecodeError{Offset: offset, Path: path, Err: err}
+	return false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// scanAll returns every token of data and the Scanner's error.
+func scanAll(data []byte, cfg Config) ([]Token, error) {
+	var toks []Token
+	s := NewScannerWithConfig(data, cfg)
+	for s.Scan() {
+		toks = append(toks, s.Token())
+	}
+	return toks, s.Err()
+}
+
+func TestScannerTokens(t *testing.T) {
+	data, err := encode(DataInput{"a", int32(1), DataInput{true}, map[string]interface{}{"k": DataInput{nil}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{
+		{TokenArrayStart, TypeArray, 5, 7, 0},
+		{TokenValue, TypeString, 7, 10, 1},
+		{TokenValue, TypeInt32, 10, 15, 1},
+		{TokenArrayStart, TypeArray, 15, 17, 1},
+		{TokenValue, TypeBool, 17, 19, 2},
+		{TokenArrayEnd, 0, 19, 19, 1},
+		{TokenMapStart, TypeMap, 19, 21, 1},
+		{TokenKey, 0, 21, 23, 2},
+		{TokenArrayStart, TypeArray, 23, 25, 2},
+		{TokenValue, TypeNull, 25, 26, 3},
+		{TokenArrayEnd, 0, 26, 26, 2},
+		{TokenMapEnd, 0, 26, 26, 1},
+		{TokenArrayEnd, 0, 26, 26, 0},
+	}
+	got, err := scanAll(data, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[len(got)-1].End != len(data) {
+		t.Errorf("tokens end at %d of %d bytes", got[len(got)-1].End, len(data))
+	}
+	if span := string(data[got[1].Start:got[1].End]); span != "S\x01a" {
+		t.Errorf("string token spans %q", span)
+	}
+}
+
+// TestScannerCompactForms checks the dictionary, compact arrays and open
+// arrays each scan as the tokens the Scanner documents.
+func TestScannerCompactForms(t *testing.T) {
+	// kind is a token without its position.
+	type kind struct {
+		Kind TokenKind
+		Type Type
+	}
+	start, end := kind{TokenArrayStart, TypeArray}, kind{TokenArrayEnd, 0}
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+		want []kind
+	}{
+		{"dictionary", func(t *testing.T) []byte {
+			return mustEncode(t, DataInput{"rep", "rep"}, Config{DictStrings: true})
+		}, []kind{{TokenValue, TypeDict}, start, {TokenValue, TypeDictRef}, {TokenValue, TypeDictRef}, end}},
+		{"compact arrays", func(t *testing.T) []byte {
+			return mustEncode(t, DataInput{DataInput{int32(1), int32(2)}, DataInput{"a", "b"}}, Config{DeltaInts: true, StringArrays: true})
+		}, []kind{start, {TokenValue, TypeDeltaArray}, {TokenValue, TypeStringArray}, end}},
+		{"open array", func(t *testing.T) []byte {
+			return writeOpen(t, Config{}, DataInput{"x", DataInput{}})
+		}, []kind{{TokenArrayStart, TypeOpenArray}, {TokenValue, TypeString}, start, end, {TokenArrayEnd, TypeArrayEnd}}},
+		{"checksum", func(t *testing.T) []byte {
+			return mustEncode(t, DataInput{int8(1)}, Config{Checksum: true})
+		}, []kind{start, {TokenValue, TypeInt8}, end}},
+		{"empty", func(t *testing.T) []byte {
+			return mustEncode(t, DataInput{}, Config{})
+		}, []kind{start, end}},
+	}
+	for _, tt := range tests {
+		data := tt.data(t)
+		toks, err := scanAll(data, Config{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(toks) != len(tt.want) {
+			t.Fatalf("%s: got %+v, want %+v", tt.name, toks, tt.want)
+		}
+		for i, tok := range toks {
+			if got := (kind{tok.Kind, tok.Type}); got != tt.want[i] {
+				t.Errorf("%s: token %d is %v %v, want %v %v", tt.name, i, got.Kind, got.Type, tt.want[i].Kind, tt.want[i].Type)
+			}
+		}
+		// Tokens cover the message without gaps or overlaps.
+		pos := headerLen
+		for _, tok := range toks {
+			if tok.Start != pos || tok.End < tok.Start {
+				t.Errorf("%s: token %+v, want it to start at %d", tt.name, tok, pos)
+			}
+			pos = tok.End
+		}
+	}
+}
+
+// mustEncode encodes in with cfg or fails the test.
+func mustEncode(t *testing.T, in DataInput, cfg Config) []byte {
+	t.Helper()
+	data, err := EncodeWithConfig(in, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestScannerErrors(t *testing.T) {
+	data := mustEncode(t, DataInput{"a", DataInput{int32(1), "bc"}}, Config{})
+	tests := []struct {
+		name   string
+		data   []byte
+		want   error
+		offset int // Of the DecodeError, or -1 for a header error
+	}{
+		{"empty", nil, ErrEmptyInput, -1},
+		{"bad magic", append([]byte("XXXX"), data[4:]...), ErrBadMagic, -1},
+		{"not an array", message(byte(TypeString), 0), ErrInvalidFormat, 5},
+		{"truncated", data[:len(data)-1], ErrUnexpectedEOF, 17},
+		{"trailing", append(append([]byte{}, data...), 0), ErrTrailingData, len(data)},
+		{"unknown type", message(byte(TypeArray), 1, '?'), ErrUnknownType, 7},
+	}
+	for _, tt := range tests {
+		s := NewScanner(tt.data)
+		for s.Scan() {
+		}
+		err := s.Err()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		var de *DecodeError
+		if isDecode := errors.As(err, &de); isDecode != (tt.offset >= 0) || isDecode && de.Offset != tt.offset {
+			t.Errorf("%s: got %#v, want a DecodeError at %d", tt.name, err, tt.offset)
+		}
+		if s.Scan() {
+			t.Errorf("%s: Scan succeeded after an error", tt.name)
+		}
+	}
+
+	// The Scanner applies the Config limits.
+	if _, err := scanAll(data, Config{MaxStringLen: 1}); !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("MaxStringLen: got %v, want ErrStringTooLong", err)
+	}
+	if _, err := scanAll(data, Config{MaxDepth: 1}); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("MaxDepth: got %v, want ErrMaxDepth", err)
+	}
+}
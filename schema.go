@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"time"
+)
+
+// EncodeWithSchema encodes data like encode, but precedes the top-level
+// array with a schema: 's', the element count, and the type identifier of
+// each top-level element. Consumers can check the shape with ReadSchema
+// before decoding, and DecodeWithSchema verifies that the values match it.
+//
+// The schema records the Go type of each element rather than its wire
+// form, so a string is TypeString even when dictionary encoded and an
+// int32 is TypeInt32 even as a varint. Nested arrays and maps appear as
+// TypeArray and TypeMap without their contents. Only DecodeWithSchema and
+// ReadSchema accept the result.
+func EncodeWithSchema(data DataInput) ([]byte, error) {
+	cfg := DefaultConfig.withDefaults()
+	if len(data) > cfg.MaxArrayLen {
+		return nil, limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(len(data)))
+	}
+	buf := appendVarint(append(appendHeader(nil, cfg), byte(TypeSchema)), uint64(len(data)))
+	for _, v := range data {
+		id, ok := valueType(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+		}
+		buf = append(buf, byte(id))
+	}
+	buf, err := encodeBody(data, buf, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Checksum {
+		buf = appendChecksum(buf)
+	}
+	return buf, nil
+}
+
+// ReadSchema returns the schema of a message written by EncodeWithSchema
+// without decoding its values.
+func ReadSchema(data []byte) ([]Type, error) {
+	data, pos, err := schemaStart(data)
+	if err != nil {
+		return nil, err
+	}
+	return readSchema(data, &pos, DefaultConfig.withDefaults())
+}
+
+// DecodeWithSchema decodes a message written by EncodeWithSchema and
+// checks that every top-level element has the type its schema records,
+// returning ErrSchemaMismatch if not. Integers keep their encoded types
+// even if DefaultConfig.NormalizeInts is set, since the check needs them.
+func DecodeWithSchema(data []byte) (DataInput, error) {
+	data, pos, err := schemaStart(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig.withDefaults()
+	cfg.NormalizeInts = false
+	schema, err := readSchema(data, &pos, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result, err := decodeBody(context.Background(), data, &pos, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != len(schema) {
+		return nil, fmt.Errorf("%w: %d elements, schema has %d", ErrSchemaMismatch, len(result), len(schema))
+	}
+	for i, v := range result {
+		if id, _ := valueType(v); id != schema[i] {
+			return nil, fmt.Errorf("%w: element %d is %T, schema has %c", ErrSchemaMismatch, i, v, schema[i])
+		}
+	}
+	return result, nil
+}
+
+// schemaStart checks the header and checksum of data and returns it
+// without the checksum, along with the position after the header.
+func schemaStart(data []byte) ([]byte, int, error) {
+	if len(data) == 0 {
+		return nil, 0, ErrEmptyInput
+	}
+	version, err := checkHeader(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version == VersionChecksum {
+		if data, err = verifyChecksum(data); err != nil {
+			return nil, 0, err
+		}
+	}
+	return data, headerLen, nil
+}
+
+// readSchema reads the schema starting at *pos.
+func readSchema(data []byte, pos *int, cfg *Config) ([]Type, error) {
+	start := *pos
+	if *pos >= len(data) || data[*pos] != byte(TypeSchema) {
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: ErrInvalidFormat}
+	}
+	*pos++
+	n, err := readLength(data, pos, cfg.MaxArrayLen, ErrArrayTooLong, "schema")
+	if err != nil {
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: err}
+	}
+	schema := make([]Type, n)
+	for i := range schema {
+		schema[i] = Type(data[*pos+i])
+	}
+	*pos += n
+	return schema, nil
+}
+
+// valueType returns the identifier a schema records for v: the type
+// identifier of its Go type, regardless of how encoding writes it.
+func valueType(v interface{}) (Type, bool) {
+	if id, ok := builtinType(v); ok {
+		return id, true
+	}
+
+	t := reflect.TypeOf(v)
+	registry.RLock()
+	defer registry.RUnlock()
+	if _, ok := registry.names[t]; ok {
+		if _, ok := v.(encoding.BinaryMarshaler); ok {
+			return TypeExtension, true
+		}
+	}
+	if id, ok := registry.ids[t]; ok {
+		return Type(id), true
+	}
+	return 0, false
+}
+
+// builtinType returns the identifier of v's Go type if encoding supports it
+// without any registration.
+func builtinType(v interface{}) (Type, bool) {
+	switch v.(type) {
+	case string:
+		return TypeString, true
+	case []byte:
+		return TypeBlob, true
+	case nil:
+		return TypeNull, true
+	case bool:
+		return TypeBool, true
+	case int8:
+		return TypeInt8, true
+	case int16:
+		return TypeInt16, true
+	case int32:
+		return TypeInt32, true
+	case int64, int:
+		return TypeInt64, true
+	case uint8:
+		return TypeUint8, true
+	case uint16:
+		return TypeUint16, true
+	case uint32:
+		return TypeUint32, true
+	case uint64:
+		return TypeUint64, true
+	case float32:
+		return TypeFloat32, true
+	case float64:
+		return TypeFloat64, true
+	case complex128:
+		return TypeComplex128, true
+	case Enum8:
+		return TypeEnum8, true
+	case Enum16:
+		return TypeEnum16, true
+	case *big.Int:
+		return TypeBigInt, true
+	case net.IP:
+		return TypeIP, true
+	case Decimal:
+		return TypeDecimal, true
+	case time.Time:
+		return TypeTime, true
+	case DataInput:
+		return TypeArray, true
+	case map[string]interface{}:
+		return TypeMap, true
+	}
+	return 0, false
+}
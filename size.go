@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// EncodedSize returns the exact number of bytes encode would produce for
+// data, without allocating the output. It reports the same errors as encode.
+func EncodedSize(data DataInput) (int, error) {
+	cfg := DefaultConfig.withDefaults()
+	var dict []string
+	if cfg.DictStrings {
+		cfg.dictIndex, dict = buildDict(data, cfg)
+	}
+	n, err := encodedSize(data, 1, cfg)
+	if err != nil {
+		return 0, err
+	}
+	if cfg.Checksum {
+		n += checksumLen
+	}
+	return headerLen + dictSize(dict) + n, nil
+}
+
+// encodedSize mirrors encodeHelper, summing sizes instead of writing bytes.
+func encodedSize(data DataInput, depth int, cfg *Config) (int, error) {
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+	if len(data) > cfg.MaxArrayLen {
+		return 0, limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(len(data)))
+	}
+	switch arrayEncoding(data, cfg) {
+	case TypeDeltaArray:
+		return deltaArraySize(data), nil
+	case TypeRunArray:
+		return runArraySize(data, cfg)
+	case TypeStringArray:
+		return stringArraySize(data, cfg)
+	}
+
+	size := 1 + varintLen(uint64(len(data))) // Identifier and array length
+	for _, v := range data {
+		n, err := valueSize(v, depth, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// valueSize returns the encoded size of a single element of an array at the
+// given depth.
+func valueSize(v interface{}, depth int, cfg *Config) (int, error) {
+	size := 0
+	switch v := v.(type) {
+	case string:
+		if err := checkUTF8(v, cfg); err != nil {
+			return 0, err
+		}
+		if idx, ok := cfg.dictIndex[v]; ok {
+			size += 1 + varintLen(idx)
+			break
+		}
+		if len(v) > cfg.MaxStringLen {
+			return 0, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(v)))
+		}
+		size += 1 + varintLen(uint64(len(v))) + len(v)
+	case []byte:
+		if len(v) > cfg.MaxBlobLen {
+			return 0, limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(len(v)))
+		}
+		size += 1 + varintLen(uint64(len(v))) + len(v)
+	case nil:
+		size++
+	case bool, int8, uint8, Enum8:
+		size += 2
+	case int16, uint16, Enum16:
+		size += 3
+	case uint32:
+		size += 5
+	case int32:
+		if cfg.VarintInts {
+			size += 1 + varintLen(uint64(zigzag32(v)))
+		} else {
+			size += 5
+		}
+	case float32:
+		if err := checkFloat(float64(v), cfg); err != nil {
+			return 0, err
+		}
+		size += 5
+	case float64:
+		if err := checkFloat(v, cfg); err != nil {
+			return 0, err
+		}
+		size += 9
+	case int64:
+		size += int64Size(v, cfg)
+	case int:
+		size += int64Size(int64(v), cfg)
+	case uint64:
+		size += 9
+	case complex128:
+		if err := checkFloat(real(v), cfg); err != nil {
+			return 0, err
+		}
+		if err := checkFloat(imag(v), cfg); err != nil {
+			return 0, err
+		}
+		size += 17
+	case *big.Int:
+		n, err := bigIntLen(v, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += 2 + varintLen(uint64(n)) + n
+	case net.IP:
+		n, err := ipSize(v)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	case Decimal:
+		n, err := decimalSize(v, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	case time.Time:
+		if !v.IsZero() && (v.Before(minTime) || v.After(maxTime)) {
+			return 0, fmt.Errorf("%w: %v", ErrTimeOutOfRange, v)
+		}
+		size += 9
+	case DataInput:
+		n, err := encodedSize(v, depth+1, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	case map[string]interface{}:
+		n, err := mapSize(v, depth+1, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	case encoding.BinaryMarshaler:
+		name, payload, err := extensionPayload(v, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += 1 + varintLen(uint64(len(name))) + len(name) + varintLen(uint64(len(payload))) + len(payload)
+	default:
+		_, payload, err := customPayload(v, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += 1 + varintLen(uint64(len(payload))) + len(payload)
+	}
+	return size, nil
+}
+
+// mapSize mirrors encodeMap.
+func mapSize(m map[string]interface{}, depth int, cfg *Config) (int, error) {
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+	if len(m) > cfg.MaxMapLen {
+		return 0, limitError(ErrMapTooLong, cfg.MaxMapLen, uint64(len(m)))
+	}
+
+	size := 1 + varintLen(uint64(len(m)))
+	for k, v := range m {
+		if len(k) > cfg.MaxStringLen {
+			return 0, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(k)))
+		}
+		if err := checkUTF8(k, cfg); err != nil {
+			return 0, err
+		}
+		n, err := valueSize(v, depth, cfg)
+		if err != nil {
+			return 0, err
+		}
+		size += varintLen(uint64(len(k))) + len(k) + n
+	}
+	return size, nil
+}
+
+// varintLen returns the number of bytes appendVarint uses for x.
+func varintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// TestEncodedSizeMatchesEncode checks EncodedSize against the length of
+// encode's output for random inputs of every type, plus a large string.
+func TestEncodedSizeMatchesEncode(t *testing.T) {
+	check := func(in DataInput) bool {
+		data, err := encode(in)
+		if err != nil {
+			t.Logf("encode %v: %v", in, err)
+			return false
+		}
+		n, err := EncodedSize(in)
+		if err != nil {
+			t.Logf("EncodedSize %v: %v", in, err)
+			return false
+		}
+		if n != len(data) {
+			t.Logf("EncodedSize %v = %d, encoded length %d", in, n, len(data))
+			return false
+		}
+		return true
+	}
+	if !check(DataInput{strings.Repeat("x", 1<<16), DataInput{DataInput{strings.Repeat("y", 200)}}}) {
+		t.Error("large strings")
+	}
+	property := func(in randomInput) bool { return check(DataInput(in)) }
+	qc := &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(15))}
+	if err := quick.Check(property, qc); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodedSizeErrors(t *testing.T) {
+	deep := DataInput{}
+	for i := 0; i < DefaultConfig.MaxDepth; i++ {
+		deep = DataInput{deep}
+	}
+	tests := []struct {
+		name string
+		in   DataInput
+		want error
+	}{
+		{"long array", make(DataInput, DefaultConfig.MaxArrayLen+1), ErrArrayTooLong},
+		{"long string", DataInput{strings.Repeat("x", DefaultConfig.MaxStringLen+1)}, ErrStringTooLong},
+		{"too deep", deep, ErrMaxDepth},
+		{"unsupported", DataInput{struct{}{}}, ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, encodeErr := encode(tt.in)
+			_, sizeErr := EncodedSize(tt.in)
+			if !errors.Is(encodeErr, tt.want) || !errors.Is(sizeErr, tt.want) {
+				t.Errorf("encode: %v, EncodedSize: %v; want %v from both", encodeErr, sizeErr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// fixedSize returns the payload size of identifiers whose values have a
+// fixed width, and false for variable-length identifiers.
+func fixedSize(id byte) (int, bool) {
+	switch Type(id) {
+	case TypeNull:
+		return 0, true
+	case TypeBool, TypeInt8, TypeUint8, TypeEnum8:
+		return 1, true
+	case TypeInt16, TypeUint16, TypeEnum16:
+		return 2, true
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 4, true
+	case TypeInt64, TypeUint64, TypeFloat64, TypeTime:
+		return 8, true
+	case TypeComplex128:
+		return 16, true
+	}
+	return 0, false
+}
+
+// skipValue advances *pos past the encoded value starting at *pos, scalar or
+// nested array, without allocating. It enforces the same rules and
+// DefaultConfig limits as decode, so a value that skips cleanly decodes,
+// provided any registered extension payloads are accepted by UnmarshalBinary.
+func skipValue(data []byte, pos *int) error {
+	return skipHelper(data, pos, 1, DefaultConfig.withDefaults())
+}
+
+// skipHelper recursively skips one value, tracking the nesting depth.
+func skipHelper(data []byte, pos *int, depth int, cfg *Config) error {
+	if *pos >= len(data) {
+		return ErrUnexpectedEOF
+	}
+	id := data[*pos]
+	*pos++
+
+	if n, ok := fixedSize(id); ok {
+		if len(data)-*pos < n {
+			// Naming the type allocates, so only do it on failure.
+			return need(data, *pos, n, string(rune(id)))
+		}
+		if Type(id) == TypeBool && data[*pos] > 1 {
+			return fmt.Errorf("%w: %d", ErrInvalidBool, data[*pos])
+		}
+		*pos += n
+		return nil
+	}
+
+	switch Type(id) {
+	case TypeString:
+		n, err := readLength(data, pos, cfg.MaxStringLen, ErrStringTooLong, "string")
+		if err != nil {
+			return err
+		}
+		if err := checkUTF8(bytesToString(data[*pos:*pos+n]), cfg); err != nil {
+			return err
+		}
+		addFlat(cfg, data[*pos:*pos+n])
+		*pos += n
+	case TypeBlob:
+		n, err := readLength(data, pos, cfg.MaxBlobLen, ErrBlobTooLong, "blob")
+		if err != nil {
+			return err
+		}
+		addFlat(cfg, data[*pos:*pos+n])
+		*pos += n
+	case TypeExtension:
+		name, _, err := readExtension(data, pos, cfg)
+		if err != nil {
+			return err
+		}
+		if !isRegistered(name) {
+			return fmt.Errorf("%w: %q", ErrUnregisteredType, name)
+		}
+	case TypeDictRef:
+		idx, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return err
+		}
+		if idx >= uint64(cfg.dictLen) {
+			return fmt.Errorf("%w: %d", ErrDictIndex, idx)
+		}
+		if cfg.flat != nil {
+			addFlat(cfg, stringToBytes(cfg.dict[idx]))
+		}
+		*pos += bytesRead
+	case TypeVarInt64:
+		_, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return err
+		}
+		*pos += bytesRead
+	case TypeVarInt32:
+		u, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return err
+		}
+		if u > math.MaxUint32 {
+			return fmt.Errorf("%w for varint int32", ErrIntOutOfRange)
+		}
+		*pos += bytesRead
+	case TypeBigInt:
+		if _, _, err := readBigInt(data, pos, cfg); err != nil {
+			return err
+		}
+	case TypeIP:
+		if _, err := readIPAddr(data, pos); err != nil {
+			return err
+		}
+	case TypeDecimal:
+		if _, _, err := readDecimal(data, pos, cfg); err != nil {
+			return err
+		}
+	case TypeDeltaArray:
+		return skipDeltaArray(data, pos, depth, cfg)
+	case TypeRunArray:
+		return skipRunArray(data, pos, depth, cfg)
+	case TypeStringArray:
+		return skipStringArray(data, pos, depth, cfg)
+	case TypeMap:
+		if depth > cfg.MaxDepth {
+			return ErrMaxDepth
+		}
+		length, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return err
+		}
+		*pos += bytesRead
+		if length > uint64(cfg.MaxMapLen) {
+			return fmt.Errorf("decoded %w", limitError(ErrMapTooLong, cfg.MaxMapLen, length))
+		}
+		var prev string
+		for i := uint64(0); i < length; i++ {
+			key, err := readRawString(data, pos, cfg)
+			if err != nil {
+				return err
+			}
+			if i > 0 && key <= prev {
+				return fmt.Errorf("%w: %q", ErrMapKeyOrder, key)
+			}
+			prev = key
+			if err := skipHelper(data, pos, depth+1, cfg); err != nil {
+				return err
+			}
+		}
+	case TypeOpenArray:
+		return skipOpenArray(data, pos, depth, cfg)
+	case TypeArray:
+		if depth > cfg.MaxDepth {
+			return ErrMaxDepth
+		}
+		length, bytesRead, err := readVarint(data[*pos:])
+		if err != nil {
+			return err
+		}
+		*pos += bytesRead
+		if length > uint64(cfg.MaxArrayLen) {
+			return fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, length))
+		}
+		for i := uint64(0); i < length; i++ {
+			if err := skipHelper(data, pos, depth+1, cfg); err != nil {
+				return err
+			}
+		}
+	default:
+		if _, ok := customCodec(id); !ok {
+			return fmt.Errorf("%w: %c", ErrUnknownType, id)
+		}
+		if _, err := readCustom(data, pos, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipOpenArray skips the elements of an open array whose identifier has
+// been consumed, along with its end marker.
+func skipOpenArray(data []byte, pos *int, depth int, cfg *Config) error {
+	if depth > cfg.MaxDepth {
+		return ErrMaxDepth
+	}
+	for n := 0; ; n++ {
+		if *pos >= len(data) {
+			return fmt.Errorf("%w while skipping open array", ErrUnexpectedEOF)
+		}
+		if data[*pos] == byte(TypeArrayEnd) {
+			*pos++
+			return nil
+		}
+		if n >= cfg.MaxArrayLen {
+			return fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(n)+1))
+		}
+		if err := skipHelper(data, pos, depth+1, cfg); err != nil {
+			return err
+		}
+	}
+}
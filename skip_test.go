@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestSkipValue skips one element of each type and checks it lands exactly
+// where decoding that element would, without allocating, and that the
+// following element then decodes correctly.
+func TestSkipValue(t *testing.T) {
+	registerTestDuration(t)
+	deep := DataInput{"leaf"}
+	for i := 0; i < 50; i++ {
+		deep = DataInput{int32(i), deep}
+	}
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"string", "hello"},
+		{"empty string", ""},
+		{"blob", []byte{0, 0xff}},
+		{"bool", true},
+		{"nil", nil},
+		{"int8", int8(-1)},
+		{"int16", int16(-300)},
+		{"int32", int32(1 << 20)},
+		{"int64", int64(-1 << 40)},
+		{"uint8", uint8(200)},
+		{"uint16", uint16(60000)},
+		{"uint32", uint32(1 << 31)},
+		{"uint64", uint64(1 << 63)},
+		{"float32", float32(1.5)},
+		{"float64", 2.5},
+		{"complex128", complex(1, -2)},
+		{"time", time.Unix(1, 2).UTC()},
+		{"enum8", Enum8(3)},
+		{"enum16", Enum16(-3)},
+		{"big.Int", new(big.Int).Lsh(big.NewInt(-3), 100)},
+		{"IPv4", net.IPv4(10, 0, 0, 1).To4()},
+		{"IPv6", net.ParseIP("2001:db8::1")},
+		{"Decimal", Decimal{Unscaled: big.NewInt(12345), Scale: 2}},
+		{"registered", time.Duration(5)},
+		{"empty array", DataInput{}},
+		{"deep array", deep},
+		{"map", map[string]interface{}{"a": DataInput{int32(1)}, "b": nil}},
+	}
+	cfg := DefaultConfig.withDefaults()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := roundTrip(t, DataInput{tt.v, "next"})
+			start := headerLen + 2 // Past the array identifier and its count
+
+			skipped := start
+			if err := skipValue(data, &skipped); err != nil {
+				t.Fatal(err)
+			}
+			decoded := start
+			if _, err := decodeValue(context.Background(), data, &decoded, 1, cfg, &budget{cfg: cfg}); err != nil {
+				t.Fatal(err)
+			}
+			if skipped != decoded {
+				t.Fatalf("skipped to %d, decoding ends at %d", skipped, decoded)
+			}
+			next, err := decodeValue(context.Background(), data, &skipped, 1, cfg, &budget{cfg: cfg})
+			if err != nil || next != "next" {
+				t.Fatalf("element after the skipped one: %v, %v", next, err)
+			}
+
+			if n := testing.AllocsPerRun(10, func() {
+				pos := start
+				skipValue(data, &pos)
+			}); n != 0 {
+				t.Errorf("skipValue allocated %v times, want 0", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// EncodeSlice encodes xs as a top-level array, saving callers from boxing a
+// []string, []int32, []float64 or other slice of a supported type into a
+// DataInput by hand. T may be any type encode accepts, including DataInput,
+// maps and registered types; any other T fails with ErrUnsupportedType
+// naming it. Unlike EncodeTypedArray the result is an ordinary message,
+// readable by decode and every other decoder.
+func EncodeSlice[T any](xs []T) ([]byte, error) {
+	d := make(DataInput, len(xs))
+	for i, x := range xs {
+		if _, ok := valueType(x); !ok {
+			return nil, fmt.Errorf("%w: EncodeSlice element %d is %T", ErrUnsupportedType, i, x)
+		}
+		d[i] = x
+	}
+	return encode(d)
+}
+
+// DecodeToSlice decodes a message whose top-level elements all have type T
+// into a []T, sparing callers a type assertion per element. An element of
+// any other type fails the whole decode with ErrTypeMismatch, naming its
+// index and type. As with decode, strings and blobs alias data. A nil
+// element is only accepted when T is an interface type such as
+// interface{}, and becomes its zero value.
+func DecodeToSlice[T any](data []byte) ([]T, error) {
+	d, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	var zero T
+	result := make([]T, len(d))
+	for i, v := range d {
+		x, ok := v.(T)
+		if !ok && (v != nil || any(zero) != nil) {
+			return nil, fmt.Errorf("%w: element %d is %T, not %T", ErrTypeMismatch, i, v, zero)
+		}
+		result[i] = x
+	}
+	return result, nil
+}
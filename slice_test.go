@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encodeSliceMatches checks EncodeSlice(xs) writes the same message as
+// encode of xs boxed into a DataInput by hand.
+func encodeSliceMatches[T any](t *testing.T, xs []T) {
+	t.Helper()
+	got, err := EncodeSlice(xs)
+	if err != nil {
+		t.Fatalf("%T: %v", xs, err)
+	}
+	d := make(DataInput, len(xs))
+	for i, x := range xs {
+		d[i] = x
+	}
+	want, err := encode(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%T: got %x, want %x", xs, got, want)
+	}
+	if decoded, err := decode(got); err != nil || !decoded.Equal(d) {
+		t.Errorf("%T: decoded %v, %v; want %v", xs, decoded, err, d)
+	}
+}
+
+func TestEncodeSlice(t *testing.T) {
+	encodeSliceMatches(t, []string{"a", "", "héllo"})
+	encodeSliceMatches(t, []int8{-1, 0, 1})
+	encodeSliceMatches(t, []int16{-300, 300})
+	encodeSliceMatches(t, []int32{1, -2, 3})
+	encodeSliceMatches(t, []int64{1 << 40, -1})
+	encodeSliceMatches(t, []uint8{0, 255})
+	encodeSliceMatches(t, []uint16{65535})
+	encodeSliceMatches(t, []uint32{1 << 31})
+	encodeSliceMatches(t, []uint64{1 << 63})
+	encodeSliceMatches(t, []float32{0.5, -1})
+	encodeSliceMatches(t, []float64{3.14, 0})
+	encodeSliceMatches(t, []bool{true, false})
+	encodeSliceMatches(t, [][]byte{{1, 2}, {}})
+	encodeSliceMatches(t, []time.Time{time.Unix(1700000000, 0).UTC()})
+	encodeSliceMatches(t, []DataInput{{"nested", int32(1)}, {}})
+	encodeSliceMatches(t, []map[string]interface{}{{"k": "v"}})
+	encodeSliceMatches(t, []interface{}{"mixed", int32(1), nil})
+	encodeSliceMatches(t, []string{})
+	encodeSliceMatches[string](t, nil)
+}
+
+func TestEncodeSliceUnsupported(t *testing.T) {
+	type point struct{ X, Y int }
+	tests := []struct {
+		name string
+		enc  func() ([]byte, error)
+		want string // In the error message
+	}{
+		{"struct", func() ([]byte, error) { return EncodeSlice([]point{{1, 2}}) }, "element 0 is main.point"},
+		{"pointer", func() ([]byte, error) { return EncodeSlice([]*int32{new(int32)}) }, "element 0 is *int32"},
+		{"channel", func() ([]byte, error) { return EncodeSlice([]chan int{make(chan int)}) }, "element 0 is chan int"},
+		{"interface", func() ([]byte, error) { return EncodeSlice([]interface{}{"ok", struct{}{}}) }, "element 1 is struct {}"},
+	}
+	for _, tt := range tests {
+		_, err := tt.enc()
+		if !errors.Is(err, ErrUnsupportedType) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want ErrUnsupportedType naming %q", tt.name, err, tt.want)
+		}
+	}
+
+	// The limits encode enforces still apply.
+	if _, err := EncodeSlice(make([]int32, DefaultConfig.MaxArrayLen+1)); !errors.Is(err, ErrArrayTooLong) {
+		t.Errorf("long slice: got %v, want ErrArrayTooLong", err)
+	}
+}
+
+func TestDecodeToSlice(t *testing.T) {
+	data, err := EncodeSlice([]string{"a", "", "héllo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs, err := DecodeToSlice[string](data)
+	if err != nil || len(strs) != 3 || strs[0] != "a" || strs[1] != "" || strs[2] != "héllo" {
+		t.Errorf("[]string: got %q, %v", strs, err)
+	}
+
+	data, err = EncodeSlice([]int32{1, -2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ints, err := DecodeToSlice[int32](data)
+	if err != nil || len(ints) != 3 || ints[0] != 1 || ints[1] != -2 || ints[2] != 3 {
+		t.Errorf("[]int32: got %v, %v", ints, err)
+	}
+
+	data, err = encode(DataInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty, err := DecodeToSlice[int32](data); err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("empty: got %#v, %v; want []int32{}", empty, err)
+	}
+
+	// Interface types take any element, nil included.
+	mixed := DataInput{"a", int32(1), nil}
+	data, err = encode(mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecodeToSlice[interface{}](data); err != nil || !DataInput(got).Equal(mixed) {
+		t.Errorf("[]interface{}: got %v, %v", got, err)
+	}
+}
+
+func TestDecodeToSliceMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		in   DataInput
+		dec  func([]byte) error
+		want string // In the error message
+	}{
+		{"int32 among strings", DataInput{"a", int32(1)}, func(d []byte) error { _, err := DecodeToSlice[string](d); return err }, "element 1 is int32, not string"},
+		{"nil among strings", DataInput{"a", nil}, func(d []byte) error { _, err := DecodeToSlice[string](d); return err }, "element 1 is <nil>, not string"},
+		{"int64 for int32", DataInput{int32(1), int64(2)}, func(d []byte) error { _, err := DecodeToSlice[int32](d); return err }, "element 1 is int64, not int32"},
+		{"nested array", DataInput{DataInput{int32(1)}}, func(d []byte) error { _, err := DecodeToSlice[int32](d); return err }, "element 0 is main.DataInput, not int32"},
+	}
+	for _, tt := range tests {
+		data, err := encode(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tt.dec(data)
+		if !errors.Is(err, ErrTypeMismatch) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want ErrTypeMismatch naming %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Decode errors pass through unchanged.
+	if _, err := DecodeToSlice[string](message(byte(TypeArray), 2)); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("truncated: got %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Element tags of the Snappy block format, in the low two bits of each
+// element's first byte.
+const (
+	snappyLiteral = 0
+	snappyCopy1   = 1 // 1-byte offset tail, length 4 to 11, offset below 2048
+	snappyCopy2   = 2 // 2-byte offset, length 1 to 64
+	snappyCopy4   = 3 // 4-byte offset, length 1 to 64; only decoded
+)
+
+// appendSnappy compresses src in the Snappy block format: a varint of its
+// length followed by literal and copy elements.
+func appendSnappy(dst, src []byte) []byte {
+	dst = appendVarint(dst, uint64(len(src)))
+	var table [1 << matchTableBits]int32 // Position + 1 of the last word with each hash
+	anchor := 0
+	for i := 0; i+4 <= len(src); {
+		h := matchHash(src, i)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > maxMatchOffset || load32(src, cand) != load32(src, i) {
+			i++
+			continue
+		}
+		end := i + 4
+		for end < len(src) && src[end] == src[cand+end-i] {
+			end++
+		}
+		if anchor < i {
+			dst = appendSnappyLiteral(dst, src[anchor:i])
+		}
+		dst = appendSnappyCopy(dst, i-cand, end-i)
+		i, anchor = end, end
+	}
+	if anchor < len(src) {
+		dst = appendSnappyLiteral(dst, src[anchor:])
+	}
+	return dst
+}
+
+// appendSnappyLiteral writes lit as one literal element. Lengths below 61
+// fit in the tag; longer ones follow it in 1 to 4 bytes.
+func appendSnappyLiteral(dst, lit []byte) []byte {
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyLiteral, byte(n))
+	case n < 1<<16:
+		dst = binary.LittleEndian.AppendUint16(append(dst, 61<<2|snappyLiteral), uint16(n))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = binary.LittleEndian.AppendUint32(append(dst, 63<<2|snappyLiteral), n)
+	}
+	return append(dst, lit...)
+}
+
+// appendSnappyCopy writes a match of length n at offset back as copy
+// elements of at most 64 bytes, never leaving a remainder below 4.
+func appendSnappyCopy(dst []byte, offset, n int) []byte {
+	for n >= 68 {
+		dst = appendSnappyCopy2(dst, offset, 64)
+		n -= 64
+	}
+	if n > 64 {
+		dst = appendSnappyCopy2(dst, offset, 60)
+		n -= 60
+	}
+	if n >= 12 || offset >= 2048 {
+		return appendSnappyCopy2(dst, offset, n)
+	}
+	return append(dst, byte(offset>>8)<<5|byte(n-4)<<2|snappyCopy1, byte(offset))
+}
+
+// appendSnappyCopy2 writes a copy element with a 2-byte offset.
+func appendSnappyCopy2(dst []byte, offset, n int) []byte {
+	return binary.LittleEndian.AppendUint16(append(dst, byte(n-1)<<2|snappyCopy2), uint16(offset))
+}
+
+// readSnappy decompresses a Snappy block, as written by appendSnappy or any
+// other Snappy implementation.
+func readSnappy(src []byte) ([]byte, error) {
+	n, i, err := readDecompressedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	dst := make([]byte, 0, n)
+	for i < len(src) {
+		tag := src[i]
+		var offset, length, size int // size counts the tag and its offset bytes
+		switch tag & 3 {
+		case snappyLiteral:
+			length, size = int(tag>>2)+1, 1
+			if length > 60 {
+				size += length - 60
+				if len(src)-i < size {
+					return nil, fmt.Errorf("%w while reading snappy literal", ErrUnexpectedEOF)
+				}
+				var b [4]byte
+				copy(b[:], src[i+1:i+size])
+				length = int(binary.LittleEndian.Uint32(b[:])) + 1
+			}
+			if length > len(src)-i-size || length > n-len(dst) {
+				return nil, fmt.Errorf("%w: snappy literal overrun", ErrCorruptCompressed)
+			}
+			dst = append(dst, src[i+size:i+size+length]...)
+			i += size + length
+			continue
+		case snappyCopy1:
+			size = 2
+			if len(src)-i >= size {
+				length = 4 + int(tag>>2&7)
+				offset = int(tag>>5)<<8 | int(src[i+1])
+			}
+		case snappyCopy2:
+			size, length = 3, int(tag>>2)+1
+			if len(src)-i >= size {
+				offset = int(binary.LittleEndian.Uint16(src[i+1:]))
+			}
+		case snappyCopy4:
+			size, length = 5, int(tag>>2)+1
+			if len(src)-i >= size {
+				offset = int(binary.LittleEndian.Uint32(src[i+1:]))
+			}
+		}
+		if len(src)-i < size {
+			return nil, fmt.Errorf("%w while reading snappy copy", ErrUnexpectedEOF)
+		}
+		if dst, err = appendMatch(dst, offset, length, n); err != nil {
+			return nil, err
+		}
+		i += size
+	}
+	if len(dst) != n {
+		return nil, fmt.Errorf("%w: snappy length mismatch", ErrCorruptCompressed)
+	}
+	return dst, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+)
+
+func TestSnappyRoundTrip(t *testing.T) {
+	for name, in := range codecInputs() {
+		out := appendSnappy(nil, in)
+		got, err := readSnappy(out)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, in) {
+			t.Errorf("%s: round trip changed %d bytes into %d", name, len(in), len(got))
+		}
+	}
+}
+
+// TestSnappyVectors decodes blocks built by hand from the Snappy format
+// description, one per element kind. No reference Snappy implementation is
+// available to the tests, so these stand in for one. Blocks marked encode
+// are also what appendSnappy writes.
+func TestSnappyVectors(t *testing.T) {
+	var seq []byte
+	for i := 0; i < 100; i++ {
+		seq = append(seq, byte(i))
+	}
+	tests := []struct {
+		name   string
+		block  string
+		want   []byte
+		encode bool
+	}{
+		{"literal", "051068656c6c6f", []byte("hello"), true},
+		{"literal with 1-byte length", "64f063" + hex.EncodeToString(seq), seq, true},
+		{"copy with 1-byte offset", "0c0861626315" + "03", []byte("abcabcabcabc"), false},
+		{"copy with 2-byte offset", "4100" + "61" + "fe0100", bytes.Repeat([]byte("a"), 65), false},
+		{"copy with 4-byte offset", "06" + "046162" + "0f02000000", []byte("ababab"), false},
+		{"empty", "00", []byte{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := hex.DecodeString(tt.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readSnappy(block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.encode {
+				if out := appendSnappy(nil, tt.want); !bytes.Equal(out, block) {
+					t.Errorf("appendSnappy = %x, want %x", out, block)
+				}
+			}
+		})
+	}
+}
+
+func TestSnappyCorrupt(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+	}{
+		{"zero offset", "0800616263" + "0100"},
+		{"offset before start", "0800616263" + "0104"},
+		{"longer than declared", "02" + "08616263"},
+		{"shorter than declared", "05" + "08616263"},
+		{"truncated literal", "05" + "1068656c"},
+		{"truncated copy", "06" + "046162" + "0f0200"},
+		{"huge declared length", "ffffffff0f" + "00"},
+	}
+	for _, tt := range tests {
+		block, err := hex.DecodeString(tt.block)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, err := readSnappy(block); err == nil {
+			t.Errorf("%s: decoded", tt.name)
+		}
+	}
+
+	r := rand.New(rand.NewSource(95))
+	for name, in := range codecInputs() {
+		out := appendSnappy(nil, in)
+		for n := 0; n < len(out); n += 1 + n/16 {
+			if _, err := readSnappy(out[:n]); err == nil {
+				t.Errorf("%s: truncated to %d of %d bytes decoded", name, n, len(out))
+			}
+		}
+		for i := 0; i < 200 && len(out) > 1; i++ {
+			bad := bytes.Clone(out)
+			bad[1+r.Intn(len(bad)-1)] ^= byte(1 + r.Intn(255))
+			if got, err := readSnappy(bad); err == nil && len(got) != len(in) {
+				t.Errorf("%s: corrupt block decoded to %d bytes, want %d", name, len(got), len(in))
+			}
+		}
+	}
+}
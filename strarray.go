@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// isStringArray reports whether d is non-empty and holds only strings, none
+// of them in the dictionary of the message being encoded, which would
+// write it more compactly as a reference.
+func isStringArray(d DataInput, cfg *Config) bool {
+	if len(d) == 0 {
+		return false
+	}
+	for _, v := range d {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		if _, inDict := cfg.dictIndex[s]; inDict {
+			return false
+		}
+	}
+	return true
+}
+
+// appendStringArray writes an all-string array as 'G', the element count,
+// and each string as its varint length and bytes, without the per-element
+// identifier of the plain form.
+func appendStringArray(buf []byte, data DataInput, w io.Writer, cfg *Config) ([]byte, error) {
+	buf = append(buf, byte(TypeStringArray))
+	buf = appendVarint(buf, uint64(len(data)))
+	for _, v := range data {
+		s := v.(string)
+		if len(s) > cfg.MaxStringLen {
+			return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(s)))
+		}
+		if err := checkUTF8(s, cfg); err != nil {
+			return nil, err
+		}
+		buf = append(appendVarint(buf, uint64(len(s))), s...)
+		var err error
+		if buf, err = flush(buf, w); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// stringArraySize returns the number of bytes appendStringArray writes for
+// data.
+func stringArraySize(data DataInput, cfg *Config) (int, error) {
+	size := 1 + varintLen(uint64(len(data)))
+	for _, v := range data {
+		s := v.(string)
+		if len(s) > cfg.MaxStringLen {
+			return 0, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(s)))
+		}
+		if err := checkUTF8(s, cfg); err != nil {
+			return 0, err
+		}
+		size += varintLen(uint64(len(s))) + len(s)
+	}
+	return size, nil
+}
+
+// readStringArrayLen reads the element count of a string array whose
+// identifier has already been consumed, checking the count and depth
+// against cfg.
+func readStringArrayLen(data []byte, pos *int, depth int, cfg *Config) (uint64, error) {
+	if depth > cfg.MaxDepth {
+		return 0, ErrMaxDepth
+	}
+	length, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return 0, err
+	}
+	*pos += bytesRead
+	if length > uint64(cfg.MaxArrayLen) {
+		return 0, fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, length))
+	}
+	if !lengthFits(length, data, *pos, minElementSize) { // Each string is at least its length byte
+		return 0, fmt.Errorf("%w while reading string array", ErrUnexpectedEOF)
+	}
+	return length, nil
+}
+
+// readStringArray decodes a string array whose identifier has already been
+// consumed, also returning the total length of its strings.
+func readStringArray(data []byte, pos *int, depth int, cfg *Config) (DataInput, int, error) {
+	length, err := readStringArrayLen(data, pos, depth, cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := newArray(length)
+	total := 0
+	for i := uint64(0); i < length; i++ {
+		s, err := readRawString(data, pos, cfg)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, s)
+		total += len(s)
+	}
+	return result, total, nil
+}
+
+// skipStringArray advances past a string array whose identifier has
+// already been consumed.
+func skipStringArray(data []byte, pos *int, depth int, cfg *Config) error {
+	length, err := readStringArrayLen(data, pos, depth, cfg)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < length; i++ {
+		n, err := readLength(data, pos, cfg.MaxStringLen, ErrStringTooLong, "string")
+		if err != nil {
+			return err
+		}
+		if err := checkUTF8(bytesToString(data[*pos:*pos+n]), cfg); err != nil {
+			return err
+		}
+		addFlat(cfg, data[*pos:*pos+n])
+		*pos += n
+	}
+	return nil
+}
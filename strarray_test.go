@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStringArrayLayout(t *testing.T) {
+	data, err := EncodeWithConfig(DataInput{int32(1), DataInput{"a", "bc"}}, Config{StringArrays: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{byte(TypeArray), 2, byte(TypeInt32), 0, 0, 0, 1, byte(TypeStringArray), 2, 1, 'a', 2, 'b', 'c'}
+	if !bytes.Equal(data[headerLen:], want) {
+		t.Errorf("got %x, want %x", data[headerLen:], want)
+	}
+}
+
+// TestStringArrayMatchesGeneric checks that all-string arrays written in the
+// string array form decode, through every decoder, to what the generic
+// form decodes to, and cost one identifier byte less per string.
+func TestStringArrayMatchesGeneric(t *testing.T) {
+	many := make(DataInput, DefaultConfig.MaxArrayLen)
+	for i := range many {
+		many[i] = strings.Repeat("s", i%7)
+	}
+	tests := []struct {
+		name    string
+		in      DataInput
+		strings int // Strings that gain the compact form
+	}{
+		{"one", DataInput{"only"}, 1},
+		{"empty strings", DataInput{"", "", ""}, 3},
+		{"unicode", DataInput{"héllo", "日本語", "🙂"}, 3},
+		{"long", DataInput{strings.Repeat("x", 300), "y"}, 2},
+		{"full", many, len(many)},
+		{"nested", DataInput{int32(1), DataInput{"a", "b"}, DataInput{DataInput{"c"}}}, 3},
+		{"in a map", DataInput{map[string]interface{}{"k": DataInput{"a", "b"}}}, 2},
+		{"mixed", DataInput{"a", int32(1), "b"}, 0},
+		{"nil element", DataInput{"a", nil}, 0},
+		{"empty", DataInput{}, 0},
+	}
+	fast := Config{StringArrays: true}
+	for _, tt := range tests {
+		generic, err := encode(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, err := EncodeWithConfig(tt.in, fast)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if saved := len(generic) - len(data); saved != tt.strings {
+			t.Errorf("%s: saved %d bytes, want %d", tt.name, saved, tt.strings)
+		}
+		if size, err := encodedSize(tt.in, 1, fast.withDefaults()); err != nil || headerLen+size != len(data) {
+			t.Errorf("%s: encodedSize %d, %v; want %d", tt.name, headerLen+size, err, len(data))
+		}
+		if err := Validate(data); err != nil {
+			t.Errorf("%s: Validate: %v", tt.name, err)
+		}
+
+		want, err := decode(generic)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		decoders := []struct {
+			name   string
+			decode func([]byte) (DataInput, error)
+		}{
+			{"decode", decode},
+			{"DecodeSafe", DecodeSafe},
+			{"Decoder", func(data []byte) (DataInput, error) { return NewDecoder(bytes.NewReader(data)).Decode() }},
+		}
+		for _, d := range decoders {
+			got, err := d.decode(data)
+			if err != nil || !got.Equal(want) {
+				t.Errorf("%s: %s got %v, %v; want %v", tt.name, d.name, got, err, want)
+			}
+		}
+	}
+}
+
+// TestStringArrayDictionary checks strings already in the dictionary keep
+// the shorter reference form instead of a string array.
+func TestStringArrayDictionary(t *testing.T) {
+	in := DataInput{"rep", "rep", DataInput{"rep", "other"}, DataInput{"fresh", "new"}}
+	data, err := EncodeWithConfig(in, Config{StringArrays: true, DictStrings: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bytes.Count(data, []byte{byte(TypeStringArray)}); got != 1 {
+		t.Errorf("wrote %d string arrays, want 1 for the array without dictionary strings", got)
+	}
+	if got, err := decode(data); err != nil || !got.Equal(in) {
+		t.Errorf("got %v, %v; want %v", got, err, in)
+	}
+}
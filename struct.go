@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"time"
+)
+
+// structTag is the struct tag consulted by EncodeStruct; a value of "-"
+// skips the field.
+const structTag = "clickhouse"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+	ipType      = reflect.TypeOf(net.IP(nil))
+	decimalType = reflect.TypeOf(Decimal{})
+	enum8Type   = reflect.TypeOf(Enum8(0))
+	enum16Type  = reflect.TypeOf(Enum16(0))
+)
+
+// EncodeStruct encodes the exported fields of the struct v (or pointer to
+// struct), in declaration order, as a DataInput. Nested structs and slices
+// become nested arrays, maps with string keys become maps, and []byte
+// becomes a blob. Fields tagged
+// `clickhouse:"-"` are skipped. Each nested struct, slice, map, pointer
+// and interface counts as a level against DefaultConfig.MaxDepth, so a
+// value that refers back to itself fails with ErrMaxDepth.
+func EncodeStruct(v interface{}) ([]byte, error) {
+	data, err := StructToDataInput(v)
+	if err != nil {
+		return nil, err
+	}
+	return encode(data)
+}
+
+// StructToDataInput converts a struct to the DataInput EncodeStruct encodes.
+func StructToDataInput(v interface{}) (DataInput, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%w: EncodeStruct of nil pointer", ErrUnsupportedType)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: EncodeStruct of %T, expected struct", ErrUnsupportedType, v)
+	}
+	return structValue(rv, 1)
+}
+
+// structValue converts the encodable fields of a struct value that becomes
+// an array at the given nesting depth.
+func structValue(rv reflect.Value, depth int) (DataInput, error) {
+	if depth > DefaultConfig.MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	rt := rv.Type()
+	result := make(DataInput, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() || field.Tag.Get(structTag) == "-" {
+			continue
+		}
+		elem, err := reflectElement(rv.Field(i), depth)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+// reflectElement converts a single Go value to an element of an array at
+// the given nesting depth.
+func reflectElement(v reflect.Value, depth int) (interface{}, error) {
+	if v.Type() == timeType {
+		return v.Interface(), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+	}
+	if v.Type() == ipType {
+		return append(net.IP(nil), v.Bytes()...), nil
+	}
+	if t := v.Type(); t == decimalType || t == enum8Type || t == enum16Type {
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int8:
+		return int8(v.Int()), nil
+	case reflect.Int16:
+		return int16(v.Int()), nil
+	case reflect.Int32:
+		return int32(v.Int()), nil
+	case reflect.Int64, reflect.Int:
+		return v.Int(), nil
+	case reflect.Uint8:
+		return uint8(v.Uint()), nil
+	case reflect.Uint16:
+		return uint16(v.Uint()), nil
+	case reflect.Uint32:
+		return uint32(v.Uint()), nil
+	case reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32:
+		return float32(v.Float()), nil
+	case reflect.Float64:
+		return v.Float(), nil
+	case reflect.Complex128:
+		return v.Complex(), nil
+	case reflect.Struct:
+		return structValue(v, depth+1)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if depth+1 > DefaultConfig.MaxDepth {
+			return nil, ErrMaxDepth
+		}
+		return reflectElement(v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			blob := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(blob), v)
+			return blob, nil
+		}
+		if depth+1 > DefaultConfig.MaxDepth {
+			return nil, ErrMaxDepth
+		}
+		result := make(DataInput, v.Len())
+		for i := range result {
+			elem, err := reflectElement(v.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = elem
+		}
+		return result, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		if depth+1 > DefaultConfig.MaxDepth {
+			return nil, ErrMaxDepth
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := reflectElement(iter.Value(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result[iter.Key().String()] = elem
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, v.Type())
+}
+
+// DecodeStruct decodes a message produced by EncodeStruct into the struct
+// pointed to by v, assigning elements to exported, untagged fields in
+// declaration order. It fails if the element count differs from the field
+// count or an element's type does not fit its field. Strings and blobs are
+// copied, so v does not alias data.
+func DecodeStruct(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: DecodeStruct into %T, expected non-nil pointer to struct", ErrUnsupportedType, v)
+	}
+
+	decoded, err := DecodeSafe(data)
+	if err != nil {
+		return err
+	}
+	return assignStruct(rv.Elem(), decoded)
+}
+
+// assignStruct assigns the elements of d to the encodable fields of rv.
+func assignStruct(rv reflect.Value, d DataInput) error {
+	rt := rv.Type()
+	n := 0
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() || field.Tag.Get(structTag) == "-" {
+			continue
+		}
+		if n >= len(d) {
+			return fmt.Errorf("%w: struct %s has more fields than the %d decoded elements", ErrFieldCount, rt, len(d))
+		}
+		if err := assignElement(rv.Field(i), d[n]); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		n++
+	}
+	if n != len(d) {
+		return fmt.Errorf("%w: struct %s has %d fields, decoded %d elements", ErrFieldCount, rt, n, len(d))
+	}
+	return nil
+}
+
+// assignElement stores a decoded element into dst, checking that its type fits.
+func assignElement(dst reflect.Value, elem interface{}) error {
+	if dst.Type() == timeType {
+		t, ok := elem.(time.Time)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if dst.Type() == bigIntType {
+		if elem == nil {
+			dst.SetZero()
+			return nil
+		}
+		b, ok := elem.(*big.Int)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.Set(reflect.ValueOf(b))
+		return nil
+	}
+	if dst.Type() == ipType {
+		ip, ok := elem.(net.IP)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.Set(reflect.ValueOf(ip))
+		return nil
+	}
+	if t := dst.Type(); t == decimalType || t == enum8Type || t == enum16Type {
+		if reflect.TypeOf(elem) != t {
+			return typeMismatch(elem, dst)
+		}
+		dst.Set(reflect.ValueOf(elem))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		s, ok := elem.(string)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		b, ok := elem.(bool)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetBool(b)
+	case reflect.Int8:
+		i, ok := elem.(int8)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetInt(int64(i))
+	case reflect.Int16:
+		i, ok := elem.(int16)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetInt(int64(i))
+	case reflect.Int32:
+		i, ok := elem.(int32)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetInt(int64(i))
+	case reflect.Int64, reflect.Int:
+		i, ok := elem.(int64)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetInt(i)
+	case reflect.Uint8:
+		u, ok := elem.(uint8)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetUint(uint64(u))
+	case reflect.Uint16:
+		u, ok := elem.(uint16)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetUint(uint64(u))
+	case reflect.Uint32:
+		u, ok := elem.(uint32)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetUint(uint64(u))
+	case reflect.Uint64:
+		u, ok := elem.(uint64)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetUint(u)
+	case reflect.Float32:
+		f, ok := elem.(float32)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetFloat(float64(f))
+	case reflect.Float64:
+		f, ok := elem.(float64)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetFloat(f)
+	case reflect.Complex128:
+		c, ok := elem.(complex128)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.SetComplex(c)
+	case reflect.Struct:
+		d, ok := elem.(DataInput)
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		return assignStruct(dst, d)
+	case reflect.Pointer:
+		if elem == nil {
+			dst.SetZero()
+			return nil
+		}
+		ptr := reflect.New(dst.Type().Elem())
+		if err := assignElement(ptr.Elem(), elem); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+	case reflect.Interface:
+		if elem == nil {
+			dst.SetZero()
+			return nil
+		}
+		ev := reflect.ValueOf(elem)
+		if !ev.Type().AssignableTo(dst.Type()) {
+			return typeMismatch(elem, dst)
+		}
+		dst.Set(ev)
+	case reflect.Slice, reflect.Array:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			b, ok := elem.([]byte)
+			if !ok || (dst.Kind() == reflect.Array && len(b) != dst.Len()) {
+				return typeMismatch(elem, dst)
+			}
+			if dst.Kind() == reflect.Slice {
+				dst.Set(reflect.MakeSlice(dst.Type(), len(b), len(b)))
+			}
+			reflect.Copy(dst, reflect.ValueOf(b))
+			return nil
+		}
+		d, ok := elem.(DataInput)
+		if !ok || (dst.Kind() == reflect.Array && len(d) != dst.Len()) {
+			return typeMismatch(elem, dst)
+		}
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(d), len(d)))
+		}
+		for i, e := range d {
+			if err := assignElement(dst.Index(i), e); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		if dst.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%w: %s", ErrUnsupportedType, dst.Type())
+		}
+		if elem == nil {
+			dst.SetZero()
+			return nil
+		}
+		m, ok := elem.(map[string]interface{})
+		if !ok {
+			return typeMismatch(elem, dst)
+		}
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), len(m)))
+		for k, e := range m {
+			val := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignElement(val, e); err != nil {
+				return fmt.Errorf("key %q: %w", k, err)
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), val)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, dst.Type())
+	}
+	return nil
+}
+
+// typeMismatch reports that elem cannot be stored in dst.
+func typeMismatch(elem interface{}, dst reflect.Value) error {
+	return fmt.Errorf("%w: cannot assign %T to %s", ErrTypeMismatch, elem, dst.Type())
+}
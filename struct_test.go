@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type point struct {
+	X, Y int32
+}
+
+type record struct {
+	Name    string
+	ID      int32
+	Where   point
+	Secret  string `clickhouse:"-"`
+	Tags    []string
+	private int32
+	Count   int32
+}
+
+func TestEncodeStruct(t *testing.T) {
+	in := record{
+		Name:    "gauge",
+		ID:      7,
+		Where:   point{-1, 2},
+		Secret:  "skipped",
+		Tags:    []string{"a", "b"},
+		private: 9,
+		Count:   3,
+	}
+	want := DataInput{"gauge", int32(7), DataInput{int32(-1), int32(2)}, DataInput{"a", "b"}, int32(3)}
+
+	d, err := StructToDataInput(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal(want) {
+		t.Errorf("StructToDataInput = %v, want %v", d, want)
+	}
+	data, err := EncodeStruct(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, roundTrip(t, want)) {
+		t.Errorf("EncodeStruct differs from encoding %v", want)
+	}
+
+	var out record
+	if err := DecodeStruct(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Secret, in.private = "", 0
+	if out.Name != in.Name || out.ID != in.ID || out.Where != in.Where || out.Count != in.Count ||
+		len(out.Tags) != 2 || out.Tags[0] != "a" || out.Tags[1] != "b" || out.Secret != "" || out.private != 0 {
+		t.Errorf("DecodeStruct = %+v, want %+v", out, in)
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+type holder struct {
+	V interface{}
+}
+
+// TestEncodeStructCycles checks that values referring back to themselves
+// fail with ErrMaxDepth instead of overflowing the stack.
+func TestEncodeStructCycles(t *testing.T) {
+	n := &node{Name: "loop"}
+	n.Next = n
+	if _, err := EncodeStruct(n); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("pointer cycle: got %v, want ErrMaxDepth", err)
+	}
+
+	var self interface{}
+	self = &self
+	if _, err := EncodeStruct(holder{self}); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("interface cycle: got %v, want ErrMaxDepth", err)
+	}
+
+	s := []interface{}{nil}
+	s[0] = s
+	if _, err := EncodeStruct(holder{s}); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("slice cycle: got %v, want ErrMaxDepth", err)
+	}
+
+	// A finite chain within the limit still encodes.
+	chain := &node{Name: "end"}
+	for i := 0; i < 20; i++ {
+		chain = &node{Name: "link", Next: chain}
+	}
+	if _, err := EncodeStruct(chain); err != nil {
+		t.Errorf("chain of 20: %v", err)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	var nilRecord *record
+	if _, err := EncodeStruct(nilRecord); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("nil pointer: got %v, want ErrUnsupportedType", err)
+	}
+	if _, err := EncodeStruct(42); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("non-struct: got %v, want ErrUnsupportedType", err)
+	}
+	if _, err := EncodeStruct(holder{make(chan int)}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("chan field: got %v, want ErrUnsupportedType", err)
+	}
+
+	data := roundTrip(t, DataInput{int32(1), int32(2)})
+	var p point
+	if err := DecodeStruct(data, p); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("non-pointer: got %v, want ErrUnsupportedType", err)
+	}
+	var r record
+	if err := DecodeStruct(data, &r); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("int32 into string: got %v, want ErrTypeMismatch", err)
+	}
+	if err := DecodeStruct(roundTrip(t, DataInput{int32(1)}), &p); !errors.Is(err, ErrFieldCount) {
+		t.Errorf("too few elements: got %v, want ErrFieldCount", err)
+	}
+	if err := DecodeStruct(roundTrip(t, DataInput{int32(1), int32(2), int32(3)}), &p); !errors.Is(err, ErrFieldCount) {
+		t.Errorf("too many elements: got %v, want ErrFieldCount", err)
+	}
+}
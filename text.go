@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// EncodeToBase64 encodes data and returns the message as standard padded
+// base64, for embedding in JSON or other text.
+func EncodeToBase64(data DataInput) (string, error) {
+	return EncodeToBase64WithEncoding(data, base64.StdEncoding)
+}
+
+// EncodeToBase64WithEncoding is like EncodeToBase64 but uses enc, such as
+// base64.URLEncoding or base64.RawURLEncoding for use in URLs.
+func EncodeToBase64WithEncoding(data DataInput, enc *base64.Encoding) (string, error) {
+	encoded, err := encode(data)
+	if err != nil {
+		return "", err
+	}
+	return enc.EncodeToString(encoded), nil
+}
+
+// DecodeFromBase64 decodes a message produced by EncodeToBase64.
+func DecodeFromBase64(s string) (DataInput, error) {
+	return DecodeFromBase64WithEncoding(s, base64.StdEncoding)
+}
+
+// DecodeFromBase64WithEncoding decodes a message produced by
+// EncodeToBase64WithEncoding with the same enc.
+func DecodeFromBase64WithEncoding(s string, enc *base64.Encoding) (DataInput, error) {
+	received, err := enc.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return decode(received) // received is ours, so decoded strings may alias it
+}
+
+// EncodeToHex encodes data and returns the message as lowercase hex, for
+// logs and test fixtures.
+func EncodeToHex(data DataInput) (string, error) {
+	encoded, err := encode(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(encoded), nil
+}
+
+// DecodeFromHex decodes a message produced by EncodeToHex. Either letter
+// case is accepted; odd-length input returns hex.ErrLength and a non-hex
+// character a hex.InvalidByteError.
+func DecodeFromHex(s string) (DataInput, error) {
+	received, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return decode(received)
+}
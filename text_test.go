@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// textInput is a message whose encoding contains every byte value, so its
+// base64 uses the characters where the alphabets differ.
+func textInput() DataInput {
+	blob := make([]byte, 256)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	return DataInput{"text", int32(-1), blob, DataInput{true, nil}}
+}
+
+func TestBase64RoundTrip(t *testing.T) {
+	in := textInput()
+	tests := []struct {
+		name string
+		enc  *base64.Encoding
+		bad  string // Characters enc never produces
+	}{
+		{"standard", base64.StdEncoding, "-_"},
+		{"URL-safe", base64.URLEncoding, "+/"},
+		{"raw URL-safe", base64.RawURLEncoding, "+/="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := EncodeToBase64WithEncoding(in, tt.enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.ContainsAny(s, tt.bad) {
+				t.Errorf("%q contains one of %q", s, tt.bad)
+			}
+			got, err := DecodeFromBase64WithEncoding(s, tt.enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(in) {
+				t.Errorf("got %v, want %v", got, in)
+			}
+		})
+	}
+
+	// The defaults are the standard alphabet, and the alphabets are not
+	// interchangeable.
+	std, err := EncodeToBase64(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := EncodeToBase64WithEncoding(in, base64.StdEncoding); std != want {
+		t.Errorf("EncodeToBase64 = %q, want the standard encoding %q", std, want)
+	}
+	if got, err := DecodeFromBase64(std); err != nil || !got.Equal(in) {
+		t.Errorf("DecodeFromBase64: %v, %v", got, err)
+	}
+	url, _ := EncodeToBase64WithEncoding(in, base64.URLEncoding)
+	if _, err := DecodeFromBase64(url); err == nil {
+		t.Error("standard decoding accepted URL-safe input")
+	}
+}
+
+func TestBase64Malformed(t *testing.T) {
+	var corrupt base64.CorruptInputError
+	for _, s := range []string{"Q0hESQ", "Q0hE*Q==", "Q0hESQ===="} {
+		if _, err := DecodeFromBase64(s); !errors.As(err, &corrupt) {
+			t.Errorf("%q: got %v, want base64.CorruptInputError", s, err)
+		}
+	}
+	// Valid base64 of an invalid message reports the decode error.
+	if _, err := DecodeFromBase64(base64.StdEncoding.EncodeToString([]byte("CHDX\x01"))); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("bad magic: got %v, want ErrBadMagic", err)
+	}
+}
+
+func TestHexRoundTrip(t *testing.T) {
+	in := textInput()
+	s, err := EncodeToHex(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != strings.ToLower(s) || !strings.HasPrefix(s, hex.EncodeToString([]byte("CHDI"))) {
+		t.Errorf("%.20s... is not lowercase hex of a message", s)
+	}
+	for _, variant := range []string{s, strings.ToUpper(s)} {
+		got, err := DecodeFromHex(variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(in) {
+			t.Errorf("got %v, want %v", got, in)
+		}
+	}
+}
+
+func TestHexMalformed(t *testing.T) {
+	s, err := EncodeToHex(DataInput{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeFromHex(s[:len(s)-1]); !errors.Is(err, hex.ErrLength) {
+		t.Errorf("odd length: got %v, want hex.ErrLength", err)
+	}
+	var invalid hex.InvalidByteError
+	if _, err := DecodeFromHex("zz" + s[2:]); !errors.As(err, &invalid) || byte(invalid) != 'z' {
+		t.Errorf("non-hex: got %v, want hex.InvalidByteError('z')", err)
+	}
+	if _, err := DecodeFromHex(s[:len(s)-2]); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("truncated message: got %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// EncodeTypedArray encodes a slice of a single scalar type as a typed array,
+// the counterpart of ClickHouse's Array(T): after the header come 't', the
+// element type identifier, the element count, and each element's payload
+// with no identifier of its own. For fixed-width types this saves a byte
+// per element over the equivalent DataInput.
+//
+// values must be a []string, [][]byte, []bool, []int8, []int16, []int32,
+// []int64, []uint8, []uint16, []uint32, []uint64, []float32 or []float64;
+// DecodeTypedArray returns a slice of the same type. Limits and the
+// VarintInts, Checksum and Endianness options come from DefaultConfig.
+func EncodeTypedArray(values interface{}) ([]byte, error) {
+	return EncodeTypedArrayWithConfig(values, DefaultConfig)
+}
+
+// EncodeTypedArrayWithConfig is like EncodeTypedArray but takes its limits
+// and options from cfg. With VarintInts, []int32 and []int64 elements are
+// written as zigzag varints.
+func EncodeTypedArrayWithConfig(values interface{}, cfg Config) ([]byte, error) {
+	c := cfg.withDefaults()
+	buf, err := appendTypedArray(appendHeader(nil, c), values, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Checksum {
+		buf = appendChecksum(buf)
+	}
+	return buf, nil
+}
+
+// appendTypedArray appends 't', the element type and count, and the
+// payloads of values.
+func appendTypedArray(buf []byte, values interface{}, cfg *Config) ([]byte, error) {
+	// typed writes the array prefix for n elements of type id.
+	typed := func(id Type, n int) error {
+		if n > cfg.MaxArrayLen {
+			return limitError(ErrArrayTooLong, cfg.MaxArrayLen, uint64(n))
+		}
+		buf = append(buf, byte(TypeTypedArray), byte(id))
+		buf = appendVarint(buf, uint64(n))
+		return nil
+	}
+
+	var err error
+	switch v := values.(type) {
+	case []string:
+		if err = typed(TypeString, len(v)); err != nil {
+			return nil, err
+		}
+		for _, s := range v {
+			if len(s) > cfg.MaxStringLen {
+				return nil, limitError(ErrStringTooLong, cfg.MaxStringLen, uint64(len(s)))
+			}
+			if err = checkUTF8(s, cfg); err != nil {
+				return nil, err
+			}
+			buf = append(appendVarint(buf, uint64(len(s))), s...)
+		}
+	case [][]byte:
+		if err = typed(TypeBlob, len(v)); err != nil {
+			return nil, err
+		}
+		for _, b := range v {
+			if len(b) > cfg.MaxBlobLen {
+				return nil, limitError(ErrBlobTooLong, cfg.MaxBlobLen, uint64(len(b)))
+			}
+			buf = append(appendVarint(buf, uint64(len(b))), b...)
+		}
+	case []bool:
+		if err = typed(TypeBool, len(v)); err != nil {
+			return nil, err
+		}
+		for _, b := range v {
+			if b {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+	case []int8:
+		if err = typed(TypeInt8, len(v)); err != nil {
+			return nil, err
+		}
+		for _, i := range v {
+			buf = append(buf, byte(i))
+		}
+	case []int16:
+		if err = typed(TypeInt16, len(v)); err != nil {
+			return nil, err
+		}
+		for _, i := range v {
+			buf = cfg.Endianness.appendUint16(buf, uint16(i))
+		}
+	case []int32:
+		if cfg.VarintInts {
+			if err = typed(TypeVarInt32, len(v)); err != nil {
+				return nil, err
+			}
+			for _, i := range v {
+				buf = appendVarint(buf, uint64(zigzag32(i)))
+			}
+			break
+		}
+		if err = typed(TypeInt32, len(v)); err != nil {
+			return nil, err
+		}
+		for _, i := range v {
+			buf = cfg.Endianness.appendUint32(buf, uint32(i))
+		}
+	case []int64:
+		if cfg.VarintInts {
+			if err = typed(TypeVarInt64, len(v)); err != nil {
+				return nil, err
+			}
+			for _, i := range v {
+				buf = appendVarint(buf, zigzag64(i))
+			}
+			break
+		}
+		if err = typed(TypeInt64, len(v)); err != nil {
+			return nil, err
+		}
+		for _, i := range v {
+			buf = cfg.Endianness.appendUint64(buf, uint64(i))
+		}
+	case []uint8:
+		if err = typed(TypeUint8, len(v)); err != nil {
+			return nil, err
+		}
+		buf = append(buf, v...)
+	case []uint16:
+		if err = typed(TypeUint16, len(v)); err != nil {
+			return nil, err
+		}
+		for _, u := range v {
+			buf = cfg.Endianness.appendUint16(buf, u)
+		}
+	case []uint32:
+		if err = typed(TypeUint32, len(v)); err != nil {
+			return nil, err
+		}
+		for _, u := range v {
+			buf = cfg.Endianness.appendUint32(buf, u)
+		}
+	case []uint64:
+		if err = typed(TypeUint64, len(v)); err != nil {
+			return nil, err
+		}
+		for _, u := range v {
+			buf = cfg.Endianness.appendUint64(buf, u)
+		}
+	case []float32:
+		if err = typed(TypeFloat32, len(v)); err != nil {
+			return nil, err
+		}
+		for _, f := range v {
+			if err = checkFloat(float64(f), cfg); err != nil {
+				return nil, err
+			}
+			buf = cfg.Endianness.appendUint32(buf, math.Float32bits(f))
+		}
+	case []float64:
+		if err = typed(TypeFloat64, len(v)); err != nil {
+			return nil, err
+		}
+		for _, f := range v {
+			if err = checkFloat(f, cfg); err != nil {
+				return nil, err
+			}
+			buf = cfg.Endianness.appendUint64(buf, math.Float64bits(f))
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, values)
+	}
+	return buf, nil
+}
+
+// DecodeTypedArray decodes a message written by EncodeTypedArray, returning
+// a slice of the encoded element type, such as []int32. Strings and blobs
+// are views into data unless DefaultConfig.CopyStrings is set. Errors
+// inside the array are *DecodeError values whose Path is the element index.
+func DecodeTypedArray(data []byte) (interface{}, error) {
+	return DecodeTypedArrayWithConfig(data, DefaultConfig)
+}
+
+// DecodeTypedArrayWithConfig is like DecodeTypedArray but takes its limits
+// and options from cfg, whose Endianness must match the encoder's.
+func DecodeTypedArrayWithConfig(data []byte, cfg Config) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyInput
+	}
+	version, err := checkHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if version == VersionChecksum {
+		if data, err = verifyChecksum(data); err != nil {
+			return nil, err
+		}
+	}
+	c := cfg.withDefaults()
+	pos := headerLen
+	values, err := readTypedArray(data, &pos, c)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(data) && !c.AllowTrailingData {
+		return nil, &DecodeError{Offset: pos, Path: []int{}, Err: ErrTrailingData}
+	}
+	return values, nil
+}
+
+// readTypedArray reads the typed array starting at *pos.
+func readTypedArray(data []byte, pos *int, cfg *Config) (interface{}, error) {
+	start := *pos
+	if *pos+2 > len(data) || data[*pos] != byte(TypeTypedArray) {
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: ErrInvalidFormat}
+	}
+	id := Type(data[*pos+1])
+	*pos += 2
+
+	length, bytesRead, err := readVarint(data[*pos:])
+	if err != nil {
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: err}
+	}
+	*pos += bytesRead
+	if length > uint64(cfg.MaxArrayLen) {
+		err = fmt.Errorf("decoded %w", limitError(ErrArrayTooLong, cfg.MaxArrayLen, length))
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: err}
+	}
+	width := minElementSize // Strings, blobs and varints take at least one byte
+	if n, ok := fixedSize(byte(id)); ok && n > 0 {
+		width = n
+	}
+	if !lengthFits(length, data, *pos, width) {
+		err = fmt.Errorf("%w while reading typed array", ErrUnexpectedEOF)
+		return nil, &DecodeError{Offset: start, Path: []int{}, Err: err}
+	}
+	n := int(length)
+
+	// The length check above guarantees every fixed-width payload is present.
+	switch id {
+	case TypeString:
+		out := make([]string, n)
+		for i := range out {
+			elemStart := *pos
+			if out[i], err = readRawString(data, pos, cfg); err != nil {
+				return nil, &DecodeError{Offset: elemStart, Path: []int{i}, Err: err}
+			}
+		}
+		return out, nil
+	case TypeBlob:
+		out := make([][]byte, n)
+		for i := range out {
+			elemStart := *pos
+			if out[i], err = readRawBlob(data, pos, cfg); err != nil {
+				return nil, &DecodeError{Offset: elemStart, Path: []int{i}, Err: err}
+			}
+		}
+		return out, nil
+	case TypeBool:
+		out := make([]bool, n)
+		for i := range out {
+			switch data[*pos] {
+			case 0:
+			case 1:
+				out[i] = true
+			default:
+				err = fmt.Errorf("%w: %d", ErrInvalidBool, data[*pos])
+				return nil, &DecodeError{Offset: *pos, Path: []int{i}, Err: err}
+			}
+			*pos++
+		}
+		return out, nil
+	case TypeVarInt32:
+		out := make([]int32, n)
+		for i := range out {
+			u, bytesRead, err := readVarint(data[*pos:])
+			if err == nil && u > math.MaxUint32 {
+				err = fmt.Errorf("%w for varint int32", ErrIntOutOfRange)
+			}
+			if err != nil {
+				return nil, &DecodeError{Offset: *pos, Path: []int{i}, Err: err}
+			}
+			*pos += bytesRead
+			out[i] = unzigzag32(uint32(u))
+		}
+		return out, nil
+	case TypeVarInt64:
+		out := make([]int64, n)
+		for i := range out {
+			u, bytesRead, err := readVarint(data[*pos:])
+			if err != nil {
+				return nil, &DecodeError{Offset: *pos, Path: []int{i}, Err: err}
+			}
+			*pos += bytesRead
+			out[i] = unzigzag64(u)
+		}
+		return out, nil
+	case TypeInt8:
+		return readFixedArray(data, pos, n, 1, func(b []byte) int8 { return int8(b[0]) }), nil
+	case TypeInt16:
+		return readFixedArray(data, pos, n, 2, func(b []byte) int16 { return int16(cfg.Endianness.uint16(b)) }), nil
+	case TypeInt32:
+		return readFixedArray(data, pos, n, 4, func(b []byte) int32 { return int32(cfg.Endianness.uint32(b)) }), nil
+	case TypeInt64:
+		return readFixedArray(data, pos, n, 8, func(b []byte) int64 { return int64(cfg.Endianness.uint64(b)) }), nil
+	case TypeUint8:
+		return readFixedArray(data, pos, n, 1, func(b []byte) uint8 { return b[0] }), nil
+	case TypeUint16:
+		return readFixedArray(data, pos, n, 2, cfg.Endianness.uint16), nil
+	case TypeUint32:
+		return readFixedArray(data, pos, n, 4, cfg.Endianness.uint32), nil
+	case TypeUint64:
+		return readFixedArray(data, pos, n, 8, cfg.Endianness.uint64), nil
+	case TypeFloat32:
+		return readFixedArray(data, pos, n, 4, func(b []byte) float32 { return math.Float32frombits(cfg.Endianness.uint32(b)) }), nil
+	case TypeFloat64:
+		return readFixedArray(data, pos, n, 8, func(b []byte) float64 { return math.Float64frombits(cfg.Endianness.uint64(b)) }), nil
+	}
+	err = fmt.Errorf("%w in typed array: %c", ErrUnknownType, id)
+	return nil, &DecodeError{Offset: start + 1, Path: []int{}, Err: err}
+}
+
+// readFixedArray reads n payloads of width bytes each with get. The caller
+// must have checked that they are all present.
+func readFixedArray[T any](data []byte, pos *int, n, width int, get func([]byte) T) []T {
+	out := make([]T, n)
+	for i := range out {
+		out[i] = get(data[*pos:])
+		*pos += width
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// typedSlices holds one slice of every type EncodeTypedArray accepts, with
+// each type's extremes.
+var typedSlices = []interface{}{
+	[]string{"", "a", "héllo"},
+	[][]byte{{}, {0}, {0xff, 0x00, 0x80}},
+	[]bool{true, false, true},
+	[]int8{math.MinInt8, -1, 0, math.MaxInt8},
+	[]int16{math.MinInt16, -1, 0, math.MaxInt16},
+	[]int32{math.MinInt32, -1, 0, 1, math.MaxInt32},
+	[]int64{math.MinInt64, -1, 0, 1, math.MaxInt64},
+	[]uint8{0, 1, math.MaxUint8},
+	[]uint16{0, 1, math.MaxUint16},
+	[]uint32{0, 1, math.MaxUint32},
+	[]uint64{0, 1, math.MaxUint64},
+	[]float32{0, -1.5, math.MaxFloat32, float32(math.Inf(-1))},
+	[]float64{0, -1.5, math.SmallestNonzeroFloat64, math.Inf(1)},
+}
+
+func TestTypedArrayRoundTrip(t *testing.T) {
+	configs := []struct {
+		name string
+		cfg  Config
+	}{
+		{"default", Config{}},
+		{"little-endian", Config{Endianness: LittleEndian}},
+		{"varint", Config{VarintInts: true}},
+		{"checksum", Config{Checksum: true}},
+	}
+	for _, c := range configs {
+		for _, values := range typedSlices {
+			data, err := EncodeTypedArrayWithConfig(values, c.cfg)
+			if err != nil {
+				t.Fatalf("%s %T: %v", c.name, values, err)
+			}
+			got, err := DecodeTypedArrayWithConfig(data, c.cfg)
+			if err != nil {
+				t.Fatalf("%s %T: %v", c.name, values, err)
+			}
+			if !reflect.DeepEqual(got, values) {
+				t.Errorf("%s: got %#v, want %#v", c.name, got, values)
+			}
+
+			// A typed array is smaller than the same values in a DataInput,
+			// which spends an identifier on every element.
+			in := make(DataInput, reflect.ValueOf(values).Len())
+			for i := range in {
+				in[i] = reflect.ValueOf(values).Index(i).Interface()
+			}
+			plain, err := EncodeWithConfig(in, c.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) >= len(plain) {
+				t.Errorf("%s %T: typed array is %d bytes, DataInput %d", c.name, values, len(data), len(plain))
+			}
+		}
+	}
+}
+
+func TestTypedArrayLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		values interface{}
+		cfg    Config
+		want   []byte // After the header
+	}{
+		{"int32", []int32{1, -1}, Config{}, []byte{'t', 'I', 2, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff}},
+		{"int32 little-endian", []int32{1, -2}, Config{Endianness: LittleEndian}, []byte{'t', 'I', 2, 1, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff}},
+		{"int32 varint", []int32{1, -1}, Config{VarintInts: true}, []byte{'t', 'i', 2, 2, 1}},
+		{"int64 varint", []int64{-2, 64}, Config{VarintInts: true}, []byte{'t', 'l', 2, 3, 0x80, 1}},
+		{"uint16 little-endian", []uint16{0x0102}, Config{Endianness: LittleEndian}, []byte{'t', 'H', 1, 2, 1}},
+		{"string", []string{"ab"}, Config{}, []byte{'t', 'S', 1, 2, 'a', 'b'}},
+		{"empty", []bool{}, Config{}, []byte{'t', 'B', 0}},
+	}
+	for _, tt := range tests {
+		data, err := EncodeTypedArrayWithConfig(tt.values, tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := data[headerLen:]; string(got) != string(tt.want) {
+			t.Errorf("%s: got %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTypedArrayErrors(t *testing.T) {
+	if _, err := EncodeTypedArray([]int{1}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("[]int: got %v, want ErrUnsupportedType", err)
+	}
+	if _, err := EncodeTypedArray(make([]int8, DefaultConfig.MaxArrayLen+1)); !errors.Is(err, ErrArrayTooLong) {
+		t.Errorf("long array: got %v, want ErrArrayTooLong", err)
+	}
+	if _, err := EncodeTypedArrayWithConfig([]float64{math.NaN()}, Config{StrictFloats: true}); !errors.Is(err, ErrNonFiniteFloat) {
+		t.Errorf("StrictFloats: got %v, want ErrNonFiniteFloat", err)
+	}
+
+	data, err := EncodeTypedArray([]int32{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrEmptyInput},
+		{"truncated", data[:len(data)-1], ErrUnexpectedEOF},
+		{"trailing", append(data[:len(data):len(data)], 0), ErrTrailingData},
+		{"plain message", message('A', 0), ErrInvalidFormat},
+		{"unknown element type", message('t', '?', 0), ErrUnknownType},
+		{"invalid bool", message('t', 'B', 1, 2), ErrInvalidBool},
+		{"huge count", message('t', 'I', 0xff, 0xff, 0xff, 0xff, 0x0f), ErrArrayTooLong},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeTypedArray(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Type is the single-byte identifier that precedes every encoded value.
+type Type byte
+
+// Type identifiers of the binary format.
+const (
+	TypeArray       Type = 'A' // Nested DataInput
+	TypeMap         Type = 'M' // map[string]interface{}
+	TypeDeltaArray  Type = 'V' // DataInput of int32, delta encoded
+	TypeRunArray    Type = 'R' // DataInput of scalars, run-length encoded
+	TypeStringArray Type = 'G' // DataInput of strings, without per-element identifiers
+	TypeTypedArray  Type = 't' // Slice of one scalar type, written by EncodeTypedArray
+	TypeOpenArray   Type = 'a' // DataInput of unknown length, ended by TypeArrayEnd
+	TypeArrayEnd    Type = 'z' // End of a TypeOpenArray
+	TypeString      Type = 'S' // string
+	TypeBlob        Type = 'b' // []byte
+	TypeInt8        Type = 'c' // int8, 1 byte
+	TypeInt16       Type = 'h' // int16, 2 fixed bytes
+	TypeEnum8       Type = 'e' // Enum8, 1 byte
+	TypeEnum16      Type = 'E' // Enum16, 2 fixed bytes
+	TypeInt32       Type = 'I' // int32, 4 fixed bytes
+	TypeVarInt32    Type = 'i' // int32, zigzag varint
+	TypeInt64       Type = 'L' // int64
+	TypeVarInt64    Type = 'l' // int64, zigzag varint
+	TypeUint8       Type = 'Y' // uint8, 1 byte
+	TypeUint16      Type = 'H' // uint16, 2 fixed bytes
+	TypeUint32      Type = 'W' // uint32, 4 fixed bytes
+	TypeUint64      Type = 'U' // uint64
+	TypeFloat32     Type = 'f' // float32
+	TypeFloat64     Type = 'F' // float64
+	TypeComplex128  Type = 'C' // complex128, as two float64 (real, imaginary)
+	TypeBigInt      Type = 'Z' // *big.Int, as a sign byte and big-endian magnitude
+	TypeIP          Type = 'P' // net.IP, as a family byte and 0, 4 or 16 bytes
+	TypeDecimal     Type = 'Q' // Decimal, as a scale byte and two's complement mantissa
+	TypeBool        Type = 'B' // bool
+	TypeNull        Type = 'N' // nil
+	TypeTime        Type = 'T' // time.Time
+	TypeExtension   Type = 'X' // encoding.BinaryMarshaler registered with RegisterType
+	TypeDict        Type = 'D' // String dictionary preceding the top-level array
+	TypeDictRef     Type = 'd' // string, as an index into the dictionary
+	TypeSchema      Type = 's' // Top-level element types preceding the array, written by EncodeWithSchema
+)
+
+// isKnownType reports whether id is a built-in type identifier.
+func isKnownType(id byte) bool {
+	switch Type(id) {
+	case TypeArray, TypeMap, TypeDeltaArray, TypeRunArray, TypeStringArray, TypeOpenArray, TypeArrayEnd, TypeString, TypeBlob, TypeInt8, TypeInt16, TypeEnum8, TypeEnum16, TypeInt32, TypeVarInt32, TypeInt64, TypeVarInt64,
+		TypeUint8, TypeUint16, TypeUint32, TypeUint64, TypeFloat32, TypeFloat64, TypeComplex128, TypeBigInt, TypeIP, TypeDecimal, TypeBool, TypeNull, TypeTime, TypeExtension, TypeDictRef:
+		return true
+	}
+	return false
+}
+
+// isReservedType reports whether id is unavailable to RegisterIdentifier:
+// a built-in type identifier, or one that marks a section of the message
+// rather than a value.
+func isReservedType(id byte) bool {
+	switch Type(id) {
+	case TypeDict, TypeTypedArray, TypeSchema:
+		return true
+	}
+	return isKnownType(id)
+}
+
+// PeekType returns the type of the value encoded at data[pos] without
+// consuming it. Identifiers added with RegisterIdentifier are accepted.
+func PeekType(data []byte, pos int) (Type, error) {
+	if pos < 0 || pos >= len(data) {
+		return 0, ErrUnexpectedEOF
+	}
+	if _, custom := customCodec(data[pos]); !isKnownType(data[pos]) && !custom {
+		return 0, fmt.Errorf("%w: %c", ErrUnknownType, data[pos])
+	}
+	return Type(data[pos]), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestPeekType encodes one value of each type and checks PeekType reports
+// its identifier without consuming it.
+func TestPeekType(t *testing.T) {
+	registerTestDuration(t)
+	tests := []struct {
+		v    interface{}
+		cfg  Config
+		want Type
+	}{
+		{DataInput{}, Config{}, TypeArray},
+		{map[string]interface{}{}, Config{}, TypeMap},
+		{DataInput{int32(1), int32(2), int32(3)}, Config{DeltaInts: true}, TypeDeltaArray},
+		{DataInput{nil, nil, nil, nil}, Config{RunLength: true}, TypeRunArray},
+		{DataInput{"a", "b"}, Config{StringArrays: true}, TypeStringArray},
+		{"s", Config{}, TypeString},
+		{[]byte{1}, Config{}, TypeBlob},
+		{int8(1), Config{}, TypeInt8},
+		{int16(1), Config{}, TypeInt16},
+		{Enum8(1), Config{}, TypeEnum8},
+		{Enum16(1), Config{}, TypeEnum16},
+		{int32(1), Config{}, TypeInt32},
+		{int32(1), Config{VarintInts: true}, TypeVarInt32},
+		{int64(1 << 60), Config{}, TypeInt64},
+		{int64(1), Config{OptimizeIntegers: true}, TypeVarInt64},
+		{uint8(1), Config{}, TypeUint8},
+		{uint16(1), Config{}, TypeUint16},
+		{uint32(1), Config{}, TypeUint32},
+		{uint64(1), Config{}, TypeUint64},
+		{float32(1), Config{}, TypeFloat32},
+		{1.0, Config{}, TypeFloat64},
+		{complex(1, 1), Config{}, TypeComplex128},
+		{big.NewInt(1), Config{}, TypeBigInt},
+		{net.IPv4(1, 2, 3, 4).To4(), Config{}, TypeIP},
+		{Decimal{Unscaled: big.NewInt(1)}, Config{}, TypeDecimal},
+		{true, Config{}, TypeBool},
+		{nil, Config{}, TypeNull},
+		{time.Unix(0, 0), Config{}, TypeTime},
+		{"repeated", Config{DictStrings: true}, TypeDictRef},
+		{time.Duration(1), Config{}, durationID},
+	}
+	for _, tt := range tests {
+		in, pos := DataInput{tt.v}, headerLen+2
+		if tt.want == TypeDictRef {
+			in = DataInput{tt.v, tt.v} // Repeated, so it goes in the dictionary
+			pos += dictSize([]string{tt.v.(string)})
+		}
+		data, err := EncodeWithConfig(in, tt.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PeekType(data, pos)
+		if err != nil || got != tt.want {
+			t.Errorf("PeekType of %#v = %q, %v; want %q", tt.v, got, err, tt.want)
+		}
+	}
+
+	var open bytes.Buffer
+	e := NewEncoder(&open)
+	if err := e.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+	for pos, want := range map[int]Type{headerLen: TypeOpenArray, headerLen + 1: TypeArrayEnd} {
+		if got, err := PeekType(open.Bytes(), pos); err != nil || got != want {
+			t.Errorf("PeekType of an open array at %d = %q, %v; want %q", pos, got, err, want)
+		}
+	}
+
+	data := roundTrip(t, DataInput{"x"})
+	for _, pos := range []int{-1, len(data)} {
+		if _, err := PeekType(data, pos); !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("PeekType at %d of %d: got %v, want ErrUnexpectedEOF", pos, len(data), err)
+		}
+	}
+	for _, id := range []byte{0, '?', 0xff} {
+		if _, err := PeekType([]byte{id}, 0); !errors.Is(err, ErrUnknownType) {
+			t.Errorf("PeekType of %q: got %v, want ErrUnknownType", id, err)
+		}
+	}
+}
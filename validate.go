@@ -0,0 +1,41 @@
+package main
+
+// Validate reports whether data is a well-formed encoded message, enforcing
+// the same structural rules and DefaultConfig limits as decode but without
+// allocating the decoded value. It returns the first problem found, or nil
+// exactly when decode would succeed. Extension values are checked for a
+// registered name but their payloads are not unmarshaled.
+func Validate(data []byte) error {
+	return validate(data, DefaultConfig.withDefaults())
+}
+
+// validate checks data against cfg.
+func validate(data []byte, cfg *Config) error {
+	if len(data) == 0 {
+		return ErrEmptyInput
+	}
+	version, err := checkHeader(data)
+	if err != nil {
+		return err
+	}
+	if version == VersionChecksum {
+		if data, err = verifyChecksum(data); err != nil {
+			return err
+		}
+	}
+
+	pos := headerLen
+	if cfg, err = readDict(data, &pos, cfg, cfg.flat != nil); err != nil {
+		return err
+	}
+	if pos >= len(data) || !isArray(data[pos]) {
+		return ErrInvalidFormat
+	}
+	if err := skipHelper(data, &pos, 1, cfg); err != nil {
+		return err
+	}
+	if pos != len(data) && !cfg.AllowTrailingData {
+		return ErrTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestValidateMatchesDecode checks Validate accepts exactly the inputs
+// decode accepts, over random messages in every encoding option and
+// truncated, corrupted and random variants of them.
+func TestValidateMatchesDecode(t *testing.T) {
+	r := rand.New(rand.NewSource(33))
+	configs := []Config{
+		{},
+		{VarintInts: true, OptimizeIntegers: true, Checksum: true},
+		{DictStrings: true, RunLength: true},
+		{DeltaInts: true, StringArrays: true},
+		{DictStrings: true, RunLength: true, DeltaInts: true, StringArrays: true, VarintInts: true},
+	}
+
+	check := func(data []byte) {
+		t.Helper()
+		_, decodeErr := decode(data)
+		validateErr := Validate(data)
+		if (decodeErr == nil) != (validateErr == nil) {
+			t.Fatalf("%x:\ndecode:   %v\nValidate: %v", data, decodeErr, validateErr)
+		}
+	}
+
+	for i := 0; i < 3000; i++ {
+		in := randomArray(r, 4)
+		if r.Intn(4) == 0 { // Give the compact array forms something to work with
+			in = append(in, DataInput{int32(1), int32(2), int32(2)}, DataInput{"a", "a", "b"})
+		}
+		data, err := EncodeWithConfig(in, configs[r.Intn(len(configs))])
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(data)
+		check(data[:r.Intn(len(data))])
+
+		corrupt := append([]byte(nil), data...)
+		for n := 1 + r.Intn(3); n > 0; n-- {
+			corrupt[headerLen+r.Intn(len(corrupt)-headerLen)] = byte(r.Intn(256))
+		}
+		check(corrupt)
+
+		random := append(append([]byte(nil), data[:headerLen]...), make([]byte, r.Intn(32))...)
+		r.Read(random[headerLen:])
+		check(random)
+	}
+}
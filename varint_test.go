@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestReadVarintCanonical(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+		err  error
+	}{
+		{"00", 0, nil},
+		{"01", 1, nil},
+		{"7f", 127, nil},
+		{"8001", 128, nil},
+		{"ac02", 300, nil},
+		{"8000", 0, ErrNonCanonicalVarint},
+		{"8100", 0, ErrNonCanonicalVarint},
+		{"ac8200", 0, ErrNonCanonicalVarint},
+		{"ffffffffffffffffff00", 0, ErrNonCanonicalVarint},
+	}
+	for _, tt := range tests {
+		in, _ := hex.DecodeString(tt.in)
+		got, n, err := readVarint(in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && (got != tt.want || n != len(in)) {
+			t.Errorf("%s: got %d from %d bytes, want %d from %d", tt.in, got, n, tt.want, len(in))
+		}
+	}
+
+	// Padding any minimal encoding with a zero group makes it non-canonical.
+	r := rand.New(rand.NewSource(59))
+	for i := 0; i < 1000; i++ {
+		v := r.Uint64() >> r.Intn(64)
+		min := appendVarint(nil, v)
+		if got, _, err := readVarint(min); err != nil || got != v {
+			t.Fatalf("%x: got %d, %v, want %d", min, got, err, v)
+		}
+		if len(min) == maxVarintLen {
+			continue
+		}
+		padded := append(bytes.Clone(min), 0)
+		padded[len(min)-1] |= 0x80
+		if _, _, err := readVarint(padded); !errors.Is(err, ErrNonCanonicalVarint) {
+			t.Fatalf("%x: got %v, want ErrNonCanonicalVarint", padded, err)
+		}
+	}
+}
+
+// TestNonCanonicalVarintMessage checks a padded length is rejected by every
+// decoding entry point, not just readVarint.
+func TestNonCanonicalVarintMessage(t *testing.T) {
+	header := append(magic[:len(magic):len(magic)], Version)
+	minimal := append(bytes.Clone(header), byte(TypeArray), 1, byte(TypeString), 0x03, 'a', 'b', 'c')
+	padded := append(bytes.Clone(header), byte(TypeArray), 1, byte(TypeString), 0x83, 0x00, 'a', 'b', 'c')
+
+	if _, err := decode(minimal); err != nil {
+		t.Fatalf("minimal: %v", err)
+	}
+	if _, err := decode(padded); !errors.Is(err, ErrNonCanonicalVarint) {
+		t.Errorf("decode: got %v, want ErrNonCanonicalVarint", err)
+	}
+	if err := Validate(padded); !errors.Is(err, ErrNonCanonicalVarint) {
+		t.Errorf("Validate: got %v, want ErrNonCanonicalVarint", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(padded)).Decode(); !errors.Is(err, ErrNonCanonicalVarint) {
+		t.Errorf("Decoder: got %v, want ErrNonCanonicalVarint", err)
+	}
+}
+
+// TestVarintRange checks the full uint64 range round-trips in at most
+// maxVarintLen bytes, written as encoding/binary writes it, and that
+// anything past math.MaxUint64 is rejected where encoding/binary rejects it.
+func TestVarintRange(t *testing.T) {
+	for _, v := range []uint64{0, 1<<7 - 1, 1 << 7, 1<<14 - 1, 1 << 14, 1<<56 - 1, 1 << 56, 1<<63 - 1, 1 << 63, math.MaxUint64} {
+		b := appendVarint(nil, v)
+		if want := binary.AppendUvarint(nil, v); !bytes.Equal(b, want) {
+			t.Errorf("appendVarint(%d) = %x, encoding/binary writes %x", v, b, want)
+		}
+		if len(b) > maxVarintLen {
+			t.Errorf("appendVarint(%d) is %d bytes, more than maxVarintLen", v, len(b))
+		}
+		if got, n, err := readVarint(b); err != nil || got != v || n != len(b) {
+			t.Errorf("readVarint(%x) = %d, %d, %v, want %d", b, got, n, err, v)
+		}
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		err  error
+	}{
+		{"max uint64", "ffffffffffffffffff01", nil},
+		{"max uint64 + 1", "80808080808080808002", ErrVarintOverflow},
+		{"tenth byte 0x7f", "ffffffffffffffffff7f", ErrVarintOverflow},
+		{"continued tenth byte", "ffffffffffffffffff8100", ErrVarintTooLong},
+		{"eleven bytes", "ffffffffffffffffffff01", ErrVarintTooLong},
+	}
+	for _, tt := range tests {
+		in, _ := hex.DecodeString(tt.in)
+		_, _, err := readVarint(in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		if _, n := binary.Uvarint(in); (n > 0) != (tt.err == nil) {
+			t.Errorf("%s: encoding/binary disagrees: n = %d", tt.name, n)
+		}
+	}
+
+	// The same overflow in a length prefix fails the whole message.
+	header := append(magic[:len(magic):len(magic)], Version)
+	over, _ := hex.DecodeString("80808080808080808002")
+	msg := append(append(header, byte(TypeArray), 1, byte(TypeString)), over...)
+	if _, err := decode(msg); !errors.Is(err, ErrVarintOverflow) {
+		t.Errorf("decode: got %v, want ErrVarintOverflow", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(msg)).Decode(); !errors.Is(err, ErrVarintOverflow) {
+		t.Errorf("Decoder: got %v, want ErrVarintOverflow", err)
+	}
+}
+
+// TestVarintInt32Size compares the size of int32 elements written with
+// VarintInts against the fixed 4-byte form, and checks both decode back.
+func TestVarintInt32Size(t *testing.T) {
+	tests := []struct {
+		v    int32
+		size int // Varint payload bytes
+	}{
+		{0, 1},
+		{7, 1},
+		{-1, 1},
+		{63, 1},
+		{-64, 1},
+		{64, 2},
+		{-65, 2},
+		{1 << 20, 4},
+		{math.MaxInt32, 5},
+		{math.MinInt32, 5},
+	}
+	for _, tt := range tests {
+		in := DataInput{tt.v}
+		fixed := roundTrip(t, in)
+		data, err := EncodeWithConfig(in, Config{VarintInts: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Type(data[headerLen+2]); got != TypeVarInt32 {
+			t.Errorf("%d encoded as %v, want TypeVarInt32", tt.v, got)
+		}
+		if got := len(data) - len(fixed) + 4; got != tt.size {
+			t.Errorf("%d: varint payload of %d bytes, want %d", tt.v, got, tt.size)
+		}
+		got, err := decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(in) {
+			t.Errorf("got %v, want %v", got, in)
+		}
+	}
+}